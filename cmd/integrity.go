@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// UpdatePublicKey is the minisign public key (the base64 line of a minisign.pub
+// file) that release checksums must be signed with. It is set at build time
+// with -ldflags "-X shireesh.com/gallium/cmd.UpdatePublicKey=..."; when empty,
+// updates are verified against checksums.txt only.
+var UpdatePublicKey = ""
+
+const (
+	checksumsAssetName = "checksums.txt"
+	signatureSuffix    = ".minisig"
+)
+
+// parseChecksums reads sha256sum/shasum output and returns the digest for assetName.
+func parseChecksums(data []byte, assetName string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// shasum marks binary mode with a leading '*' on the file name
+		if strings.TrimPrefix(fields[1], "*") != assetName {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("malformed checksum for %s", assetName)
+		}
+		return sum, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s has no entry for %s", checksumsAssetName, assetName)
+}
+
+// verifyChecksum checks data against the SHA-256 digest listed for assetName in checksums.
+func verifyChecksum(data, checksums []byte, assetName string) error {
+	want, err := parseChecksums(checksums, assetName)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(data)
+	if !bytes.Equal(got[:], want) {
+		return fmt.Errorf("checksum mismatch for %s: got %x, want %x", assetName, got, want)
+	}
+	return nil
+}
+
+// minisignPublicKey is a decoded minisign public key.
+type minisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+func parseMinisignPublicKey(encoded string) (*minisignPublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid update public key: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, errors.New("invalid update public key: not a minisign Ed25519 key")
+	}
+	pk := &minisignPublicKey{key: ed25519.PublicKey(raw[10:])}
+	copy(pk.keyID[:], raw[2:10])
+	return pk, nil
+}
+
+// verifyMinisign checks a minisign detached signature over message. Both the
+// legacy ("Ed") and the default prehashed ("ED", BLAKE2b-512) formats are accepted,
+// and the global signature over the trusted comment must verify too.
+func verifyMinisign(publicKey string, message, signature []byte) error {
+	pk, err := parseMinisignPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], pk.keyID[:]) {
+		return fmt.Errorf("signature key id %X does not match update public key %X", sig[2:10], pk.keyID[:])
+	}
+
+	signed := message
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		digest := blake2b.Sum512(message)
+		signed = digest[:]
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(pk.key, signed, sig[10:]) {
+		return errors.New("signature verification failed")
+	}
+
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("malformed minisign global signature")
+	}
+	if !ed25519.Verify(pk.key, append(append([]byte(nil), sig[10:]...), trustedComment...), globalSig) {
+		return errors.New("trusted comment signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReleaseRepo    = "gshireesh/gallium"
+	defaultReleaseBaseURL = "https://github.com"
+	defaultReleaseAPIURL  = "https://api.github.com"
+)
+
+// Release channels.
+const (
+	channelStable     = "stable"
+	channelPrerelease = "prerelease"
+)
+
+// releaseSource locates gallium releases. By default they come from a GitHub
+// repository: BaseURL serves the release assets and APIURL reports the latest
+// tag. When Mirror is set, releases come from a mirror instead (see updateCmd).
+type releaseSource struct {
+	Repo    string
+	BaseURL string
+	APIURL  string
+	Mirror  string
+	Channel string
+}
+
+var defaultReleaseSource = releaseSource{
+	Repo:    defaultReleaseRepo,
+	BaseURL: defaultReleaseBaseURL,
+	APIURL:  defaultReleaseAPIURL,
+	Channel: channelStable,
+}
+
+// releaseSourceFromEnv returns the default release source with any
+// GALLIUM_RELEASE_* and GALLIUM_UPDATE_CHANNEL overrides applied.
+func releaseSourceFromEnv() releaseSource {
+	source := defaultReleaseSource
+	if v := os.Getenv("GALLIUM_RELEASE_REPO"); v != "" {
+		source.Repo = v
+	}
+	if v := os.Getenv("GALLIUM_RELEASE_BASE_URL"); v != "" {
+		source.BaseURL = v
+	}
+	if v := os.Getenv("GALLIUM_RELEASE_API_URL"); v != "" {
+		source.APIURL = v
+	}
+	if v := os.Getenv("GALLIUM_RELEASE_MIRROR"); v != "" {
+		source.Mirror = v
+	}
+	if v := os.Getenv("GALLIUM_UPDATE_CHANNEL"); v != "" {
+		source.Channel = v
+	}
+	return source
+}
+
+func (s releaseSource) validate() error {
+	switch s.Channel {
+	case "", channelStable, channelPrerelease:
+		return nil
+	}
+	return fmt.Errorf("unknown release channel %q: want %q or %q", s.Channel, channelStable, channelPrerelease)
+}
+
+// key identifies the source and channel, so cached results from another source are not reused.
+func (s releaseSource) key() string {
+	if s.Mirror != "" {
+		return s.mirrorURL() + "#" + s.channel()
+	}
+	return strings.TrimSuffix(s.APIURL, "/") + "/repos/" + s.Repo + "#" + s.channel()
+}
+
+func (s releaseSource) channel() string {
+	if s.Channel == "" {
+		return channelStable
+	}
+	return s.Channel
+}
+
+// mirrorURL returns Mirror as a URL; local paths become file:// URLs.
+func (s releaseSource) mirrorURL() string {
+	if strings.Contains(s.Mirror, "://") {
+		return strings.TrimSuffix(s.Mirror, "/")
+	}
+	abs, err := filepath.Abs(s.Mirror)
+	if err != nil {
+		abs = s.Mirror
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+// downloadURL returns the URL release assets of tag are served under; an
+// empty tag means the latest release.
+func (s releaseSource) downloadURL(tag string) string {
+	if s.Mirror != "" {
+		if tag == "" {
+			tag = "latest"
+		}
+		return s.mirrorURL() + "/" + tag
+	}
+	base := strings.TrimSuffix(s.BaseURL, "/") + "/" + s.Repo + "/releases"
+	if tag == "" {
+		return base + "/latest/download"
+	}
+	return base + "/download/" + tag
+}
+
+// latestTag returns the tag of the newest release on the source's channel.
+func (s releaseSource) latestTag(ctx context.Context, client *http.Client) (string, error) {
+	if s.Mirror != "" {
+		return s.mirrorLatestTag(ctx, client)
+	}
+	if s.channel() == channelPrerelease {
+		return s.githubNewestTag(ctx, client)
+	}
+
+	url := strings.TrimSuffix(s.APIURL, "/") + "/repos/" + s.Repo + "/releases/latest"
+	body, err := fetchURL(ctx, client, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to query latest release: %w", err)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(body, &release); err != nil {
+		return "", fmt.Errorf("failed to parse latest release from %s: %w", url, err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("latest release from %s has no tag", url)
+	}
+	return release.TagName, nil
+}
+
+// githubNewestTag returns the highest versioned published release, prereleases
+// included. GitHub's releases/latest endpoint never reports prereleases.
+func (s releaseSource) githubNewestTag(ctx context.Context, client *http.Client) (string, error) {
+	url := strings.TrimSuffix(s.APIURL, "/") + "/repos/" + s.Repo + "/releases?per_page=100"
+	body, err := fetchURL(ctx, client, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to query releases: %w", err)
+	}
+
+	var releases []struct {
+		TagName string `json:"tag_name"`
+		Draft   bool   `json:"draft"`
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return "", fmt.Errorf("failed to parse releases from %s: %w", url, err)
+	}
+
+	var newest string
+	var newestVersion semver
+	for _, release := range releases {
+		version, ok := parseSemver(release.TagName)
+		if release.Draft || !ok {
+			continue
+		}
+		if newest == "" || compareSemver(version, newestVersion) > 0 {
+			newest, newestVersion = release.TagName, version
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no published releases at %s", url)
+	}
+	return newest, nil
+}
+
+func (s releaseSource) mirrorLatestTag(ctx context.Context, client *http.Client) (string, error) {
+	name := "latest"
+	if s.channel() == channelPrerelease {
+		name = "latest-prerelease"
+	}
+	url := s.mirrorURL() + "/" + name
+	body, err := fetchURL(ctx, client, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to query latest release: %w", err)
+	}
+	tag := strings.TrimSpace(string(body))
+	if tag == "" || strings.ContainsAny(tag, "/ \t\n") {
+		return "", fmt.Errorf("%s does not hold a release tag", url)
+	}
+	return tag, nil
+}
+
+// newReleaseClient returns an HTTP client for release downloads that also
+// reads file:// URLs. Requests use proxy when set and otherwise the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func newReleaseClient(proxy string, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
@@ -10,44 +12,71 @@ import (
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 
+	"shireesh.com/gallium/internal/compressor"
 	"shireesh.com/gallium/internal/generator"
 )
 
 var (
-	TemplatesPath   string
+	// Templates holds the template tree, one directory per template.
+	Templates       fs.FS
 	templateFlag    string
 	projectNameFlag string
+	outputArchive   string
+	strictFlag      bool
+	verifyFlag      bool
+	allFlag         bool
 )
 
 func init() {
-	rootCmd.Flags().StringVarP(&templateFlag, "template", "t", "", "Template name")
-	rootCmd.Flags().StringVarP(&projectNameFlag, "name", "n", "", "Project name (directory to generate in)")
+	addGenerateFlags(rootCmd)
+	addGenerateFlags(generateCmd)
+	generateCmd.Flags().BoolVar(&allFlag, "all", false, "With --verify, generate and verify every template in a temporary directory")
+	rootCmd.AddCommand(generateCmd)
 }
 
-func expandPath(path string) (string, error) {
-	if strings.HasPrefix(path, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", err
-		}
-		return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
-	}
-	return path, nil
+// addGenerateFlags registers the generation flags shared by the root and generate commands.
+func addGenerateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&templateFlag, "template", "t", "", "Template name")
+	cmd.Flags().StringVarP(&projectNameFlag, "name", "n", "", "Project name (directory to generate in)")
+	cmd.Flags().BoolVar(&strictFlag, "strict", os.Getenv("CI") != "", "Fail on references to unset template variables (default on when CI is set)")
+	cmd.Flags().StringVar(&outputArchive, "output-archive", "", "Write the project into a .tar.gz, .tgz or .zip archive instead of a directory")
+	cmd.Flags().BoolVar(&verifyFlag, "verify", false, "Run the template's verify commands against a copy of the generated project")
 }
 
 var rootCmd = &cobra.Command{
-	Use:          "gallium",
-	Short:        "Scaffold new projects from templates with hooks",
-	SilenceUsage: true,
+	Use:           "gallium",
+	Short:         "Scaffold new projects from templates with hooks",
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runGenerator()
+		return runGenerator(cmd.OutOrStdout())
 	},
 }
 
-func Execute(templatesPath string) {
-	TemplatesPath = templatesPath
-	if err := rootCmd.Execute(); err != nil {
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a project from a template",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if allFlag {
+			if !verifyFlag {
+				return fmt.Errorf("--all requires --verify")
+			}
+			return verifyAllTemplates(cmd.OutOrStdout())
+		}
+		return runGenerator(cmd.OutOrStdout())
+	},
+}
+
+func Execute(templates fs.FS) {
+	Templates = templates
+	printUpdateNotice := startUpdateCheck(os.Args[1:])
+	err := rootCmd.Execute()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	printUpdateNotice(os.Stderr)
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -70,26 +99,14 @@ func selectPrompt(label string, items []string) (string, error) {
 	return result, err
 }
 
-func runGenerator() error {
-	base, err := expandPath(TemplatesPath)
-	if err != nil {
-		return fmt.Errorf("failed to expand template path: %w", err)
+func runGenerator(out io.Writer) error {
+	if verifyFlag && outputArchive != "" {
+		return fmt.Errorf("--verify cannot be combined with --output-archive")
 	}
 
-	entries, err := os.ReadDir(base)
+	templates, err := listTemplates(Templates)
 	if err != nil {
-		return fmt.Errorf("failed to read template directory: %w", err)
-	}
-
-	var templates []string
-	for _, e := range entries {
-		if e.IsDir() {
-			templates = append(templates, e.Name())
-		}
-	}
-	sort.Strings(templates)
-	if len(templates) == 0 {
-		return fmt.Errorf("no templates found in %s", base)
+		return err
 	}
 
 	tplName := templateFlag
@@ -103,6 +120,9 @@ func runGenerator() error {
 	}
 
 	projectPath := projectNameFlag
+	if projectPath == "" && outputArchive != "" {
+		projectPath = compressor.TrimArchiveExt(outputArchive)
+	}
 	if projectPath == "" {
 		projectPath, err = inputPrompt("Enter project name")
 		if err != nil {
@@ -129,17 +149,109 @@ func runGenerator() error {
 		}
 	}
 
-	vars := map[string]string{
-		"ProjectName": projectName,
-		"projectName": projectName,
+	vars := generator.ProjectVars(projectName)
+	opts := generator.Options{Strict: strictFlag}
+	if outputArchive != "" {
+		if err := generator.GenerateArchive(Templates, tplName, projectName, outputArchive, vars, opts); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Wrote %s\n", outputArchive)
+		return nil
+	}
+	if err := generator.Generate(Templates, tplName, projectPath, vars, opts); err != nil {
+		return err
+	}
+
+	if verifyFlag {
+		results, err := generator.Verify(Templates, tplName, projectPath)
+		if err != nil {
+			return err
+		}
+		if !printVerifyResults(out, tplName, results) {
+			return fmt.Errorf("verification of %s failed", tplName)
+		}
 	}
-	if err := generator.Generate(tplName, projectPath, base, vars); err != nil {
+	return nil
+}
+
+// verifyAllTemplates generates every template into a temporary directory with
+// strict rendering and runs its verify commands, reporting pass/fail per template.
+func verifyAllTemplates(out io.Writer) error {
+	templates, err := listTemplates(Templates)
+	if err != nil {
 		return err
 	}
 
+	var failed []string
+	for _, tplName := range templates {
+		workDir, err := os.MkdirTemp("", "gallium-"+tplName+"-*")
+		if err != nil {
+			return err
+		}
+		projectPath := filepath.Join(workDir, "demo")
+		results, err := generateAndVerify(tplName, projectPath)
+		os.RemoveAll(workDir)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL %s: %v\n", tplName, err)
+			failed = append(failed, tplName)
+			continue
+		}
+		if !printVerifyResults(out, tplName, results) {
+			failed = append(failed, tplName)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("verification failed for %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
+func generateAndVerify(tplName, projectPath string) ([]generator.VerifyResult, error) {
+	vars := generator.ProjectVars(filepath.Base(projectPath))
+	if err := generator.Generate(Templates, tplName, projectPath, vars, generator.Options{Strict: true}); err != nil {
+		return nil, err
+	}
+	return generator.Verify(Templates, tplName, projectPath)
+}
+
+// printVerifyResults reports each verify command and returns whether all passed.
+func printVerifyResults(out io.Writer, tplName string, results []generator.VerifyResult) bool {
+	if len(results) == 0 {
+		fmt.Fprintf(out, "?    %s [no verify commands]\n", tplName)
+		return true
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(out, "FAIL %s: %s: %v\n", tplName, result.Command, result.Err)
+			for _, line := range strings.Split(strings.TrimRight(result.Output, "\n"), "\n") {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+			continue
+		}
+		fmt.Fprintf(out, "ok   %s: %s\n", tplName, result.Command)
+	}
+	return !generator.VerifyFailed(results)
+}
+
+func listTemplates(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	var templates []string
+	for _, e := range entries {
+		if e.IsDir() {
+			templates = append(templates, e.Name())
+		}
+	}
+	sort.Strings(templates)
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates found")
+	}
+	return templates, nil
+}
+
 func containsTemplate(templates []string, wanted string) bool {
 	for _, templateName := range templates {
 		if templateName == wanted {
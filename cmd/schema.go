@@ -0,0 +1,274 @@
+//go:build cgo
+
+// The schema commands parse SQL with pg_query, which needs cgo.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"shireesh.com/gallium/internal/schema"
+)
+
+var (
+	schemaOut            string
+	schemaFilter         []string
+	schemaIncludeIndexes bool
+	schemaSeparateFKs    bool
+	schemaRules          string
+	schemaStrict         bool
+	schemaFormat         string
+	schemaGoPackage      string
+	schemaBaseline       bool
+	schemaBaselineDir    string
+	schemaArchive        string
+	schemaDeleteOld      bool
+	schemaVersionInsert  bool
+	schemaDSN            string
+	schemaDiffDir        string
+	schemaDiffName       string
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Work with Postgres schemas built from migration files",
+}
+
+var schemaSquashCmd = &cobra.Command{
+	Use:   "squash <dir>",
+	Short: "Replay *.up.sql migrations and print the DDL of the resulting schema",
+	Long: `Replay *.up.sql migrations and print the DDL of the resulting schema.
+
+Statements that are skipped are reported on stderr with their file and
+statement number, grouped by kind: "ignored" ones do not change the schema
+(INSERT, SET, ...), "unsupported" ones change it in ways the output does not
+reproduce and "error" ones could not be parsed. --strict fails on anything
+unsupported or in error.
+
+Tables are created after the tables their foreign keys reference; foreign
+keys in a cycle, or all of them with --separate-fks, are added with ALTER
+TABLE after the tables.
+
+--format picks the output: ddl, the schema model as json or yaml, go structs
+with db tags, or an ER diagram of the foreign keys as mermaid or dot.
+
+--baseline writes the DDL as a golang-migrate 000001_baseline.up.sql and
+.down.sql pair instead, which replaces the migrations: they are moved to
+--archive or removed with --delete-superseded. --version-insert ends the up
+migration with the schema_migrations row of the highest version replaced.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := schema.SquashOptions{
+			SchemaFilter:   schemaFilter,
+			IncludeIndexes: schemaIncludeIndexes,
+			SeparateFKs:    schemaSeparateFKs,
+			Strict:         schemaStrict,
+			Format:         schemaFormat,
+			GoPackage:      schemaGoPackage,
+		}
+		rules, err := loadSchemaRules()
+		if err != nil {
+			return err
+		}
+		opts.Rules = rules
+		if schemaBaseline {
+			return runBaseline(cmd, args[0], opts)
+		}
+		if schemaBaselineDir != "" || schemaArchive != "" || schemaDeleteOld || schemaVersionInsert {
+			return fmt.Errorf("--baseline-dir, --archive, --delete-superseded and --version-insert need --baseline")
+		}
+		ddl, diags, err := schema.Squash(args[0], opts)
+		if err := writeDiagnostics(cmd, diags); err != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to squash %s: %w", args[0], err)
+		}
+		return writeOutput(cmd, schemaOut, ddl)
+	},
+}
+
+var schemaDiffCmd = &cobra.Command{
+	Use:   "diff <old> <new>",
+	Short: "Generate the migration between two schemas",
+	Long: `Generate the migration between two schemas.
+
+<old> and <new> are each a directory of *.up.sql migrations or a single SQL
+file, such as a pg_dump --schema-only dump. The ALTER statements that turn
+<old> into <new> and back are compared on tables, columns, constraints,
+indexes and comments.
+
+With --dir the statements are written as the next golang-migrate pair in that
+directory, NNN_<name>.up.sql and NNN_<name>.down.sql; otherwise both are
+printed. Skipped statements are reported as for squash.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rules, err := loadSchemaRules()
+		if err != nil {
+			return err
+		}
+		opts := schema.DiffOptions{SchemaFilter: schemaFilter, Rules: rules, Strict: schemaStrict}
+		up, down, diags, err := schema.DiffSources(args[0], args[1], opts)
+		if err := writeDiagnostics(cmd, diags); err != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to diff %s and %s: %w", args[0], args[1], err)
+		}
+		if up == "" {
+			fmt.Fprintln(cmd.ErrOrStderr(), "No differences.")
+			return nil
+		}
+		if schemaDiffDir == "" {
+			return writeOutput(cmd, "", "-- up\n"+up+"\n-- down\n"+down)
+		}
+		upPath, downPath, err := schema.WriteMigration(schemaDiffDir, schemaDiffName, up, down)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\nWrote %s\n", upPath, downPath)
+		return nil
+	},
+}
+
+var schemaVerifyCmd = &cobra.Command{
+	Use:   "verify <dir>",
+	Short: "Check that squashing the migrations in a directory is lossless",
+	Long: `Check that squashing the migrations in a directory is lossless.
+
+The squashed DDL and, separately, every *.up.sql migration in order are applied
+to two scratch databases created on the Postgres server given by --dsn (or
+DATABASE_URL), whose role needs CREATEDB. Their catalogs are compared: tables,
+columns, constraints, indexes, views, sequences, enum types, functions,
+triggers, extensions and comments. Each difference is printed and the command
+fails if there are any. The scratch databases are dropped afterwards.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dsn := schemaDSN
+		if dsn == "" {
+			dsn = os.Getenv("DATABASE_URL")
+		}
+		if dsn == "" {
+			return fmt.Errorf("--dsn or DATABASE_URL is required")
+		}
+		rules, err := loadSchemaRules()
+		if err != nil {
+			return err
+		}
+		opts := schema.VerifyOptions{
+			SquashOptions: schema.SquashOptions{IncludeIndexes: true, Rules: rules, Strict: schemaStrict},
+			DSN:           dsn,
+		}
+		diffs, diags, err := schema.Verify(cmd.Context(), args[0], opts)
+		if err := writeDiagnostics(cmd, diags); err != nil {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to verify %s: %w", args[0], err)
+		}
+		if len(diffs) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "The squashed schema matches the migrations.")
+			return nil
+		}
+		if err := schema.WriteDifferences(cmd.OutOrStdout(), diffs); err != nil {
+			return err
+		}
+		return fmt.Errorf("the squashed schema differs from the migrations in %d places", len(diffs))
+	},
+}
+
+func init() {
+	schemaSquashCmd.Flags().StringVarP(&schemaOut, "out", "o", "", "Write the DDL to this file instead of stdout")
+	schemaSquashCmd.Flags().StringSliceVar(&schemaFilter, "schema-filter", nil, "Only keep tables in these Postgres schemas (glob patterns; unqualified tables are in public)")
+	schemaSquashCmd.Flags().StringVar(&schemaRules, "rules", "", "YAML normalization rules file to apply to the replayed schema")
+	schemaSquashCmd.Flags().BoolVar(&schemaIncludeIndexes, "include-indexes", true, "Emit CREATE INDEX statements after the tables")
+	schemaSquashCmd.Flags().BoolVar(&schemaSeparateFKs, "separate-fks", false, "Add every foreign key with ALTER TABLE after the tables instead of inline")
+	schemaSquashCmd.Flags().BoolVar(&schemaStrict, "strict", false, "Fail when a statement is unsupported or cannot be replayed")
+	schemaSquashCmd.Flags().StringVar(&schemaFormat, "format", schema.FormatDDL, "Output format: "+strings.Join(schema.Formats, ", "))
+	schemaSquashCmd.Flags().StringVar(&schemaGoPackage, "go-package", "models", "Package name of the structs written by --format go")
+	schemaSquashCmd.Flags().BoolVar(&schemaBaseline, "baseline", false, "Write a golang-migrate baseline migration pair replacing the migrations")
+	schemaSquashCmd.Flags().StringVar(&schemaBaselineDir, "baseline-dir", "", "Directory for the baseline pair (default: the migrations directory)")
+	schemaSquashCmd.Flags().StringVar(&schemaArchive, "archive", "", "Move the replaced migrations to this directory")
+	schemaSquashCmd.Flags().BoolVar(&schemaDeleteOld, "delete-superseded", false, "Delete the replaced migrations")
+	schemaSquashCmd.Flags().BoolVar(&schemaVersionInsert, "version-insert", false, "End the baseline with the schema_migrations row of the current version")
+	schemaCmd.AddCommand(schemaSquashCmd)
+
+	schemaDiffCmd.Flags().StringVar(&schemaDiffDir, "dir", "", "Write the migration pair to this directory instead of stdout")
+	schemaDiffCmd.Flags().StringVar(&schemaDiffName, "name", "schema_diff", "Name of the migration files written with --dir")
+	schemaDiffCmd.Flags().StringSliceVar(&schemaFilter, "schema-filter", nil, "Only compare tables in these Postgres schemas (glob patterns; unqualified tables are in public)")
+	schemaDiffCmd.Flags().StringVar(&schemaRules, "rules", "", "YAML normalization rules file to apply to both schemas")
+	schemaDiffCmd.Flags().BoolVar(&schemaStrict, "strict", false, "Fail when a statement is unsupported or cannot be replayed")
+	schemaCmd.AddCommand(schemaDiffCmd)
+
+	schemaVerifyCmd.Flags().StringVar(&schemaDSN, "dsn", "", "Postgres connection string of a database to create the scratch databases from (default: DATABASE_URL)")
+	schemaVerifyCmd.Flags().StringVar(&schemaRules, "rules", "", "YAML normalization rules file to apply to the squashed schema")
+	schemaVerifyCmd.Flags().BoolVar(&schemaStrict, "strict", false, "Fail when a statement is unsupported or cannot be replayed")
+	schemaCmd.AddCommand(schemaVerifyCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
+
+// runBaseline replaces the migrations in dir with a baseline pair.
+func runBaseline(cmd *cobra.Command, dir string, squash schema.SquashOptions) error {
+	if schemaOut != "" {
+		return fmt.Errorf("--out cannot be used with --baseline; use --baseline-dir")
+	}
+	if squash.Format != "" && squash.Format != schema.FormatDDL {
+		return fmt.Errorf("--baseline writes DDL; --format %s cannot be used with it", squash.Format)
+	}
+	res, diags, err := schema.Baseline(dir, schema.BaselineOptions{
+		SquashOptions:    squash,
+		OutDir:           schemaBaselineDir,
+		ArchiveDir:       schemaArchive,
+		DeleteSuperseded: schemaDeleteOld,
+		VersionInsert:    schemaVersionInsert,
+	})
+	if err := writeDiagnostics(cmd, diags); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to baseline %s: %w", dir, err)
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Wrote %s\nWrote %s\n", res.UpPath, res.DownPath)
+	verb := "Kept"
+	switch {
+	case schemaDeleteOld:
+		verb = "Deleted"
+	case schemaArchive != "":
+		verb = "Archived"
+	}
+	fmt.Fprintf(out, "%s %d migration files up to version %d\n", verb, len(res.Superseded), res.Version)
+	return nil
+}
+
+// loadSchemaRules loads the --rules file, if one is given.
+func loadSchemaRules() (*schema.Rules, error) {
+	if schemaRules == "" {
+		return nil, nil
+	}
+	return schema.LoadRules(schemaRules)
+}
+
+// writeDiagnostics reports skipped statements on stderr.
+func writeDiagnostics(cmd *cobra.Command, diags schema.Diagnostics) error {
+	if len(diags) == 0 {
+		return nil
+	}
+	return diags.WriteReport(cmd.ErrOrStderr())
+}
+
+// writeOutput writes data to path, or to the command's stdout when path is empty.
+func writeOutput(cmd *cobra.Command, path, data string) error {
+	if path == "" {
+		_, err := fmt.Fprint(cmd.OutOrStdout(), data)
+		return err
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !cgo
+
+// Builds without cgo, like the prebuilt release binaries, cannot parse SQL
+// with pg_query; the schema command says how to get a build that can.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:                "schema",
+	Short:              "Work with Postgres schemas built from migration files (needs a cgo build)",
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("this gallium binary was built without cgo, which the schema commands need to parse SQL; " +
+			"install a build that has them with a C toolchain: CGO_ENABLED=1 go install shireesh.com/gallium@latest")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Build metadata is dropped since it
+// does not take part in ordering.
+type semver struct {
+	major, minor, patch int
+	pre                 []string
+}
+
+// parseSemver parses vMAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]; the leading v is optional.
+func parseSemver(version string) (semver, bool) {
+	v := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+
+	var pre string
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+		if pre == "" {
+			return semver{}, false
+		}
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, ok := parseNumericIdent(part)
+		if !ok {
+			return semver{}, false
+		}
+		nums[i] = n
+	}
+
+	s := semver{major: nums[0], minor: nums[1], patch: nums[2]}
+	if pre != "" {
+		s.pre = strings.Split(pre, ".")
+		for _, ident := range s.pre {
+			if ident == "" {
+				return semver{}, false
+			}
+		}
+	}
+	return s, true
+}
+
+func parseNumericIdent(s string) (int, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// compareSemver returns -1, 0 or 1 as a orders before, equal to or after b.
+func compareSemver(a, b semver) int {
+	for _, d := range [][2]int{{a.major, b.major}, {a.minor, b.minor}, {a.patch, b.patch}} {
+		if d[0] != d[1] {
+			return compareInt(d[0], d[1])
+		}
+	}
+
+	// a version without a pre-release has higher precedence than one with it
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		if c := comparePreIdent(a.pre[i], b.pre[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a.pre), len(b.pre))
+}
+
+func comparePreIdent(a, b string) int {
+	an, aNum := parseNumericIdent(a)
+	bn, bNum := parseNumericIdent(b)
+	switch {
+	case aNum && bNum:
+		return compareInt(an, bn)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareVersions compares two version strings. ok is false when either is not
+// a semantic version, as with "dev" builds.
+func compareVersions(a, b string) (cmp int, ok bool) {
+	av, aok := parseSemver(a)
+	bv, bok := parseSemver(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return compareSemver(av, bv), true
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"shireesh.com/gallium/internal/generator"
+)
+
+var (
+	templateInitDir    string
+	templateTestUpdate bool
+	templateGoldenDir  string
+)
+
+// defaultGoldenDir holds the goldens of templates that have a directory in
+// it when --golden-dir is not given.
+var defaultGoldenDir = filepath.Join("testdata", "golden")
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Create and check gallium templates",
+}
+
+var templateInitCmd = &cobra.Command{
+	Use:   "init <name>",
+	Short: "Create a new template skeleton with metadata and hooks",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := generator.InitTemplate(templateInitDir, args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Created template %s\n", filepath.Join(templateInitDir, args[0]))
+		return nil
+	},
+}
+
+var templateLintCmd = &cobra.Command{
+	Use:   "lint <dir>...",
+	Short: "Check templates for syntax errors, undeclared variables and non-POSIX hooks",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		failed := false
+		for _, dir := range args {
+			templates, name, err := templateDirFS(dir)
+			if err != nil {
+				return err
+			}
+			issues, err := generator.Lint(templates, name)
+			if err != nil {
+				return fmt.Errorf("failed to lint %s: %w", dir, err)
+			}
+			for _, issue := range issues {
+				issue.File = filepath.Join(dir, issue.File)
+				fmt.Fprintln(cmd.OutOrStdout(), issue)
+			}
+			if generator.HasErrors(issues) {
+				failed = true
+			}
+		}
+		if failed {
+			return fmt.Errorf("lint found errors")
+		}
+		return nil
+	},
+}
+
+var templateTestCmd = &cobra.Command{
+	Use:   "test <dir>...",
+	Short: "Render templates in memory and check them against .template/tests cases",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		failed := 0
+		for _, dir := range args {
+			templates, name, err := templateDirFS(dir)
+			if err != nil {
+				return err
+			}
+			opts := generator.TestOptions{GoldenDir: templateGoldenDir}
+			if opts.GoldenDir == "" {
+				// templates kept in a repo like this one have their goldens in testdata/golden
+				if info, err := os.Stat(filepath.Join(defaultGoldenDir, name)); err == nil && info.IsDir() {
+					opts.GoldenDir = defaultGoldenDir
+				}
+			}
+			if templateTestUpdate {
+				opts.UpdateDir = dir
+			}
+			results, err := generator.RunTemplateTests(templates, name, opts)
+			if err != nil {
+				return fmt.Errorf("failed to test %s: %w", dir, err)
+			}
+			if len(results) == 0 {
+				fmt.Fprintf(out, "?    %s [no test cases]\n", name)
+				continue
+			}
+			for _, result := range results {
+				switch {
+				case len(result.Failures) > 0:
+					failed++
+					fmt.Fprintf(out, "FAIL %s/%s\n", name, result.Name)
+					for _, failure := range result.Failures {
+						fmt.Fprintf(out, "    %s\n", failure)
+					}
+				case result.Updated:
+					fmt.Fprintf(out, "ok   %s/%s (golden updated)\n", name, result.Name)
+				default:
+					fmt.Fprintf(out, "ok   %s/%s\n", name, result.Name)
+				}
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d template test case(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	templateInitCmd.Flags().StringVar(&templateInitDir, "dir", ".", "Directory to create the template in")
+	templateCmd.AddCommand(templateInitCmd)
+	templateCmd.AddCommand(templateLintCmd)
+	templateTestCmd.Flags().BoolVar(&templateTestUpdate, "update", false, "Rewrite golden directories from the rendered output")
+	templateTestCmd.Flags().StringVar(&templateGoldenDir, "golden-dir", "", "Directory holding golden directories under each template's name instead of .template/tests (default testdata/golden for the templates it has)")
+	templateCmd.AddCommand(templateTestCmd)
+	rootCmd.AddCommand(templateCmd)
+}
+
+// templateDirFS opens a template directory on disk the same way embedded
+// templates are laid out: a file system holding the template by name.
+func templateDirFS(dir string) (fs.FS, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, "", err
+	}
+	if !info.IsDir() {
+		return nil, "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return os.DirFS(filepath.Dir(abs)), filepath.Base(abs), nil
+}
@@ -2,61 +2,72 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
-	"runtime/debug"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
-const (
-	releaseOwner = "gshireesh"
-	releaseRepo  = "gallium"
+var (
+	updateCheck    bool
+	updateVersion  string
+	updateRollback bool
+	updateProxy    string
+	updateSource   releaseSource
 )
 
-var Version = "dev"
-
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print the installed gallium version",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Fprintln(cmd.OutOrStdout(), currentVersion())
-	},
-}
-
 var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Download and install the latest gallium release",
+	Long: `Download and install the latest gallium release, or the release given by --version.
+Nothing is downloaded when the installed version is already the requested one.
+A new binary must run "gallium version" before it replaces the current one, and
+the replaced binary is kept next to it as gallium.prev; --rollback restores it.
+
+Releases come from GitHub by default. --repo, --base-url and --api-url (or the
+GALLIUM_RELEASE_REPO, GALLIUM_RELEASE_BASE_URL and GALLIUM_RELEASE_API_URL
+environment variables) point gallium at a fork or a GitHub-compatible host.
+
+--mirror (GALLIUM_RELEASE_MIRROR) takes releases from an artifact mirror, a
+local directory or a file:// URL laid out as
+
+  <mirror>/latest                    tag of the latest stable release
+  <mirror>/latest-prerelease         tag of the latest release, prereleases included
+  <mirror>/<tag>/checksums.txt       and checksums.txt.minisig when signed
+  <mirror>/<tag>/gallium_<os>_<arch>
+
+--channel (GALLIUM_UPDATE_CHANNEL) selects "stable" releases or also
+"prerelease" ones. Requests go through HTTP_PROXY/HTTPS_PROXY (honouring
+NO_PROXY) unless --proxy names a proxy explicitly.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return updateBinary(cmd.OutOrStdout())
 	},
 }
 
 func init() {
-	rootCmd.AddCommand(versionCmd)
-	rootCmd.AddCommand(updateCmd)
-}
-
-func currentVersion() string {
-	if Version != "" && Version != "dev" {
-		return Version
-	}
-
-	buildInfo, ok := debug.ReadBuildInfo()
-	if !ok {
-		return "dev"
-	}
-	if buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
-		return buildInfo.Main.Version
-	}
+	defaults := releaseSourceFromEnv()
+	updateCmd.Flags().BoolVar(&updateCheck, "check", false, "Report whether a newer release is available without installing it")
+	updateCmd.Flags().StringVar(&updateVersion, "version", "", "Install a specific release tag (for example v1.2.3)")
+	updateCmd.Flags().StringVar(&updateSource.Repo, "repo", defaults.Repo, "GitHub repository (owner/name) to take releases from")
+	updateCmd.Flags().StringVar(&updateSource.BaseURL, "base-url", defaults.BaseURL, "Base URL release assets are downloaded from")
+	updateCmd.Flags().StringVar(&updateSource.APIURL, "api-url", defaults.APIURL, "Base URL of the GitHub API used to find the latest release")
+	updateCmd.Flags().StringVar(&updateSource.Mirror, "mirror", defaults.Mirror, "Release mirror URL, file:// URL or local directory to use instead of GitHub")
+	updateCmd.Flags().StringVar(&updateSource.Channel, "channel", defaults.Channel, `Release channel: "stable" or "prerelease"`)
+	updateCmd.Flags().StringVar(&updateProxy, "proxy", "", "Proxy URL for release downloads (default from HTTPS_PROXY/HTTP_PROXY)")
+	updateCmd.Flags().BoolVar(&updateRollback, "rollback", false, "Restore the gallium binary replaced by the last update")
+	updateCmd.MarkFlagsMutuallyExclusive("check", "version", "rollback")
 
-	return "dev"
+	rootCmd.AddCommand(updateCmd)
 }
 
 func releaseAssetName(goos, goarch string) (string, error) {
@@ -81,7 +92,7 @@ func latestReleaseAssetURL(goos, goarch string) (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("https://github.com/%s/%s/releases/latest/download/%s", releaseOwner, releaseRepo, assetName), nil
+	return defaultReleaseSource.downloadURL("") + "/" + assetName, nil
 }
 
 func executablePath() (string, error) {
@@ -104,40 +115,171 @@ func updateBinary(out io.Writer) error {
 		return fmt.Errorf("failed to locate current executable: %w", err)
 	}
 
-	assetURL, err := latestReleaseAssetURL(runtime.GOOS, runtime.GOARCH)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	if updateRollback {
+		if err := rollbackExecutable(ctx, currentExecutable); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rolled back gallium at %s to the previous binary\n", currentExecutable)
+		return nil
+	}
+
+	assetName, err := releaseAssetName(runtime.GOOS, runtime.GOARCH)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+	if err := updateSource.validate(); err != nil {
+		return err
+	}
+	client, err := newReleaseClient(updateProxy, 2*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	return runUpdate(ctx, client, updateOptions{
+		Source:    updateSource,
+		Target:    currentExecutable,
+		AssetName: assetName,
+		Current:   currentVersion(),
+		PublicKey: UpdatePublicKey,
+		Check:     updateCheck,
+		Version:   updateVersion,
+	}, out)
+}
+
+// updateOptions describes one update run.
+type updateOptions struct {
+	Source    releaseSource
+	Target    string // executable to replace
+	AssetName string
+	Current   string // installed version
+	PublicKey string
+	Check     bool   // only report whether an update is available
+	Version   string // release tag to install; empty for the latest
+}
+
+func runUpdate(ctx context.Context, client *http.Client, opts updateOptions, out io.Writer) error {
+	tag := opts.Version
+	if tag != "" {
+		if _, ok := parseSemver(tag); !ok {
+			return fmt.Errorf("invalid version %q: want a release tag such as v1.2.3", tag)
+		}
+		if !strings.HasPrefix(tag, "v") {
+			tag = "v" + tag
+		}
+	} else {
+		latest, err := opts.Source.latestTag(ctx, client)
+		if err != nil {
+			return err
+		}
+		tag = latest
+	}
+
+	cmp, comparable := compareVersions(opts.Current, tag)
+	if opts.Check {
+		switch {
+		case !comparable:
+			fmt.Fprintf(out, "Latest release is %s; installed version %s cannot be compared\n", tag, opts.Current)
+		case cmp < 0:
+			fmt.Fprintf(out, "Update available: %s -> %s\nRun `gallium update` to install it.\n", opts.Current, tag)
+		default:
+			fmt.Fprintf(out, "gallium %s is up to date (latest release is %s)\n", opts.Current, tag)
+		}
+		return nil
+	}
+	if comparable && cmp == 0 {
+		fmt.Fprintf(out, "gallium %s is already installed\n", opts.Current)
+		return nil
+	}
+	// only an explicit --version downgrades
+	if comparable && cmp > 0 && opts.Version == "" {
+		fmt.Fprintf(out, "gallium %s is newer than the latest release %s; use --version %s to downgrade\n", opts.Current, tag, tag)
+		return nil
+	}
+
+	binary, err := downloadVerifiedAsset(ctx, client, opts.Source.downloadURL(tag), opts.AssetName, opts.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceExecutable(ctx, opts.Target, binary); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Updated gallium at %s to %s\n", opts.Target, tag)
+	return nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+// fetchURL downloads url and returns the response body.
+func fetchURL(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to prepare update download: %w", err)
+		return nil, err
 	}
 	req.Header.Set("User-Agent", "gallium/"+currentVersion())
 
-	client := &http.Client{Timeout: 2 * time.Minute}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to download latest release: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download latest release: %s", resp.Status)
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
 	}
+	return io.ReadAll(resp.Body)
+}
 
-	tempFile, err := os.CreateTemp(filepath.Dir(currentExecutable), ".gallium-update-*")
+// downloadVerifiedAsset downloads assetName from baseURL and checks it against the
+// release checksums.txt. When publicKey is set, checksums.txt must also carry a
+// valid minisign signature (checksums.txt.minisig) from that key.
+func downloadVerifiedAsset(ctx context.Context, client *http.Client, baseURL, assetName, publicKey string) ([]byte, error) {
+	checksums, err := fetchURL(ctx, client, baseURL+"/"+checksumsAssetName)
 	if err != nil {
-		return fmt.Errorf("failed to create temporary file in %s: %w", filepath.Dir(currentExecutable), err)
+		return nil, fmt.Errorf("failed to download release checksums: %w", err)
+	}
+
+	if publicKey != "" {
+		signature, err := fetchURL(ctx, client, baseURL+"/"+checksumsAssetName+signatureSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download release signature: %w", err)
+		}
+		if err := verifyMinisign(publicKey, checksums, signature); err != nil {
+			return nil, fmt.Errorf("failed to verify %s: %w", checksumsAssetName, err)
+		}
+	}
+
+	binary, err := fetchURL(ctx, client, baseURL+"/"+assetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download release: %w", err)
+	}
+	if err := verifyChecksum(binary, checksums, assetName); err != nil {
+		return nil, fmt.Errorf("refusing to install downloaded release: %w", err)
+	}
+	return binary, nil
+}
+
+// previousExecutablePath is where the executable replaced by an update is kept.
+func previousExecutablePath(target string) string {
+	return target + ".prev"
+}
+
+// replaceExecutable swaps target for a new executable holding binary. The new
+// binary must run "version" successfully before it is installed, and the old
+// executable is kept at previousExecutablePath(target) for --rollback.
+func replaceExecutable(ctx context.Context, target string, binary []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(target), ".gallium-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %w", filepath.Dir(target), err)
 	}
 
 	tempPath := tempFile.Name()
 	defer os.Remove(tempPath)
 
-	if _, err := io.Copy(tempFile, resp.Body); err != nil {
+	if _, err := tempFile.Write(binary); err != nil {
 		tempFile.Close()
 		return fmt.Errorf("failed to write downloaded release: %w", err)
 	}
@@ -150,13 +292,98 @@ func updateBinary(out io.Writer) error {
 		return fmt.Errorf("failed to mark downloaded release executable: %w", err)
 	}
 
-	if err := os.Rename(tempPath, currentExecutable); err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "permission") {
-			return fmt.Errorf("failed to replace %s: %w; rerun with permissions for that directory", currentExecutable, err)
+	if err := smokeTestExecutable(ctx, tempPath); err != nil {
+		return fmt.Errorf("refusing to install downloaded release: %w", err)
+	}
+
+	if err := preserveExecutable(target, previousExecutablePath(target)); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", target, err)
+	}
+
+	return renameExecutable(tempPath, target)
+}
+
+// rollbackExecutable reinstates the executable kept by the last update. The
+// executable it replaces becomes the new backup, so a rollback can be undone
+// by rolling back again.
+func rollbackExecutable(ctx context.Context, target string) error {
+	previous := previousExecutablePath(target)
+	if _, err := os.Stat(previous); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no previous gallium binary at %s to roll back to", previous)
 		}
-		return fmt.Errorf("failed to replace %s: %w", currentExecutable, err)
+		return err
+	}
+	if err := smokeTestExecutable(ctx, previous); err != nil {
+		return fmt.Errorf("refusing to roll back: %w", err)
 	}
 
-	fmt.Fprintf(out, "Updated gallium at %s\n", currentExecutable)
+	current, err := os.CreateTemp(filepath.Dir(target), ".gallium-rollback-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file in %s: %w", filepath.Dir(target), err)
+	}
+	current.Close()
+	currentPath := current.Name()
+	defer os.Remove(currentPath)
+
+	if err := preserveExecutable(target, currentPath); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", target, err)
+	}
+	if err := renameExecutable(previous, target); err != nil {
+		return err
+	}
+	return os.Rename(currentPath, previous)
+}
+
+// smokeTestExecutable checks that the binary at path starts and runs "version".
+func smokeTestExecutable(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "version").CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(output))
+		if msg == "" {
+			return fmt.Errorf("%s version failed: %w", filepath.Base(path), err)
+		}
+		return fmt.Errorf("%s version failed: %w: %s", filepath.Base(path), err, msg)
+	}
+	return nil
+}
+
+// preserveExecutable makes dst a copy of src, replacing any existing dst. It
+// hard links when it can so src stays in place for an atomic rename over it.
+func preserveExecutable(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func renameExecutable(src, target string) error {
+	if err := os.Rename(src, target); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "permission") {
+			return fmt.Errorf("failed to replace %s: %w; rerun with permissions for that directory", target, err)
+		}
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
 	return nil
 }
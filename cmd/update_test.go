@@ -1,6 +1,22 @@
 package cmd
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
 
 func TestReleaseAssetName(t *testing.T) {
 	t.Parallel()
@@ -55,3 +71,562 @@ func TestLatestReleaseAssetURL(t *testing.T) {
 		t.Fatalf("latestReleaseAssetURL = %q, want %q", got, want)
 	}
 }
+
+// minisignKeyPair returns a minisign public key line and a signer producing .minisig files.
+func minisignKeyPair(t *testing.T) (string, func(message []byte) []byte) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey error = %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	publicKey := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...))
+
+	sign := func(message []byte) []byte {
+		digest := blake2b.Sum512(message)
+		sig := ed25519.Sign(priv, digest[:])
+		trusted := "timestamp:0\tfile:checksums.txt"
+		global := ed25519.Sign(priv, append(append([]byte(nil), sig...), trusted...))
+		return []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), sig...)),
+			trusted,
+			base64.StdEncoding.EncodeToString(global)))
+	}
+	return publicKey, sign
+}
+
+// releaseServer serves the given release assets the way GitHub's latest/download URLs do.
+func releaseServer(t *testing.T, assets map[string][]byte) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := assets[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadVerifiedAsset(t *testing.T) {
+	t.Parallel()
+
+	binary := []byte("new gallium binary")
+	sum := sha256.Sum256(binary)
+	checksums := []byte(fmt.Sprintf("%x  gallium_linux_amd64\n%x  gallium_darwin_arm64\n", sum, sha256.Sum256([]byte("other"))))
+	publicKey, sign := minisignKeyPair(t)
+	_, signOther := minisignKeyPair(t)
+
+	tests := []struct {
+		name      string
+		assets    map[string][]byte
+		publicKey string
+		wantErr   string
+	}{
+		{
+			name:   "checksum only",
+			assets: map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": checksums},
+		},
+		{
+			name:      "signed checksums",
+			assets:    map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": checksums, "checksums.txt.minisig": sign(checksums)},
+			publicKey: publicKey,
+		},
+		{
+			name:    "tampered binary",
+			assets:  map[string][]byte{"gallium_linux_amd64": []byte("evil"), "checksums.txt": checksums},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name:    "missing checksums",
+			assets:  map[string][]byte{"gallium_linux_amd64": binary},
+			wantErr: "failed to download release checksums",
+		},
+		{
+			name:    "asset not listed",
+			assets:  map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": []byte("abc  gallium_darwin_arm64\n")},
+			wantErr: "no entry for gallium_linux_amd64",
+		},
+		{
+			name:      "missing signature",
+			assets:    map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": checksums},
+			publicKey: publicKey,
+			wantErr:   "failed to download release signature",
+		},
+		{
+			name:      "signature from another key",
+			assets:    map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": checksums, "checksums.txt.minisig": signOther(checksums)},
+			publicKey: publicKey,
+			wantErr:   "signature verification failed",
+		},
+		{
+			name:      "tampered checksums",
+			assets:    map[string][]byte{"gallium_linux_amd64": binary, "checksums.txt": append([]byte("x"), checksums...), "checksums.txt.minisig": sign(checksums)},
+			publicKey: publicKey,
+			wantErr:   "signature verification failed",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := releaseServer(t, tc.assets)
+			got, err := downloadVerifiedAsset(context.Background(), server.Client(), server.URL+"/download", "gallium_linux_amd64", tc.publicKey)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("downloadVerifiedAsset error = %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("downloadVerifiedAsset error = %v", err)
+			}
+			if string(got) != string(binary) {
+				t.Fatalf("downloadVerifiedAsset = %q, want %q", got, binary)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOK bool
+	}{
+		{a: "v1.2.3", b: "v1.2.3", want: 0, wantOK: true},
+		{a: "1.2.3", b: "v1.2.3", want: 0, wantOK: true},
+		{a: "v1.2.3", b: "v1.10.0", want: -1, wantOK: true},
+		{a: "v2.0.0", b: "v1.99.99", want: 1, wantOK: true},
+		{a: "v1.0.0-rc.1", b: "v1.0.0", want: -1, wantOK: true},
+		{a: "v1.0.0-alpha", b: "v1.0.0-alpha.1", want: -1, wantOK: true},
+		{a: "v1.0.0-alpha.2", b: "v1.0.0-alpha.10", want: -1, wantOK: true},
+		{a: "v1.0.0-alpha.beta", b: "v1.0.0-alpha.1", want: 1, wantOK: true},
+		{a: "v1.0.0+build.5", b: "v1.0.0", want: 0, wantOK: true},
+		{a: "v0.3.1-0.20260101120000-abcdef123456+dirty", b: "v0.3.1", want: -1, wantOK: true},
+		{a: "dev", b: "v1.0.0"},
+		{a: "v1.2", b: "v1.0.0"},
+		{a: "v01.2.3", b: "v1.0.0"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := compareVersions(tc.a, tc.b)
+			if ok != tc.wantOK || got != tc.want {
+				t.Fatalf("compareVersions(%q, %q) = %d, %v, want %d, %v", tc.a, tc.b, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
+
+// taggedReleaseServer serves a GitHub-style releases API reporting latest as the
+// latest tag, with assets available under /<repo>/releases/download/<tag>/.
+func taggedReleaseServer(t *testing.T, repo, latest string, assets map[string]map[string][]byte) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/"+repo+"/releases/latest" {
+			fmt.Fprintf(w, `{"tag_name": %q}`, latest)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, "/"+repo+"/releases/download/")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		tag, name, _ := strings.Cut(rest, "/")
+		data, ok := assets[tag][name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunUpdate(t *testing.T) {
+	t.Parallel()
+
+	release := func(binary string) map[string][]byte {
+		sum := sha256.Sum256([]byte(binary))
+		return map[string][]byte{
+			"gallium_linux_amd64": []byte(binary),
+			"checksums.txt":       []byte(fmt.Sprintf("%x  gallium_linux_amd64\n", sum)),
+		}
+	}
+	const (
+		oldBinary    = "#!/bin/sh\necho v1.0.0\n"
+		latestBinary = "#!/bin/sh\necho v1.1.0\n"
+		brokenBinary = "#!/bin/sh\necho 'exec format error' >&2\nexit 1\n"
+	)
+	assets := map[string]map[string][]byte{
+		"v1.1.0": release(latestBinary),
+		"v1.0.0": release(oldBinary),
+		"v1.2.0": release(brokenBinary),
+	}
+
+	tests := []struct {
+		name       string
+		current    string
+		check      bool
+		version    string
+		wantBinary string
+		wantPrev   bool
+		wantOutput string
+		wantErr    string
+	}{
+		{name: "installs latest", current: "v1.0.0", wantBinary: latestBinary, wantPrev: true, wantOutput: "to v1.1.0"},
+		{name: "installs latest over dev build", current: "dev", wantBinary: latestBinary, wantPrev: true, wantOutput: "to v1.1.0"},
+		{name: "no-op when current", current: "v1.1.0", wantBinary: oldBinary, wantOutput: "already installed"},
+		{name: "check reports update", current: "v1.0.0", check: true, wantBinary: oldBinary, wantOutput: "Update available: v1.0.0 -> v1.1.0"},
+		{name: "no downgrade to latest", current: "v1.2.0", wantBinary: oldBinary, wantOutput: "newer than the latest release v1.1.0"},
+		{name: "check when current", current: "v1.1.0", check: true, wantBinary: oldBinary, wantOutput: "is up to date"},
+		{name: "check when newer", current: "v1.2.0", check: true, wantBinary: oldBinary, wantOutput: "is up to date"},
+		{name: "pinned version", current: "v1.1.0", version: "v1.0.0", wantBinary: oldBinary, wantPrev: true, wantOutput: "to v1.0.0"},
+		{name: "pinned version without v", current: "v1.1.0", version: "1.0.0", wantBinary: oldBinary, wantPrev: true, wantOutput: "to v1.0.0"},
+		{name: "pinned version is current", current: "v1.0.0", version: "v1.0.0", wantBinary: oldBinary, wantOutput: "already installed"},
+		{name: "unknown tag", current: "v1.0.0", version: "v9.9.9", wantBinary: oldBinary, wantErr: "404"},
+		{name: "invalid tag", current: "v1.0.0", version: "latest", wantBinary: oldBinary, wantErr: "invalid version"},
+		{name: "broken release is not installed", current: "v1.0.0", version: "v1.2.0", wantBinary: oldBinary, wantErr: "exec format error"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := taggedReleaseServer(t, "acme/gallium", "v1.1.0", assets)
+			target := filepath.Join(t.TempDir(), "gallium")
+			if err := os.WriteFile(target, []byte(oldBinary), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err := runUpdate(context.Background(), server.Client(), updateOptions{
+				Source:    releaseSource{Repo: "acme/gallium", BaseURL: server.URL, APIURL: server.URL},
+				Target:    target,
+				AssetName: "gallium_linux_amd64",
+				Current:   tc.current,
+				Check:     tc.check,
+				Version:   tc.version,
+			}, &out)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("runUpdate error = %v, want error containing %q", err, tc.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("runUpdate error = %v", err)
+			}
+			if !strings.Contains(out.String(), tc.wantOutput) {
+				t.Fatalf("runUpdate output = %q, want it to contain %q", out.String(), tc.wantOutput)
+			}
+
+			got, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantBinary {
+				t.Fatalf("target holds %q, want %q", got, tc.wantBinary)
+			}
+
+			prev, err := os.ReadFile(previousExecutablePath(target))
+			switch {
+			case !tc.wantPrev && err == nil:
+				t.Fatalf("%s exists, want no backup", previousExecutablePath(target))
+			case tc.wantPrev && err != nil:
+				t.Fatalf("backup not kept: %v", err)
+			case tc.wantPrev && string(prev) != oldBinary:
+				t.Fatalf("backup holds %q, want %q", prev, oldBinary)
+			}
+		})
+	}
+}
+
+func TestRollbackExecutable(t *testing.T) {
+	t.Parallel()
+
+	const (
+		current  = "#!/bin/sh\necho v1.1.0\n"
+		previous = "#!/bin/sh\necho v1.0.0\n"
+	)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "gallium")
+
+	if err := rollbackExecutable(context.Background(), target); err == nil || !strings.Contains(err.Error(), "no previous gallium binary") {
+		t.Fatalf("rollbackExecutable without backup error = %v, want no previous binary error", err)
+	}
+
+	if err := os.WriteFile(target, []byte(current), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(previousExecutablePath(target), []byte(previous), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rollbackExecutable(context.Background(), target); err != nil {
+		t.Fatalf("rollbackExecutable error = %v", err)
+	}
+	for path, want := range map[string]string{target: previous, previousExecutablePath(target): current} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s holds %q after rollback, want %q", filepath.Base(path), got, want)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("rollback left %d files in %s, want 2", len(entries), dir)
+	}
+}
+
+func TestUpdateCheckEnabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		interactive bool
+		want        bool
+	}{
+		{name: "terminal", interactive: true, want: true},
+		{name: "not a terminal", interactive: false, want: false},
+		{name: "opted out", env: map[string]string{"GALLIUM_NO_UPDATE_CHECK": "1"}, interactive: true, want: false},
+		{name: "ci", env: map[string]string{"CI": "true"}, interactive: true, want: false},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			getenv := func(key string) string { return tc.env[key] }
+			if got := updateCheckEnabled(getenv, tc.interactive); got != tc.want {
+				t.Fatalf("updateCheckEnabled(%v, %v) = %v, want %v", tc.env, tc.interactive, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateNotice(t *testing.T) {
+	t.Parallel()
+
+	if got := updateNotice("v1.0.0", "v1.1.0"); !strings.Contains(got, "v1.0.0 -> v1.1.0") {
+		t.Fatalf("updateNotice(v1.0.0, v1.1.0) = %q, want a notice", got)
+	}
+	for _, tc := range [][2]string{{"v1.1.0", "v1.1.0"}, {"v1.2.0", "v1.1.0"}, {"dev", "v1.1.0"}, {"v1.0.0", ""}} {
+		if got := updateNotice(tc[0], tc[1]); got != "" {
+			t.Fatalf("updateNotice(%q, %q) = %q, want no notice", tc[0], tc[1], got)
+		}
+	}
+}
+
+func TestCachedLatestRelease(t *testing.T) {
+	t.Parallel()
+
+	var requests int
+	latest := "v1.1.0"
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"tag_name": %q}`, latest)
+	}))
+	t.Cleanup(server.Close)
+
+	source := releaseSource{Repo: "acme/gallium", APIURL: server.URL}
+	cachePath := filepath.Join(t.TempDir(), "gallium", "update-check.json")
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	check := func(source releaseSource, now time.Time, want string, wantRequests int) {
+		t.Helper()
+		got, _ := cachedLatestRelease(context.Background(), server.Client(), source, cachePath, now)
+		if got != want {
+			t.Fatalf("cachedLatestRelease at %s = %q, want %q", now, got, want)
+		}
+		if requests != wantRequests {
+			t.Fatalf("cachedLatestRelease at %s made %d requests in total, want %d", now, requests, wantRequests)
+		}
+	}
+
+	check(source, start, "v1.1.0", 1)
+	latest = "v1.2.0"
+	check(source, start.Add(time.Hour), "v1.1.0", 1)
+	check(source, start.Add(25*time.Hour), "v1.2.0", 2)
+
+	other := source
+	other.Repo = "acme/fork"
+	check(other, start.Add(26*time.Hour), "v1.2.0", 3)
+
+	fail = true
+	check(other, start.Add(60*time.Hour), "v1.2.0", 4)
+	check(other, start.Add(61*time.Hour), "v1.2.0", 4)
+}
+
+// writeMirror lays out releases in dir the way --mirror expects.
+func writeMirror(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunUpdateFromMirror(t *testing.T) {
+	t.Parallel()
+
+	const (
+		stableBinary = "#!/bin/sh\necho v1.1.0\n"
+		rcBinary     = "#!/bin/sh\necho v1.2.0-rc.1\n"
+	)
+	mirror := t.TempDir()
+	writeMirror(t, mirror, map[string]string{
+		"latest":                          "v1.1.0\n",
+		"latest-prerelease":               "v1.2.0-rc.1\n",
+		"v1.1.0/gallium_linux_amd64":      stableBinary,
+		"v1.1.0/checksums.txt":            fmt.Sprintf("%x  gallium_linux_amd64\n", sha256.Sum256([]byte(stableBinary))),
+		"v1.2.0-rc.1/gallium_linux_amd64": rcBinary,
+		"v1.2.0-rc.1/checksums.txt":       fmt.Sprintf("%x  gallium_linux_amd64\n", sha256.Sum256([]byte(rcBinary))),
+	})
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name       string
+		mirror     string
+		channel    string
+		wantBinary string
+	}{
+		{name: "directory", mirror: mirror, wantBinary: stableBinary},
+		{name: "file url", mirror: "file://" + filepath.ToSlash(mirror), wantBinary: stableBinary},
+		{name: "http mirror", mirror: server.URL + "/", wantBinary: stableBinary},
+		{name: "prerelease channel", mirror: mirror, channel: "prerelease", wantBinary: rcBinary},
+		{name: "stable channel", mirror: server.URL, channel: "stable", wantBinary: stableBinary},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := newReleaseClient("", time.Minute)
+			if err != nil {
+				t.Fatalf("newReleaseClient error = %v", err)
+			}
+			target := filepath.Join(t.TempDir(), "gallium")
+			if err := os.WriteFile(target, []byte("#!/bin/sh\necho v1.0.0\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			err = runUpdate(context.Background(), client, updateOptions{
+				Source:    releaseSource{Mirror: tc.mirror, Channel: tc.channel},
+				Target:    target,
+				AssetName: "gallium_linux_amd64",
+				Current:   "v1.0.0",
+			}, &out)
+			if err != nil {
+				t.Fatalf("runUpdate error = %v", err)
+			}
+			got, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantBinary {
+				t.Fatalf("target holds %q, want %q", got, tc.wantBinary)
+			}
+		})
+	}
+}
+
+func TestLatestTagPrereleaseChannel(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/gallium/releases/latest":
+			fmt.Fprint(w, `{"tag_name": "v1.1.0"}`)
+		case "/repos/acme/gallium/releases":
+			fmt.Fprint(w, `[
+				{"tag_name": "v1.3.0-beta.1", "draft": true},
+				{"tag_name": "v1.1.0"},
+				{"tag_name": "v1.2.0-rc.2", "prerelease": true},
+				{"tag_name": "nightly", "prerelease": true},
+				{"tag_name": "v1.2.0-rc.1", "prerelease": true}
+			]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	for channel, want := range map[string]string{"": "v1.1.0", "stable": "v1.1.0", "prerelease": "v1.2.0-rc.2"} {
+		source := releaseSource{Repo: "acme/gallium", APIURL: server.URL, Channel: channel}
+		got, err := source.latestTag(context.Background(), server.Client())
+		if err != nil {
+			t.Fatalf("latestTag(channel %q) error = %v", channel, err)
+		}
+		if got != want {
+			t.Fatalf("latestTag(channel %q) = %q, want %q", channel, got, want)
+		}
+	}
+
+	if err := (releaseSource{Channel: "nightly"}).validate(); err == nil {
+		t.Fatal("validate(channel nightly) error = nil, want error")
+	}
+}
+
+func TestNewReleaseClientProxy(t *testing.T) {
+	t.Parallel()
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, "v1.1.0")
+	}))
+	t.Cleanup(proxy.Close)
+
+	client, err := newReleaseClient(proxy.URL, time.Minute)
+	if err != nil {
+		t.Fatalf("newReleaseClient error = %v", err)
+	}
+	source := releaseSource{Mirror: "http://mirror.internal.example/gallium"}
+	got, err := source.latestTag(context.Background(), client)
+	if err != nil {
+		t.Fatalf("latestTag through proxy error = %v", err)
+	}
+	if got != "v1.1.0" || proxied != "http://mirror.internal.example/gallium/latest" {
+		t.Fatalf("latestTag through proxy = %q (proxied %q), want v1.1.0 via http://mirror.internal.example/gallium/latest", got, proxied)
+	}
+
+	if _, err := newReleaseClient("not a url", time.Minute); err == nil {
+		t.Fatal("newReleaseClient(\"not a url\") error = nil, want error")
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// updateCheckInterval is how long a passive release check result is reused.
+const updateCheckInterval = 24 * time.Hour
+
+// updateCheckTimeout bounds how long a command may wait on the passive check.
+const updateCheckTimeout = 2 * time.Second
+
+// updateCheckCache is the on-disk record of the last passive release check.
+type updateCheckCache struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Source    string    `json:"source"`
+	Latest    string    `json:"latest,omitempty"`
+}
+
+// updateCheckEnabled reports whether the passive release check may run. It is
+// off when GALLIUM_NO_UPDATE_CHECK or CI is set and when not attached to a terminal.
+func updateCheckEnabled(getenv func(string) string, interactive bool) bool {
+	if getenv("GALLIUM_NO_UPDATE_CHECK") != "" || getenv("CI") != "" {
+		return false
+	}
+	return interactive
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func updateCheckCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gallium", "update-check.json"), nil
+}
+
+// cachedLatestRelease returns the latest release tag of source, asking it at
+// most once per updateCheckInterval. Failed checks are recorded too, so an
+// offline machine does not retry on every command.
+func cachedLatestRelease(ctx context.Context, client *http.Client, source releaseSource, cachePath string, now time.Time) (string, error) {
+	sourceKey := source.key()
+
+	var cache updateCheckCache
+	if data, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(data, &cache) == nil &&
+		cache.Source == sourceKey && now.Sub(cache.CheckedAt) >= 0 && now.Sub(cache.CheckedAt) < updateCheckInterval {
+		return cache.Latest, nil
+	}
+
+	latest, checkErr := source.latestTag(ctx, client)
+	if checkErr != nil && cache.Source == sourceKey {
+		latest = cache.Latest
+	}
+	cache = updateCheckCache{CheckedAt: now, Source: sourceKey, Latest: latest}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		return "", err
+	}
+	return latest, checkErr
+}
+
+// updateNotice returns the one-line notice shown when latest is newer than current.
+func updateNotice(current, latest string) string {
+	if cmp, ok := compareVersions(current, latest); !ok || cmp >= 0 {
+		return ""
+	}
+	return fmt.Sprintf("A new gallium release is available: %s -> %s (run `gallium update`, set GALLIUM_NO_UPDATE_CHECK=1 to silence)", current, latest)
+}
+
+// skipsUpdateCheck reports whether cmd gains nothing from the passive check.
+func skipsUpdateCheck(cmd *cobra.Command) bool {
+	if cmd == updateCmd || cmd == versionCmd {
+		return true
+	}
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return true
+	}
+	return false
+}
+
+// startUpdateCheck starts the passive release check for the command args
+// selects. The returned function waits for the check and prints any notice to w.
+func startUpdateCheck(args []string) func(w io.Writer) {
+	noop := func(io.Writer) {}
+
+	current := currentVersion()
+	if _, ok := parseSemver(current); !ok || !updateCheckEnabled(os.Getenv, isTerminal(os.Stderr)) {
+		return noop
+	}
+	if cmd, _, err := rootCmd.Find(args); err != nil || skipsUpdateCheck(cmd) {
+		return noop
+	}
+	cachePath, err := updateCheckCachePath()
+	if err != nil {
+		return noop
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+	result := make(chan string, 1)
+	go func() {
+		client, err := newReleaseClient("", updateCheckTimeout)
+		if err != nil {
+			result <- ""
+			return
+		}
+		latest, _ := cachedLatestRelease(ctx, client, releaseSourceFromEnv(), cachePath, time.Now())
+		result <- latest
+	}()
+
+	return func(w io.Writer) {
+		defer cancel()
+		select {
+		case latest := <-result:
+			if notice := updateNotice(current, latest); notice != "" {
+				fmt.Fprintln(w, notice)
+			}
+		case <-ctx.Done():
+		}
+	}
+}
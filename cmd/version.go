@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"shireesh.com/gallium/internal/generator"
+)
+
+// Version, Commit and BuildDate are set at build time with -ldflags "-X ...".
+// Commit and BuildDate fall back to the VCS information Go stamps into the binary.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+var versionOutput string
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the installed gallium version",
+	Long: `Print the installed gallium version.
+
+--output text adds build details, the embedded templates and the module
+dependencies, which is what bug reports should include; --output json prints
+the same as JSON for scripts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		switch versionOutput {
+		case "short":
+			fmt.Fprintln(out, currentVersion())
+			return nil
+		case "text":
+			return writeVersionText(out, collectVersionInfo(Templates))
+		case "json":
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(collectVersionInfo(Templates))
+		}
+		return fmt.Errorf("unknown output format %q: want short, text or json", versionOutput)
+	},
+}
+
+func init() {
+	versionCmd.Flags().StringVarP(&versionOutput, "output", "o", "short", "Output format: short, text or json")
+	rootCmd.AddCommand(versionCmd)
+}
+
+func currentVersion() string {
+	if Version != "" && Version != "dev" {
+		return Version
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	if buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		return buildInfo.Main.Version
+	}
+
+	return "dev"
+}
+
+// versionInfo is the detailed build description printed by `gallium version -o json`.
+type versionInfo struct {
+	Version      string              `json:"version"`
+	Commit       string              `json:"commit,omitempty"`
+	Modified     bool                `json:"modified,omitempty"`
+	BuildDate    string              `json:"build_date,omitempty"`
+	GoVersion    string              `json:"go_version"`
+	OS           string              `json:"os"`
+	Arch         string              `json:"arch"`
+	Templates    []templateVersion   `json:"templates"`
+	Dependencies []dependencyVersion `json:"dependencies"`
+}
+
+type templateVersion struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type dependencyVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// collectVersionInfo describes this binary and the templates embedded in it.
+func collectVersionInfo(templates fs.FS) versionInfo {
+	info := versionInfo{
+		Version:      currentVersion(),
+		Commit:       Commit,
+		BuildDate:    BuildDate,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Templates:    []templateVersion{},
+		Dependencies: []dependencyVersion{},
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+		for _, dep := range buildInfo.Deps {
+			d := dependencyVersion{Path: dep.Path, Version: dep.Version}
+			if dep.Replace != nil {
+				d.Replace = dep.Replace.Path
+				if dep.Replace.Version != "" {
+					d.Replace += "@" + dep.Replace.Version
+				}
+			}
+			info.Dependencies = append(info.Dependencies, d)
+		}
+	}
+
+	if templates != nil {
+		names, _ := listTemplates(templates)
+		for _, name := range names {
+			t := templateVersion{Name: name}
+			if meta, err := generator.LoadMetadata(templates, name); err == nil {
+				t.Version = meta.Version
+			}
+			info.Templates = append(info.Templates, t)
+		}
+	}
+	return info
+}
+
+func writeVersionText(out io.Writer, info versionInfo) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	commit := info.Commit
+	if info.Modified {
+		commit += " (modified)"
+	}
+	fmt.Fprintf(w, "version:\t%s\n", info.Version)
+	fmt.Fprintf(w, "commit:\t%s\n", commit)
+	fmt.Fprintf(w, "built:\t%s\n", info.BuildDate)
+	fmt.Fprintf(w, "go:\t%s\n", info.GoVersion)
+	fmt.Fprintf(w, "platform:\t%s/%s\n", info.OS, info.Arch)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "templates:")
+	for _, t := range info.Templates {
+		fmt.Fprintf(w, "  %s\t%s\n", t.Name, t.Version)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "dependencies:")
+	for _, d := range info.Dependencies {
+		version := d.Version
+		if d.Replace != "" {
+			version += " => " + d.Replace
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", d.Path, version)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCollectVersionInfo(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"alpha/.template/metadata.yaml": {Data: []byte("name: alpha\nversion: 1.2.0\n")},
+		"alpha/README.md":               {Data: []byte("alpha")},
+		"beta/README.md":                {Data: []byte("beta")},
+	}
+
+	info := collectVersionInfo(templates)
+	if info.Version != currentVersion() || info.GoVersion != runtime.Version() || info.OS != runtime.GOOS || info.Arch != runtime.GOARCH {
+		t.Fatalf("collectVersionInfo build details = %+v", info)
+	}
+	want := []templateVersion{{Name: "alpha", Version: "1.2.0"}, {Name: "beta"}}
+	if len(info.Templates) != len(want) {
+		t.Fatalf("collectVersionInfo templates = %+v, want %+v", info.Templates, want)
+	}
+	for i := range want {
+		if info.Templates[i] != want[i] {
+			t.Fatalf("collectVersionInfo templates = %+v, want %+v", info.Templates, want)
+		}
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("json.Marshal error = %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal error = %v", err)
+	}
+	for _, key := range []string{"version", "go_version", "os", "arch", "templates", "dependencies"} {
+		if _, ok := decoded[key]; !ok {
+			t.Fatalf("version JSON %s has no %q key", data, key)
+		}
+	}
+}
+
+func TestWriteVersionText(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	err := writeVersionText(&out, versionInfo{
+		Version:      "v1.2.3",
+		Commit:       "abc123",
+		Modified:     true,
+		GoVersion:    "go1.24.2",
+		OS:           "linux",
+		Arch:         "arm64",
+		Templates:    []templateVersion{{Name: "go-basic", Version: "1.0.0"}},
+		Dependencies: []dependencyVersion{{Path: "example.com/dep", Version: "v0.1.0", Replace: "../dep"}},
+	})
+	if err != nil {
+		t.Fatalf("writeVersionText error = %v", err)
+	}
+	for _, want := range []string{"v1.2.3", "abc123 (modified)", "linux/arm64", "go-basic", "1.0.0", "example.com/dep", "v0.1.0 => ../dep"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("writeVersionText output = %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
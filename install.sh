@@ -2,10 +2,54 @@
 
 set -eu
 
-REPO="gshireesh/gallium"
+REPO="${GALLIUM_RELEASE_REPO:-gshireesh/gallium}"
+BASE_URL="${GALLIUM_RELEASE_BASE_URL:-https://github.com}"
+API_URL="${GALLIUM_RELEASE_API_URL:-https://api.github.com}"
+# MIRROR is an artifact mirror URL, a file:// URL or a local directory laid out
+# as <mirror>/latest, <mirror>/latest-prerelease and <mirror>/<tag>/<asset>.
+MIRROR="${GALLIUM_RELEASE_MIRROR:-}"
+CHANNEL="${GALLIUM_UPDATE_CHANNEL:-stable}"
+VERSION="${GALLIUM_VERSION:-}"
 BINARY_NAME="gallium"
 INSTALL_DIR="${INSTALL_DIR:-/usr/local/bin}"
 
+case "$CHANNEL" in
+	stable|prerelease)
+		:
+		;;
+	*)
+		echo "unknown release channel: $CHANNEL (want stable or prerelease)" >&2
+		exit 1
+		;;
+esac
+
+# curl reads https_proxy/http_proxy itself, but not an upper-case HTTP_PROXY,
+# so pass the proxy on explicitly.
+proxy="${GALLIUM_PROXY:-${HTTPS_PROXY:-${https_proxy:-${HTTP_PROXY:-${http_proxy:-}}}}}"
+
+# fetch copies a release URL, file:// URL or local path to $2 ("-" for stdout).
+fetch() {
+	case "$1" in
+		http://*|https://*)
+			if [ -n "$proxy" ]; then
+				curl -fsSL --proxy "$proxy" "$1" -o "$2"
+			else
+				curl -fsSL "$1" -o "$2"
+			fi
+			;;
+		file://*)
+			fetch "${1#file://}" "$2"
+			;;
+		*)
+			if [ "$2" = "-" ]; then
+				cat "$1"
+			else
+				cp "$1" "$2"
+			fi
+			;;
+	esac
+}
+
 os="$(uname -s | tr '[:upper:]' '[:lower:]')"
 arch="$(uname -m)"
 
@@ -32,7 +76,34 @@ case "$arch" in
 		;;
 esac
 
-download_url="https://github.com/${REPO}/releases/latest/download/${BINARY_NAME}_${os}_${arch}"
+if [ -n "$MIRROR" ]; then
+	MIRROR="${MIRROR%/}"
+	if [ -z "$VERSION" ]; then
+		if [ "$CHANNEL" = "prerelease" ]; then
+			VERSION="$(fetch "$MIRROR/latest-prerelease" - | tr -d '[:space:]')"
+		else
+			VERSION="$(fetch "$MIRROR/latest" - | tr -d '[:space:]')"
+		fi
+	fi
+	download_url="${MIRROR}/${VERSION}/${BINARY_NAME}_${os}_${arch}"
+else
+	if [ -z "$VERSION" ] && [ "$CHANNEL" = "prerelease" ]; then
+		# the API lists the newest releases first; skip drafts
+		VERSION="$(fetch "${API_URL%/}/repos/${REPO}/releases?per_page=20" - |
+			tr ',{' '\n\n' |
+			awk -F'"' '/"tag_name"/ { tag = $4 } /"draft": *true/ { tag = "" } /"draft": *false/ && tag != "" { print tag; exit }')"
+	fi
+	if [ -n "$VERSION" ]; then
+		download_url="${BASE_URL%/}/${REPO}/releases/download/${VERSION}/${BINARY_NAME}_${os}_${arch}"
+	else
+		download_url="${BASE_URL%/}/${REPO}/releases/latest/download/${BINARY_NAME}_${os}_${arch}"
+	fi
+fi
+
+if [ -z "${download_url##*//${BINARY_NAME}_*}" ]; then
+	echo "could not determine the release to install" >&2
+	exit 1
+fi
 tmp_file="$(mktemp)"
 
 cleanup() {
@@ -42,7 +113,7 @@ cleanup() {
 trap cleanup EXIT INT TERM
 
 echo "Downloading ${download_url}"
-curl -fsSL "$download_url" -o "$tmp_file"
+fetch "$download_url" "$tmp_file"
 chmod +x "$tmp_file"
 
 if [ ! -d "$INSTALL_DIR" ]; then
@@ -0,0 +1,211 @@
+package compressor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Archive formats understood by NewArchiveWriter.
+const (
+	FormatTarGz = "tar.gz"
+	FormatZip   = "zip"
+)
+
+// ArchiveWriter adds directories and files to an archive.
+// Names are slash-separated and relative to the archive root.
+type ArchiveWriter interface {
+	AddDir(name string, perm fs.FileMode) error
+	AddFile(name string, data []byte, perm fs.FileMode) error
+	AddSymlink(name, target string) error
+	Close() error
+}
+
+// ArchiveFormat picks the archive format from the extension of archivePath.
+func ArchiveFormat(archivePath string) (string, error) {
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("unsupported archive extension in %q (want .tar.gz, .tgz or .zip)", archivePath)
+}
+
+// TrimArchiveExt returns the base name of archivePath without its archive extension.
+func TrimArchiveExt(archivePath string) string {
+	base := path.Base(strings.ReplaceAll(archivePath, "\\", "/"))
+	lower := strings.ToLower(base)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+// NewArchiveWriter returns an ArchiveWriter that streams the given format to w.
+// Closing the returned writer does not close w.
+func NewArchiveWriter(w io.Writer, format string) (ArchiveWriter, error) {
+	switch format {
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz), dirs: map[string]bool{}}, nil
+	case FormatZip:
+		return &zipWriter{zw: zip.NewWriter(w), dirs: map[string]bool{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %s", format)
+}
+
+// CreateArchive creates archivePath (and its parent directory) and returns a writer for it.
+// The format is chosen from the file extension.
+func CreateArchive(archivePath string) (ArchiveWriter, error) {
+	format, err := ArchiveFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureFileDirExists(archivePath); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	aw, err := NewArchiveWriter(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileArchiveWriter{ArchiveWriter: aw, file: file}, nil
+}
+
+type fileArchiveWriter struct {
+	ArchiveWriter
+	file *os.File
+}
+
+func (w *fileArchiveWriter) Close() error {
+	archiveErr := w.ArchiveWriter.Close()
+	fileErr := w.file.Close()
+	if archiveErr != nil {
+		return archiveErr
+	}
+	return fileErr
+}
+
+type tarGzWriter struct {
+	gz   *gzip.Writer
+	tw   *tar.Writer
+	dirs map[string]bool
+}
+
+func (w *tarGzWriter) AddDir(name string, perm fs.FileMode) error {
+	name = strings.Trim(name, "/")
+	if name == "" || name == "." || w.dirs[name] {
+		return nil
+	}
+	w.dirs[name] = true
+	return w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     int64(perm.Perm()),
+		ModTime:  time.Now(),
+	})
+}
+
+func (w *tarGzWriter) AddFile(name string, data []byte, perm fs.FileMode) error {
+	if err := w.AddDir(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	if err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(perm.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+func (w *tarGzWriter) AddSymlink(name, target string) error {
+	if err := w.AddDir(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	return w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  time.Now(),
+	})
+}
+
+func (w *tarGzWriter) Close() error {
+	tarErr := w.tw.Close()
+	gzErr := w.gz.Close()
+	if tarErr != nil {
+		return tarErr
+	}
+	return gzErr
+}
+
+type zipWriter struct {
+	zw   *zip.Writer
+	dirs map[string]bool
+}
+
+func (w *zipWriter) AddDir(name string, perm fs.FileMode) error {
+	name = strings.Trim(name, "/")
+	if name == "" || name == "." || w.dirs[name] {
+		return nil
+	}
+	w.dirs[name] = true
+	header := &zip.FileHeader{Name: name + "/", Modified: time.Now()}
+	header.SetMode(fs.ModeDir | perm.Perm())
+	_, err := w.zw.CreateHeader(header)
+	return err
+}
+
+func (w *zipWriter) AddFile(name string, data []byte, perm fs.FileMode) error {
+	if err := w.AddDir(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+	header.SetMode(perm.Perm())
+	f, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// AddSymlink stores the link the way Info-ZIP does: a symlink mode with the target as the entry body.
+func (w *zipWriter) AddSymlink(name, target string) error {
+	if err := w.AddDir(path.Dir(name), 0755); err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name, Modified: time.Now()}
+	header.SetMode(fs.ModeSymlink | 0777)
+	f, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, target)
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
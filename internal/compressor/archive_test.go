@@ -0,0 +1,117 @@
+package compressor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestArchiveWriterPreservesModes(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{FormatTarGz, FormatZip} {
+		format := format
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			aw, err := NewArchiveWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("NewArchiveWriter(%q) error = %v", format, err)
+			}
+			if err := aw.AddFile("demo/infra/entrypoint.sh", []byte("#!/bin/sh\n"), 0755); err != nil {
+				t.Fatalf("AddFile error = %v", err)
+			}
+			if err := aw.AddFile("demo/README.md", []byte("# demo\n"), 0644); err != nil {
+				t.Fatalf("AddFile error = %v", err)
+			}
+			if err := aw.Close(); err != nil {
+				t.Fatalf("Close error = %v", err)
+			}
+
+			got := readArchiveModes(t, format, buf.Bytes())
+			want := map[string]fs.FileMode{
+				"demo/":                    fs.ModeDir | 0755,
+				"demo/infra/":              fs.ModeDir | 0755,
+				"demo/infra/entrypoint.sh": 0755,
+				"demo/README.md":           0644,
+			}
+			if len(got) != len(want) {
+				t.Fatalf("archive entries = %v, want %v", got, want)
+			}
+			for name, mode := range want {
+				if got[name] != mode {
+					t.Fatalf("mode of %s = %v, want %v", name, got[name], mode)
+				}
+			}
+		})
+	}
+}
+
+func readArchiveModes(t *testing.T, format string, data []byte) map[string]fs.FileMode {
+	t.Helper()
+
+	modes := map[string]fs.FileMode{}
+	switch format {
+	case FormatTarGz:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("gzip.NewReader error = %v", err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("tar Next error = %v", err)
+			}
+			modes[hdr.Name] = hdr.FileInfo().Mode() & (fs.ModeDir | fs.ModePerm)
+		}
+	case FormatZip:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("zip.NewReader error = %v", err)
+		}
+		for _, f := range zr.File {
+			modes[f.Name] = f.Mode() & (fs.ModeDir | fs.ModePerm)
+		}
+	}
+	return modes
+}
+
+func TestArchiveFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "project.tar.gz", want: FormatTarGz},
+		{path: "dist/Project.TGZ", want: FormatTarGz},
+		{path: "project.zip", want: FormatZip},
+		{path: "project.tar", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		got, err := ArchiveFormat(tc.path)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("ArchiveFormat(%q) error = nil, want error", tc.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ArchiveFormat(%q) error = %v", tc.path, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ArchiveFormat(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -1,74 +1,132 @@
 package generator
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"strings"
 	"text/template"
 
-	"gopkg.in/yaml.v3"
+	"shireesh.com/gallium/internal/compressor"
 )
 
-// GetVarsFromMetadata reads a metadata YAML file and returns a map of variables under the "data" key.
-func GetVarsFromMetadata(metadataPath string) (map[string]string, error) {
-	file, err := os.ReadFile(metadataPath)
+// GetVarsFromMetadata reads a metadata YAML file from fsys and returns a map of variables under the "data" key.
+func GetVarsFromMetadata(fsys fs.FS, metadataPath string) (map[string]string, error) {
+	meta, err := ReadMetadata(fsys, metadataPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+		return nil, err
 	}
-
-	var meta struct {
-		Data map[string]string `yaml:"data"`
-	}
-	if err := yaml.Unmarshal(file, &meta); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
-	}
-
 	return meta.Data, nil
 }
 
-func Generate(templateName, projectName, baseTemplateDir string, vars map[string]string) error {
-	src := filepath.Join(baseTemplateDir, templateName)
+// Generate renders the template directory templateName from templates into projectName.
+// Template files are read straight from templates; only hook scripts are written to disk.
+func Generate(templates fs.FS, templateName, projectName string, vars map[string]string, opts Options) error {
+	src := templateName
 	dst := filepath.Clean(projectName)
 
 	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
 		return err
 	}
 
-	if err := runHook(src, "pre.sh", dst); err != nil {
+	if err := runHook(templates, src, "pre.sh", dst); err != nil {
+		return err
+	}
+
+	if err := Render(templates, src, DirOutput{Root: dst}, vars, opts); err != nil {
 		return err
 	}
 
-	metadataPath := filepath.Join(src, ".template", "metadata.yaml")
-	if _, err := os.Stat(metadataPath); err == nil {
-		metadataVars, err := GetVarsFromMetadata(metadataPath)
+	return runHook(templates, src, "post.sh", dst)
+}
+
+// GenerateArchive renders templateName into a .tar.gz or .zip archive at archivePath.
+// Entries are nested below a projectName directory; hooks are not run
+// because there is no project directory for them to work in.
+func GenerateArchive(templates fs.FS, templateName, projectName, archivePath string, vars map[string]string, opts Options) error {
+	archive, err := compressor.CreateArchive(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	out := prefixOutput{prefix: projectName, out: archive}
+	if err := Render(templates, templateName, out, vars, opts); err != nil {
+		archive.Close()
+		os.Remove(archivePath)
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		os.Remove(archivePath)
+		return fmt.Errorf("failed to finalize archive: %w", err)
+	}
+	return nil
+}
+
+// Options controls how templates are rendered.
+type Options struct {
+	// Strict fails rendering when a template references a variable that is not set,
+	// instead of writing "<no value>". Every missing reference is reported at once.
+	Strict bool
+}
+
+// Render executes every file of templateName into out, skipping the .template directory.
+// Defaults from the template metadata fill in any variables missing from vars.
+// Nothing is written to out unless every file renders.
+func Render(templates fs.FS, templateName string, out Output, vars map[string]string, opts Options) error {
+	src := templateName
+
+	meta, err := LoadMetadata(templates, src)
+	if err != nil {
+		return fmt.Errorf("failed to get variables from metadata: %w", err)
+	}
+	for k, v := range meta.Data {
+		if _, exists := vars[k]; !exists {
+			vars[k] = v
+		}
+	}
+
+	var writes []func() error
+	var missing []MissingVar
+	err = fs.WalkDir(templates, src, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return fmt.Errorf("failed to get variables from metadata: %w", err)
+			return err
+		}
+		if d.IsDir() && d.Name() == ".template" {
+			return fs.SkipDir // skip .template directory
 		}
-		for k, v := range metadataVars {
-			if _, exists := vars[k]; !exists {
-				vars[k] = v
+		rel := relPath(src, p)
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := symlinkTarget(templates, p, rel, meta)
+			if err != nil {
+				return err
 			}
+			writes = append(writes, func() error { return out.AddSymlink(meta.outputPath(rel), target) })
+			return nil
 		}
-	}
-
-	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
-		if strings.Contains(path, ".template") {
-			return nil // skip .template directory
+		info, err := d.Info()
+		if err != nil {
+			return err
 		}
+		mode := fileMode(info, meta, rel)
 		if d.IsDir() {
 			// create directory structure in destination
-			if err := os.MkdirAll(filepath.Join(dst, strings.TrimPrefix(path, src)), os.ModePerm); err != nil {
-				return fmt.Errorf("failed to create directory %s: %w", path, err)
-			}
+			writes = append(writes, func() error {
+				if err := out.AddDir(rel, mode); err != nil {
+					return fmt.Errorf("failed to create directory %s: %w", p, err)
+				}
+				return nil
+			})
 			return nil
 		}
-		rel, _ := filepath.Rel(src, path)
-		target := filepath.Join(dst, rel)
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("unsupported file type %s for %s", info.Mode().Type(), p)
+		}
 
-		data, err := os.ReadFile(path)
+		data, err := fs.ReadFile(templates, p)
 		if err != nil {
 			return err
 		}
@@ -76,44 +134,129 @@ func Generate(templateName, projectName, baseTemplateDir string, vars map[string
 		if err != nil {
 			return err
 		}
-		f, err := os.Create(target)
-		if err != nil {
+		if opts.Strict {
+			tpl.Option("missingkey=error")
+			if fileMissing := missingVars(tpl, rel, string(data), vars); len(fileMissing) > 0 {
+				missing = append(missing, fileMissing...)
+				return nil
+			}
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, vars); err != nil {
+			if mv, ok := missingKeyFromExecError(err); ok && opts.Strict {
+				missing = append(missing, mv)
+				return nil
+			}
 			return err
 		}
-		defer f.Close()
-		return tpl.Execute(f, vars)
+		writes = append(writes, func() error { return out.AddFile(meta.outputPath(rel), buf.Bytes(), mode) })
+		return nil
 	})
 	if err != nil {
 		return err
 	}
+	if len(missing) > 0 {
+		return &MissingVarsError{Template: templateName, Missing: missing}
+	}
 
-	return runHook(src, "post.sh", dst)
+	for _, write := range writes {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func makeScriptExecutable(scriptPath string) error {
-	if err := os.Chmod(scriptPath, 0755); err != nil {
-		return fmt.Errorf("failed to make script executable: %w", err)
+// fileMode returns the permissions to give a rendered file or directory.
+// A metadata "modes" entry wins; otherwise the source mode is kept and made
+// owner-writable, since embedded templates always report read-only modes.
+func fileMode(info fs.FileInfo, meta *Metadata, rel string) fs.FileMode {
+	if mode, ok := meta.modeFor(rel); ok {
+		return mode
 	}
-	return nil
+	return info.Mode().Perm() | 0200
+}
+
+// readLinkFS is implemented by file systems that can report symlink targets, such as os.DirFS.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// symlinkTarget applies the template's symlink policy to the link at p and returns its target.
+func symlinkTarget(templates fs.FS, p, rel string, meta *Metadata) (string, error) {
+	if meta.Symlinks != SymlinkRecreate {
+		return "", fmt.Errorf("template contains symlink %s; set \"symlinks: %s\" in metadata to allow it", p, SymlinkRecreate)
+	}
+	rlfs, ok := templates.(readLinkFS)
+	if !ok {
+		return "", fmt.Errorf("cannot read symlink %s: template source does not support symlinks", p)
+	}
+	target, err := rlfs.ReadLink(p)
+	if err != nil {
+		return "", err
+	}
+	// Only relative links that stay inside the project are recreated.
+	if path.IsAbs(target) || !fs.ValidPath(path.Join(path.Dir(rel), target)) {
+		return "", fmt.Errorf("symlink %s points outside the template: %s", p, target)
+	}
+	return target, nil
+}
+
+// relPath returns p relative to the slash-separated root dir.
+func relPath(root, p string) string {
+	if p == root {
+		return "."
+	}
+	return p[len(root)+1:]
 }
 
-func runHook(templatePath, scriptName, workDir string) error {
-	script := filepath.Join(templatePath, ".template", scriptName)
-	cwd, err := os.Getwd()
+// materializeHook copies a hook script out of fsys into a temporary executable file.
+// The caller must remove the returned path once the hook has run.
+func materializeHook(fsys fs.FS, scriptPath string) (string, error) {
+	data, err := fs.ReadFile(fsys, scriptPath)
+	if err != nil {
+		return "", err
+	}
+
+	tempFile, err := os.CreateTemp("", "gallium-hook-*.sh")
 	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
+		return "", fmt.Errorf("failed to create hook script: %w", err)
 	}
-	script = filepath.Join(cwd, script)
-	if _, err := os.Stat(script); err == nil {
-		if err := makeScriptExecutable(script); err != nil {
-			return fmt.Errorf("failed to make script executable: %w", err)
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to write hook script: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to write hook script: %w", err)
+	}
+	if err := os.Chmod(tempFile.Name(), 0755); err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("failed to make script executable: %w", err)
+	}
+	return tempFile.Name(), nil
+}
+
+func runHook(templates fs.FS, templateName, scriptName, workDir string) error {
+	scriptPath := path.Join(templateName, ".template", scriptName)
+	if _, err := fs.Stat(templates, scriptPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
 		}
-		cmd := exec.Command("sh", "-c", script)
-		cmd.Dir = workDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		fmt.Println("Running:", scriptName)
-		return cmd.Run()
+		return err
 	}
-	return nil
+
+	script, err := materializeHook(templates, scriptPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(script)
+
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	fmt.Println("Running:", scriptName)
+	return cmd.Run()
 }
@@ -0,0 +1,147 @@
+package generator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// linkFS adds ReadLink to fstest.MapFS, whose symlink entries store the target as Data.
+type linkFS struct {
+	fstest.MapFS
+}
+
+func (l linkFS) ReadLink(name string) (string, error) {
+	f, ok := l.MapFS[name]
+	if !ok || f.Mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return string(f.Data), nil
+}
+
+func TestRenderFileModes(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml": {Data: []byte("modes:\n  \"scripts/*.sh\": \"0750\"\n")},
+		"demo/run.sh":                  {Data: []byte("#!/bin/sh\n"), Mode: 0755},
+		"demo/README.md":               {Data: []byte("# {{.projectName}}\n"), Mode: 0444},
+		"demo/scripts/setup.sh":        {Data: []byte("#!/bin/sh\n"), Mode: 0644},
+	}
+
+	dst := t.TempDir()
+	if err := Render(templates, "demo", DirOutput{Root: dst}, map[string]string{"projectName": "demo"}, Options{}); err != nil {
+		t.Fatalf("Render error = %v", err)
+	}
+
+	tests := map[string]fs.FileMode{
+		"run.sh":           0755,
+		"README.md":        0644,
+		"scripts/setup.sh": 0750,
+	}
+	for name, want := range tests {
+		info, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("Stat(%s) error = %v", name, err)
+		}
+		// the umask may only clear bits, never add them
+		if got := info.Mode().Perm(); got&^want != 0 || got&0100 != want&0100 {
+			t.Fatalf("mode of %s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRenderSymlinkPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		metadata string
+		target   string
+		wantErr  string
+	}{
+		{name: "refused by default", target: "../README.md", wantErr: "symlinks: recreate"},
+		{name: "recreated", metadata: "symlinks: recreate\n", target: "../README.md"},
+		{name: "escaping target", metadata: "symlinks: recreate\n", target: "../../etc/passwd", wantErr: "points outside"},
+		{name: "unknown policy", metadata: "symlinks: follow\n", target: "../README.md", wantErr: "unknown symlinks policy"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			templates := linkFS{fstest.MapFS{
+				"demo/.template/metadata.yaml": {Data: []byte(tc.metadata)},
+				"demo/README.md":               {Data: []byte("hello\n")},
+				"demo/docs/index.md":           {Data: []byte(tc.target), Mode: fs.ModeSymlink},
+			}}
+
+			dst := t.TempDir()
+			err := Render(templates, "demo", DirOutput{Root: dst}, map[string]string{}, Options{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Render error = %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render error = %v", err)
+			}
+			got, err := os.Readlink(filepath.Join(dst, "docs", "index.md"))
+			if err != nil {
+				t.Fatalf("Readlink error = %v", err)
+			}
+			if got != tc.target {
+				t.Fatalf("link target = %q, want %q", got, tc.target)
+			}
+		})
+	}
+}
+
+func TestRenderStrictReportsEveryMissingVariable(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml": {Data: []byte("data:\n  projectDescription: d\n")},
+		"demo/README.md":               {Data: []byte("# {{ .projectName }}\n{{ .projectNmae }}\n")},
+		"demo/docs/index.md":           {Data: []byte("{{ .projectDescription }}\n\n{{ if .licence }}{{ .licence }}{{ end }}\n")},
+	}
+	vars := map[string]string{"projectName": "demo"}
+
+	dst := t.TempDir()
+	err := Render(templates, "demo", DirOutput{Root: dst}, vars, Options{Strict: true})
+	var missingErr *MissingVarsError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("Render error = %v, want *MissingVarsError", err)
+	}
+	var got []string
+	for _, m := range missingErr.Missing {
+		got = append(got, m.String())
+	}
+	want := []string{
+		`README.md:2: variable "projectNmae" is not set`,
+		`docs/index.md:3: variable "licence" is not set`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("missing = %q, want %q", got, want)
+	}
+	if entries, _ := os.ReadDir(dst); len(entries) != 0 {
+		t.Fatalf("strict failure wrote %d entries, want none", len(entries))
+	}
+
+	if err := Render(templates, "demo", DirOutput{Root: dst}, vars, Options{}); err != nil {
+		t.Fatalf("non-strict Render error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<no value>") {
+		t.Fatalf("non-strict README.md = %q, want <no value> placeholder", data)
+	}
+}
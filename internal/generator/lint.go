@@ -0,0 +1,323 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity of a lint Issue.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is a single lint finding. File is relative to the template root; Line is 0 when unknown.
+type Issue struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (i Issue) String() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", i.File, i.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, i.Severity, i.Message)
+}
+
+// HasErrors reports whether any issue has error severity.
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+var metadataKeys = map[string]string{
+	"name":        "string",
+	"description": "string",
+	"version":     "string",
+	"appendFiles": "list",
+	"modes":       "map",
+	"symlinks":    "string",
+	"renames":     "map",
+	"verify":      "list",
+	"data":        "map",
+}
+
+// Lint checks templateName in templates: the metadata schema, template syntax,
+// references to undeclared variables, unused declared variables and hook portability.
+func Lint(templates fs.FS, templateName string) ([]Issue, error) {
+	if _, err := fs.Stat(templates, templateName); err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	meta, metaIssues := lintMetadata(templates, templateName)
+	issues = append(issues, metaIssues...)
+
+	declared := map[string]bool{}
+	for k := range ProjectVars("") {
+		declared[k] = true
+	}
+	used := map[string]bool{}
+	if meta != nil {
+		for k := range meta.Data {
+			declared[k] = true
+		}
+	}
+
+	err := fs.WalkDir(templates, templateName, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".template" {
+			return fs.SkipDir
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel := relPath(templateName, p)
+		data, err := fs.ReadFile(templates, p)
+		if err != nil {
+			return err
+		}
+		refs, err := templateRefs(rel, string(data))
+		if err != nil {
+			issues = append(issues, Issue{File: rel, Line: parseErrorLine(err), Severity: SeverityError, Message: err.Error()})
+			return nil
+		}
+		for _, ref := range refs {
+			used[ref.name] = true
+			if !declared[ref.name] {
+				issues = append(issues, Issue{File: rel, Line: ref.line, Severity: SeverityError, Message: fmt.Sprintf("variable %q is not declared in metadata data", ref.name)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if meta != nil {
+		builtins := ProjectVars("")
+		for k := range meta.Data {
+			if _, builtin := builtins[k]; builtin {
+				continue // always overridden by gallium
+			}
+			if !used[k] {
+				issues = append(issues, Issue{File: ".template/metadata.yaml", Severity: SeverityWarning, Message: fmt.Sprintf("variable %q is declared but never used", k)})
+			}
+		}
+	}
+
+	for _, hook := range []string{"pre.sh", "post.sh"} {
+		hookIssues, err := lintHook(templates, path.Join(templateName, ".template", hook))
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, hookIssues...)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Message < issues[j].Message
+	})
+	return issues, nil
+}
+
+// lintMetadata validates metadata.yaml against the keys Generate understands.
+// It returns the parsed metadata when it could be decoded.
+func lintMetadata(templates fs.FS, templateName string) (*Metadata, []Issue) {
+	const file = ".template/metadata.yaml"
+	issue := func(line int, severity, format string, args ...any) Issue {
+		return Issue{File: file, Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	}
+
+	raw, err := fs.ReadFile(templates, MetadataPath(templateName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, []Issue{issue(0, SeverityWarning, "template has no metadata file")}
+	}
+	if err != nil {
+		return nil, []Issue{issue(0, SeverityError, "%v", err)}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, []Issue{issue(0, SeverityError, "%v", err)}
+	}
+	if len(doc.Content) == 0 {
+		return &Metadata{}, []Issue{issue(0, SeverityWarning, "metadata file is empty")}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, []Issue{issue(root.Line, SeverityError, "metadata must be a mapping")}
+	}
+
+	var issues []Issue
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		seen[key.Value] = true
+		kind, known := metadataKeys[key.Value]
+		if !known {
+			issues = append(issues, issue(key.Line, SeverityError, "unknown metadata key %q", key.Value))
+			continue
+		}
+		switch kind {
+		case "string":
+			if value.Kind != yaml.ScalarNode {
+				issues = append(issues, issue(value.Line, SeverityError, "%q must be a string", key.Value))
+			}
+		case "list":
+			if value.Kind != yaml.SequenceNode {
+				issues = append(issues, issue(value.Line, SeverityError, "%q must be a list", key.Value))
+				continue
+			}
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					issues = append(issues, issue(item.Line, SeverityError, "%q entries must be strings", key.Value))
+					continue
+				}
+				if key.Value != "appendFiles" {
+					continue
+				}
+				if !fs.ValidPath(item.Value) {
+					issues = append(issues, issue(item.Line, SeverityError, "%q entry %q must be a relative slash-separated path", key.Value, item.Value))
+				} else if _, err := fs.Stat(templates, path.Join(templateName, item.Value)); err != nil {
+					issues = append(issues, issue(item.Line, SeverityWarning, "%q entry %q does not exist in the template", key.Value, item.Value))
+				}
+			}
+		case "map":
+			if value.Kind != yaml.MappingNode {
+				issues = append(issues, issue(value.Line, SeverityError, "%q must be a mapping", key.Value))
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				if value.Content[j+1].Kind != yaml.ScalarNode {
+					issues = append(issues, issue(value.Content[j+1].Line, SeverityError, "%s.%s must be a string", key.Value, value.Content[j].Value))
+				}
+			}
+		}
+	}
+	for _, required := range []string{"name", "version"} {
+		if !seen[required] {
+			issues = append(issues, issue(0, SeverityWarning, "missing %q", required))
+		}
+	}
+
+	// Decode even when the schema has errors so variable checks still see the data section.
+	var meta Metadata
+	if err := root.Decode(&meta); err != nil {
+		if !HasErrors(issues) {
+			issues = append(issues, issue(0, SeverityError, "%v", err))
+		}
+		return nil, issues
+	}
+	if err := meta.validate(); err != nil {
+		issues = append(issues, issue(0, SeverityError, "%v", err))
+	}
+	if meta.Name != "" && meta.Name != path.Base(templateName) {
+		issues = append(issues, issue(0, SeverityWarning, "name %q does not match template directory %q", meta.Name, path.Base(templateName)))
+	}
+	return &meta, issues
+}
+
+var parseErrorLineRE = regexp.MustCompile(`^template: [^:]+:(\d+):`)
+
+// parseErrorLine extracts the line number from a text/template parse error.
+func parseErrorLine(err error) int {
+	m := parseErrorLineRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	var line int
+	fmt.Sscanf(m[1], "%d", &line)
+	return line
+}
+
+var bashisms = []struct {
+	re      *regexp.Regexp
+	message string
+}{
+	{regexp.MustCompile(`\[\[`), "[[ is not POSIX; use ["},
+	{regexp.MustCompile(`^\s*function\s+\w+`), "the function keyword is not POSIX; use name() { ... }"},
+	{regexp.MustCompile(`^\s*source\s`), "source is not POSIX; use ."},
+	{regexp.MustCompile(`\$'`), "$'...' quoting is not POSIX"},
+	{regexp.MustCompile(`<<<`), "here-strings are not POSIX"},
+	{regexp.MustCompile(`&>`), "&> is not POSIX; use >file 2>&1"},
+	{regexp.MustCompile(`^\s*(declare|local|typeset)\s`), "declare/local/typeset are not POSIX"},
+}
+
+// lintHook flags hook scripts that would not run under a plain POSIX sh.
+func lintHook(templates fs.FS, hookPath string) ([]Issue, error) {
+	data, err := fs.ReadFile(templates, hookPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := ".template/" + path.Base(hookPath)
+	var issues []Issue
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 && strings.HasPrefix(text, "#!") {
+			if !isPOSIXShebang(text) {
+				issues = append(issues, Issue{File: file, Line: line, Severity: SeverityError, Message: fmt.Sprintf("hook shebang %q is not POSIX sh; use #!/bin/sh", text)})
+			}
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(text), "#") {
+			continue
+		}
+		for _, b := range bashisms {
+			if b.re.MatchString(text) {
+				issues = append(issues, Issue{File: file, Line: line, Severity: SeverityError, Message: b.message})
+			}
+		}
+	}
+
+	if sh, err := exec.LookPath("sh"); err == nil {
+		cmd := exec.Command(sh, "-n")
+		cmd.Stdin = bytes.NewReader(data)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			issues = append(issues, Issue{File: file, Severity: SeverityError, Message: "sh -n: " + strings.TrimSpace(string(out))})
+		}
+	}
+	return issues, nil
+}
+
+func isPOSIXShebang(line string) bool {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	switch {
+	case len(fields) == 0:
+		return false
+	case fields[0] == "/bin/sh" || fields[0] == "/usr/bin/sh":
+		return true
+	case path.Base(fields[0]) == "env" && len(fields) > 1:
+		return fields[1] == "sh"
+	}
+	return false
+}
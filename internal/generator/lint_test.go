@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml": {Data: []byte("name: demo\nversion: 1.0.0\nappendFile:\n  - x\ndata:\n  projectDescription: d\n  projectAuthor: a\n")},
+		"demo/.template/pre.sh":        {Data: []byte("#!/bin/bash\nif [[ -n \"$X\" ]]; then echo x; fi\n")},
+		"demo/.template/post.sh":       {Data: []byte("#!/bin/sh\necho done\n")},
+		"demo/README.md":               {Data: []byte("# {{ .ProjectName }}\n\n{{ .projectDescription }}\n{{ .projectNmae }}\n")},
+		"demo/list.txt":                {Data: []byte("{{ range .items }}{{ .name }}{{ end }}\n")},
+		"demo/broken.txt":              {Data: []byte("line one\n{{ .projectDescription \n")},
+	}
+
+	issues, err := Lint(templates, "demo")
+	if err != nil {
+		t.Fatalf("Lint error = %v", err)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		`.template/metadata.yaml:3: error: unknown metadata key "appendFile"`,
+		`.template/pre.sh:1: error: hook shebang "#!/bin/bash" is not POSIX sh; use #!/bin/sh`,
+		`.template/pre.sh:2: error: [[ is not POSIX; use [`,
+		`README.md:4: error: variable "projectNmae" is not declared in metadata data`,
+		`broken.txt:3: error: template: broken.txt:3: unclosed action`,
+		`list.txt:1: error: variable "items" is not declared in metadata data`,
+	}
+	for _, w := range want {
+		found := false
+		for _, g := range got {
+			if strings.HasPrefix(g, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing issue %q in:\n%s", w, strings.Join(got, "\n"))
+		}
+	}
+	for _, g := range got {
+		if strings.Contains(g, `"name"`) || strings.Contains(g, `"projectDescription" is not declared`) {
+			t.Errorf("unexpected issue %s", g)
+		}
+	}
+}
+
+func TestLintUnusedVariables(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml": {Data: []byte("name: demo\nversion: 1.0.0\ndata:\n  projectName: demo\n  projectAuthor: a\n  projectDescription: d\n")},
+		"demo/README.md":               {Data: []byte("{{ $.projectDescription }}\n")},
+	}
+
+	issues, err := Lint(templates, "demo")
+	if err != nil {
+		t.Fatalf("Lint error = %v", err)
+	}
+	if HasErrors(issues) {
+		t.Fatalf("Lint reported errors: %v", issues)
+	}
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, `"projectAuthor" is declared but never used`) {
+		t.Fatalf("Lint issues = %v, want only projectAuthor unused", issues)
+	}
+}
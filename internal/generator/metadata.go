@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Symlink policies accepted by the metadata "symlinks" key.
+const (
+	SymlinkRefuse   = "refuse"
+	SymlinkRecreate = "recreate"
+)
+
+// Metadata mirrors .template/metadata.yaml.
+//
+// Modes maps path.Match patterns, relative to the template root, to octal
+// file modes. Symlinks is SymlinkRefuse (the default) or SymlinkRecreate.
+// Renames maps template paths to the paths they are written to, for files such
+// as go.mod that cannot be stored under their real name. Verify lists shell
+// commands that check a generated project.
+type Metadata struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Version     string            `yaml:"version"`
+	AppendFiles []string          `yaml:"appendFiles"`
+	Modes       map[string]string `yaml:"modes"`
+	Symlinks    string            `yaml:"symlinks"`
+	Renames     map[string]string `yaml:"renames"`
+	Verify      []string          `yaml:"verify"`
+	Data        map[string]string `yaml:"data"`
+}
+
+// MetadataPath returns the location of the metadata file for templateName inside a template FS.
+func MetadataPath(templateName string) string {
+	return path.Join(templateName, ".template", "metadata.yaml")
+}
+
+// ReadMetadata parses and validates the metadata file at metadataPath in fsys.
+func ReadMetadata(fsys fs.FS, metadataPath string) (*Metadata, error) {
+	file, err := fs.ReadFile(fsys, metadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %w", err)
+	}
+
+	var meta Metadata
+	if err := yaml.Unmarshal(file, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+	if err := meta.validate(); err != nil {
+		return nil, fmt.Errorf("invalid metadata %s: %w", metadataPath, err)
+	}
+
+	return &meta, nil
+}
+
+// LoadMetadata reads the metadata for templateName, returning empty metadata when the template has none.
+func LoadMetadata(fsys fs.FS, templateName string) (*Metadata, error) {
+	metadataPath := MetadataPath(templateName)
+	if _, err := fs.Stat(fsys, metadataPath); err != nil {
+		return &Metadata{}, nil
+	}
+	return ReadMetadata(fsys, metadataPath)
+}
+
+func (m *Metadata) validate() error {
+	for pattern, mode := range m.Modes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad modes pattern %q: %w", pattern, err)
+		}
+		if _, err := parseMode(mode); err != nil {
+			return fmt.Errorf("bad mode for %q: %w", pattern, err)
+		}
+	}
+	for from, to := range m.Renames {
+		if !fs.ValidPath(from) || !fs.ValidPath(to) || from == "." || to == "." {
+			return fmt.Errorf("bad rename %q -> %q: paths must be relative and slash-separated", from, to)
+		}
+	}
+	switch m.Symlinks {
+	case "", SymlinkRefuse, SymlinkRecreate:
+	default:
+		return fmt.Errorf("unknown symlinks policy %q (want %q or %q)", m.Symlinks, SymlinkRefuse, SymlinkRecreate)
+	}
+	return nil
+}
+
+// modeFor returns the override mode for rel, if a modes pattern matches it.
+// When several patterns match, the longest one wins.
+func (m *Metadata) modeFor(rel string) (fs.FileMode, bool) {
+	best := ""
+	for pattern := range m.Modes {
+		if ok, _ := path.Match(pattern, rel); ok && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	mode, _ := parseMode(m.Modes[best])
+	return mode, true
+}
+
+// outputPath returns where the template file rel is written.
+func (m *Metadata) outputPath(rel string) string {
+	if to, ok := m.Renames[rel]; ok {
+		return to
+	}
+	return rel
+}
+
+func parseMode(s string) (fs.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal mode", s)
+	}
+	if v > 0777 {
+		return 0, fmt.Errorf("%q has bits outside 0777", s)
+	}
+	return fs.FileMode(v), nil
+}
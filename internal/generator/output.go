@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Output receives the directories and files rendered from a template.
+// Names are slash-separated and relative to the project root.
+// compressor.ArchiveWriter satisfies this interface.
+type Output interface {
+	AddDir(name string, perm fs.FileMode) error
+	AddFile(name string, data []byte, perm fs.FileMode) error
+	AddSymlink(name, target string) error
+}
+
+// DirOutput writes rendered files below a directory on disk.
+type DirOutput struct {
+	Root string
+}
+
+func (o DirOutput) AddDir(name string, perm fs.FileMode) error {
+	return os.MkdirAll(filepath.Join(o.Root, filepath.FromSlash(name)), perm)
+}
+
+func (o DirOutput) AddFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(filepath.Join(o.Root, filepath.FromSlash(name)), data, perm)
+}
+
+func (o DirOutput) AddSymlink(name, target string) error {
+	link := filepath.Join(o.Root, filepath.FromSlash(name))
+	if err := os.Remove(link); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(target), link)
+}
+
+// prefixOutput nests every entry below a directory inside another Output.
+type prefixOutput struct {
+	prefix string
+	out    Output
+}
+
+func (o prefixOutput) AddDir(name string, perm fs.FileMode) error {
+	return o.out.AddDir(o.join(name), perm)
+}
+
+func (o prefixOutput) AddFile(name string, data []byte, perm fs.FileMode) error {
+	return o.out.AddFile(o.join(name), data, perm)
+}
+
+func (o prefixOutput) AddSymlink(name, target string) error {
+	return o.out.AddSymlink(o.join(name), target)
+}
+
+func (o prefixOutput) join(name string) string {
+	if name == "." {
+		return o.prefix
+	}
+	return o.prefix + "/" + name
+}
+
+// MemFile is a file, directory or symlink captured by MemOutput.
+type MemFile struct {
+	Data   []byte
+	Mode   fs.FileMode
+	Target string
+}
+
+// MemOutput keeps rendered entries in memory, keyed by slash-separated path.
+type MemOutput map[string]*MemFile
+
+func (o MemOutput) AddDir(name string, perm fs.FileMode) error {
+	o[name] = &MemFile{Mode: fs.ModeDir | perm}
+	return nil
+}
+
+func (o MemOutput) AddFile(name string, data []byte, perm fs.FileMode) error {
+	o[name] = &MemFile{Data: append([]byte(nil), data...), Mode: perm}
+	return nil
+}
+
+func (o MemOutput) AddSymlink(name, target string) error {
+	o[name] = &MemFile{Mode: fs.ModeSymlink | 0777, Target: target}
+	return nil
+}
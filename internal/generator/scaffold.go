@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const scaffoldMetadata = `name: %s
+description: A new gallium template
+version: 0.1.0
+
+data:
+  projectDescription: A new gallium template
+`
+
+const scaffoldPreHook = `#!/bin/sh
+# Runs in the project directory before the template files are rendered.
+set -eu
+`
+
+const scaffoldPostHook = `#!/bin/sh
+# Runs in the project directory after the template files are rendered.
+set -eu
+echo "[POST] Project setup complete."
+`
+
+const scaffoldReadme = `# {{ .ProjectName }}
+
+{{ .projectDescription }}
+`
+
+// InitTemplate creates a new template skeleton named name below dir:
+// .template/metadata.yaml, pre.sh and post.sh hooks and a README.md.
+func InitTemplate(dir, name string) error {
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid template name %q", name)
+	}
+	root := filepath.Join(dir, name)
+	if _, err := os.Stat(root); err == nil {
+		return fmt.Errorf("%s already exists", root)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, ".template"), 0755); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data string
+		mode fs.FileMode
+	}{
+		{name: filepath.Join(".template", "metadata.yaml"), data: fmt.Sprintf(scaffoldMetadata, name), mode: 0644},
+		{name: filepath.Join(".template", "pre.sh"), data: scaffoldPreHook, mode: 0755},
+		{name: filepath.Join(".template", "post.sh"), data: scaffoldPostHook, mode: 0755},
+		{name: "README.md", data: scaffoldReadme, mode: 0644},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(root, f.name), []byte(f.data), f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
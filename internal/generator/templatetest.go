@@ -0,0 +1,295 @@
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestCase mirrors a .template/tests/*.yaml file.
+//
+// Golden names a directory below .template/tests holding the expected
+// project; Files lists assertions about individual rendered files.
+// Strict defaults to true.
+type TestCase struct {
+	Name    string            `yaml:"name"`
+	Project string            `yaml:"project"`
+	Vars    map[string]string `yaml:"vars"`
+	Strict  *bool             `yaml:"strict"`
+	Golden  string            `yaml:"golden"`
+	Files   []FileAssertion   `yaml:"files"`
+}
+
+// FileAssertion checks one rendered file. A listed file must be rendered unless
+// Absent is set; Exists only makes that expectation explicit.
+type FileAssertion struct {
+	Path        string   `yaml:"path"`
+	Exists      bool     `yaml:"exists"`
+	Absent      bool     `yaml:"absent"`
+	Contains    []string `yaml:"contains"`
+	NotContains []string `yaml:"notContains"`
+	Mode        string   `yaml:"mode"`
+}
+
+// TestResult is the outcome of one test case. A case passed when Failures is empty.
+type TestResult struct {
+	Name     string
+	Failures []string
+	Updated  bool
+}
+
+// TestOptions controls RunTemplateTests.
+type TestOptions struct {
+	// UpdateDir, when set, is the template directory on disk; golden
+	// directories below it, or below GoldenDir, are rewritten from the
+	// rendered output.
+	UpdateDir string
+	// GoldenDir, when set, is a directory on disk that holds the golden
+	// directories of each template below the template's name, instead of
+	// .template/tests. It keeps them out of templates embedded in a binary.
+	GoldenDir string
+}
+
+// TestsDir returns the location of the test cases for templateName inside a template FS.
+func TestsDir(templateName string) string {
+	return path.Join(templateName, ".template", "tests")
+}
+
+// RunTemplateTests renders templateName in memory for every case in
+// .template/tests/*.yaml and compares the output with its expectations.
+func RunTemplateTests(templates fs.FS, templateName string, opts TestOptions) ([]TestResult, error) {
+	testsDir := TestsDir(templateName)
+	casePaths, err := fs.Glob(templates, path.Join(testsDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(casePaths)
+
+	var results []TestResult
+	for _, casePath := range casePaths {
+		tc, err := readTestCase(templates, casePath)
+		if err != nil {
+			return nil, err
+		}
+		result, err := runTestCase(templates, templateName, tc, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", casePath, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func readTestCase(templates fs.FS, casePath string) (*TestCase, error) {
+	data, err := fs.ReadFile(templates, casePath)
+	if err != nil {
+		return nil, err
+	}
+	var tc TestCase
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&tc); err != nil {
+		return nil, fmt.Errorf("failed to parse test case %s: %w", casePath, err)
+	}
+	if tc.Name == "" {
+		tc.Name = strings.TrimSuffix(path.Base(casePath), ".yaml")
+	}
+	if tc.Project == "" {
+		tc.Project = "demo"
+	}
+	if tc.Golden != "" && !fs.ValidPath(tc.Golden) {
+		return nil, fmt.Errorf("test case %s: golden %q must be a relative slash-separated path", casePath, tc.Golden)
+	}
+	return &tc, nil
+}
+
+func runTestCase(templates fs.FS, templateName string, tc *TestCase, opts TestOptions) (TestResult, error) {
+	result := TestResult{Name: tc.Name}
+
+	vars := ProjectVars(tc.Project)
+	for k, v := range tc.Vars {
+		vars[k] = v
+	}
+	strict := tc.Strict == nil || *tc.Strict
+	out := MemOutput{}
+	if err := Render(templates, templateName, out, vars, Options{Strict: strict}); err != nil {
+		result.Failures = append(result.Failures, fmt.Sprintf("render failed: %v", err))
+		return result, nil
+	}
+
+	for _, a := range tc.Files {
+		result.Failures = append(result.Failures, checkAssertion(out, a)...)
+	}
+
+	if tc.Golden != "" {
+		goldenFS, goldenPath := templates, path.Join(TestsDir(templateName), tc.Golden)
+		updatePath := filepath.Join(opts.UpdateDir, ".template", "tests", filepath.FromSlash(tc.Golden))
+		if opts.GoldenDir != "" {
+			goldenFS, goldenPath = os.DirFS(opts.GoldenDir), path.Join(templateName, tc.Golden)
+			updatePath = filepath.Join(opts.GoldenDir, templateName, filepath.FromSlash(tc.Golden))
+		}
+		if opts.UpdateDir != "" {
+			if err := writeGolden(updatePath, out); err != nil {
+				return result, fmt.Errorf("failed to update golden %s: %w", tc.Golden, err)
+			}
+			result.Updated = true
+		} else {
+			failures, err := compareGolden(goldenFS, goldenPath, out)
+			if err != nil {
+				return result, err
+			}
+			result.Failures = append(result.Failures, failures...)
+		}
+	}
+	return result, nil
+}
+
+func checkAssertion(out MemOutput, a FileAssertion) []string {
+	f, ok := out[a.Path]
+	if a.Absent {
+		if ok {
+			return []string{fmt.Sprintf("%s: exists, want absent", a.Path)}
+		}
+		return nil
+	}
+	if !ok {
+		return []string{fmt.Sprintf("%s: not rendered", a.Path)}
+	}
+
+	var failures []string
+	for _, want := range a.Contains {
+		if !bytes.Contains(f.Data, []byte(want)) {
+			failures = append(failures, fmt.Sprintf("%s: does not contain %q", a.Path, want))
+		}
+	}
+	for _, unwanted := range a.NotContains {
+		if bytes.Contains(f.Data, []byte(unwanted)) {
+			failures = append(failures, fmt.Sprintf("%s: contains %q", a.Path, unwanted))
+		}
+	}
+	if a.Mode != "" {
+		want, err := parseMode(a.Mode)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", a.Path, err))
+		} else if got := f.Mode.Perm(); got != want {
+			failures = append(failures, fmt.Sprintf("%s: mode %04o, want %04o", a.Path, got, want))
+		}
+	}
+	return failures
+}
+
+// compareGolden compares the regular files below goldenPath with the rendered output.
+func compareGolden(templates fs.FS, goldenPath string, out MemOutput) ([]string, error) {
+	if _, err := fs.Stat(templates, goldenPath); errors.Is(err, fs.ErrNotExist) {
+		return []string{fmt.Sprintf("golden directory %s does not exist; run with --update to create it, or pass --golden-dir if the goldens are kept outside the template", goldenPath)}, nil
+	}
+
+	golden := map[string][]byte{}
+	err := fs.WalkDir(templates, goldenPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(templates, p)
+		if err != nil {
+			return err
+		}
+		golden[relPath(goldenPath, p)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []string
+	for _, name := range sortedKeys(out) {
+		f := out[name]
+		if f.Mode.IsDir() {
+			continue
+		}
+		want, ok := golden[name]
+		switch {
+		case !ok:
+			failures = append(failures, fmt.Sprintf("%s: rendered but missing from golden", name))
+		case f.Mode&fs.ModeSymlink != 0:
+			if string(want) != f.Target {
+				failures = append(failures, fmt.Sprintf("%s: links to %q, golden has %q", name, f.Target, want))
+			}
+		case !bytes.Equal(f.Data, want):
+			failures = append(failures, fmt.Sprintf("%s: differs from golden%s", name, firstDiff(want, f.Data)))
+		}
+		delete(golden, name)
+	}
+	for _, name := range sortedKeys(golden) {
+		failures = append(failures, fmt.Sprintf("%s: in golden but not rendered", name))
+	}
+	return failures, nil
+}
+
+// firstDiff describes the first line where got departs from want.
+func firstDiff(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf(" at line %d: got %q, want %q", i+1, g, w)
+		}
+	}
+	return ""
+}
+
+// writeGolden replaces dir with the rendered output. Symlinks are stored as
+// plain files holding their target so goldens survive embedding.
+func writeGolden(dir string, out MemOutput) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(out) {
+		f := out[name]
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch {
+		case f.Mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case f.Mode&fs.ModeSymlink != 0:
+			if err := os.WriteFile(target, []byte(f.Target), 0644); err != nil {
+				return err
+			}
+		default:
+			if err := os.WriteFile(target, f.Data, f.Mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRunTemplateTests(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml":               {Data: []byte("data:\n  greeting: hello\n")},
+		"demo/README.md":                             {Data: []byte("# {{ .ProjectName }}\n{{ .greeting }}\n")},
+		"demo/.template/tests/pass.yaml":             {Data: []byte("project: app\ngolden: golden/pass\nfiles:\n  - path: README.md\n    contains: [\"# app\"]\n  - path: LICENSE\n    absent: true\n")},
+		"demo/.template/tests/golden/pass/README.md": {Data: []byte("# app\nhello\n")},
+		"demo/.template/tests/fail.yaml":             {Data: []byte("project: app\nvars:\n  greeting: hi\ngolden: golden/fail\nfiles:\n  - path: main.go\n    exists: true\n")},
+		"demo/.template/tests/golden/fail/README.md": {Data: []byte("# app\nhello\n")},
+		"demo/.template/tests/golden/fail/extra.txt": {Data: []byte("x\n")},
+	}
+
+	results, err := RunTemplateTests(templates, "demo", TestOptions{})
+	if err != nil {
+		t.Fatalf("RunTemplateTests error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	fail, pass := results[0], results[1]
+	if len(pass.Failures) != 0 {
+		t.Fatalf("pass case failures = %v", pass.Failures)
+	}
+	want := []string{
+		"main.go: not rendered",
+		`README.md: differs from golden at line 2: got "hi", want "hello"`,
+		"extra.txt: in golden but not rendered",
+	}
+	if got := strings.Join(fail.Failures, "\n"); got != strings.Join(want, "\n") {
+		t.Fatalf("fail case failures:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestRunTemplateTestsGoldenDir(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml":   {Data: []byte("data:\n  greeting: hello\n")},
+		"demo/README.md":                 {Data: []byte("# {{ .ProjectName }}\n{{ .greeting }}\n")},
+		"demo/.template/tests/case.yaml": {Data: []byte("project: app\ngolden: default\n")},
+	}
+	goldenDir := t.TempDir()
+
+	// Updating writes the golden under GoldenDir, not the template directory.
+	templateDir := t.TempDir()
+	results, err := RunTemplateTests(templates, "demo", TestOptions{UpdateDir: templateDir, GoldenDir: goldenDir})
+	if err != nil {
+		t.Fatalf("RunTemplateTests update error = %v", err)
+	}
+	if len(results) != 1 || !results[0].Updated {
+		t.Fatalf("update results = %+v, want one updated case", results)
+	}
+	data, err := os.ReadFile(filepath.Join(goldenDir, "demo", "default", "README.md"))
+	if err != nil {
+		t.Fatalf("golden not written under GoldenDir: %v", err)
+	}
+	if string(data) != "# app\nhello\n" {
+		t.Fatalf("golden README.md = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(templateDir, ".template")); !os.IsNotExist(err) {
+		t.Fatalf("template directory was written to: %v", err)
+	}
+
+	results, err = RunTemplateTests(templates, "demo", TestOptions{GoldenDir: goldenDir})
+	if err != nil {
+		t.Fatalf("RunTemplateTests error = %v", err)
+	}
+	if len(results) != 1 || len(results[0].Failures) != 0 {
+		t.Fatalf("results = %+v, want one passing case", results)
+	}
+
+	if err := os.WriteFile(filepath.Join(goldenDir, "demo", "default", "README.md"), []byte("# app\nbye\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	results, err = RunTemplateTests(templates, "demo", TestOptions{GoldenDir: goldenDir})
+	if err != nil {
+		t.Fatalf("RunTemplateTests error = %v", err)
+	}
+	want := `README.md: differs from golden at line 2: got "hello", want "bye"`
+	if len(results) != 1 || strings.Join(results[0].Failures, "\n") != want {
+		t.Fatalf("failures = %+v, want %q", results, want)
+	}
+}
@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ProjectVars returns the variables gallium itself passes to every template.
+func ProjectVars(projectName string) map[string]string {
+	return map[string]string{
+		"ProjectName": projectName,
+		"projectName": projectName,
+	}
+}
+
+// MissingVar is a reference to an unset variable found by strict rendering.
+type MissingVar struct {
+	File string
+	Line int
+	Name string
+}
+
+func (m MissingVar) String() string {
+	return fmt.Sprintf("%s:%d: variable %q is not set", m.File, m.Line, m.Name)
+}
+
+// MissingVarsError lists every unset variable referenced by a template.
+type MissingVarsError struct {
+	Template string
+	Missing  []MissingVar
+}
+
+func (e *MissingVarsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "template %s references %d unset variable(s):", e.Template, len(e.Missing))
+	for _, m := range e.Missing {
+		b.WriteString("\n  ")
+		b.WriteString(m.String())
+	}
+	return b.String()
+}
+
+// missingVars returns the references in tpl to variables that are not in vars.
+func missingVars(tpl *template.Template, file, text string, vars map[string]string) []MissingVar {
+	var missing []MissingVar
+	seen := map[varRef]bool{}
+	for _, ref := range parsedRefs(tpl, text) {
+		if _, ok := vars[ref.name]; ok || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		missing = append(missing, MissingVar{File: file, Line: ref.line, Name: ref.name})
+	}
+	return missing
+}
+
+var missingKeyRE = regexp.MustCompile(`^template: ([^:]+):(\d+):\d+: executing .*map has no entry for key "([^"]*)"`)
+
+// missingKeyFromExecError recognizes the error text/template returns under
+// missingkey=error, for references the static walk in parsedRefs cannot see.
+func missingKeyFromExecError(err error) (MissingVar, bool) {
+	m := missingKeyRE.FindStringSubmatch(err.Error())
+	if m == nil {
+		return MissingVar{}, false
+	}
+	line, _ := strconv.Atoi(m[2])
+	return MissingVar{File: m[1], Line: line, Name: m[3]}, true
+}
+
+type varRef struct {
+	name string
+	line int
+}
+
+// templateRefs parses a template file and returns every top-level variable it references.
+func templateRefs(name, text string) ([]varRef, error) {
+	tpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return parsedRefs(tpl, text), nil
+}
+
+// parsedRefs returns the top-level variables referenced by an already parsed template.
+// Only the main template is executed with the variable map as dot, so
+// templates it defines are not inspected.
+func parsedRefs(tpl *template.Template, text string) []varRef {
+	if tpl.Tree == nil || tpl.Tree.Root == nil {
+		return nil
+	}
+	var refs []varRef
+	collectRefs(tpl.Tree.Root, text, true, &refs)
+	return refs
+}
+
+// collectRefs walks a parse tree. rootDot is false inside range and with blocks,
+// where dot no longer refers to the variable map.
+func collectRefs(node parse.Node, text string, rootDot bool, refs *[]varRef) {
+	if node == nil {
+		return
+	}
+	add := func(ident string, pos parse.Pos) {
+		*refs = append(*refs, varRef{name: ident, line: lineAt(text, pos)})
+	}
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectRefs(child, text, rootDot, refs)
+		}
+	case *parse.ActionNode:
+		collectRefs(n.Pipe, text, rootDot, refs)
+	case *parse.IfNode:
+		collectRefs(n.Pipe, text, rootDot, refs)
+		collectRefs(n.List, text, rootDot, refs)
+		collectRefs(n.ElseList, text, rootDot, refs)
+	case *parse.RangeNode:
+		collectRefs(n.Pipe, text, rootDot, refs)
+		collectRefs(n.List, text, false, refs)
+		collectRefs(n.ElseList, text, rootDot, refs)
+	case *parse.WithNode:
+		collectRefs(n.Pipe, text, rootDot, refs)
+		collectRefs(n.List, text, false, refs)
+		collectRefs(n.ElseList, text, rootDot, refs)
+	case *parse.TemplateNode:
+		collectRefs(n.Pipe, text, rootDot, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectRefs(cmd, text, rootDot, refs)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectRefs(arg, text, rootDot, refs)
+		}
+	case *parse.ChainNode:
+		collectRefs(n.Node, text, rootDot, refs)
+	case *parse.FieldNode:
+		if rootDot && len(n.Ident) > 0 {
+			add(n.Ident[0], n.Pos)
+		}
+	case *parse.VariableNode:
+		// $.name always refers to the variable map
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			add(n.Ident[1], n.Pos)
+		}
+	}
+}
+
+func lineAt(text string, pos parse.Pos) int {
+	if int(pos) > len(text) {
+		pos = parse.Pos(len(text))
+	}
+	return strings.Count(text[:pos], "\n") + 1
+}
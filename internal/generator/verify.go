@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// VerifyResult is the outcome of one metadata "verify" command.
+type VerifyResult struct {
+	Command string
+	Output  string
+	Err     error
+}
+
+// VerifyFailed reports whether any verify command failed.
+func VerifyFailed(results []VerifyResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify runs the "verify" commands declared in templateName's metadata against
+// projectDir. The commands run with sh in a throwaway copy of the project so
+// build artifacts never land in the generated project.
+func Verify(templates fs.FS, templateName, projectDir string) ([]VerifyResult, error) {
+	meta, err := LoadMetadata(templates, templateName)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Verify) == 0 {
+		return nil, nil
+	}
+
+	workDir, err := os.MkdirTemp("", "gallium-verify-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verify directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	copyDir := filepath.Join(workDir, filepath.Base(filepath.Clean(projectDir)))
+	if err := copyTree(projectDir, copyDir); err != nil {
+		return nil, fmt.Errorf("failed to copy project for verification: %w", err)
+	}
+
+	results := make([]VerifyResult, 0, len(meta.Verify))
+	for _, command := range meta.Verify {
+		var output bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = copyDir
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		err := cmd.Run()
+		results = append(results, VerifyResult{Command: command, Output: output.String(), Err: err})
+	}
+	return results, nil
+}
+
+// copyTree copies the directory src to dst, keeping file modes and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
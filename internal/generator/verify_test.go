@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVerifyRunsInThrowawayCopy(t *testing.T) {
+	t.Parallel()
+
+	templates := fstest.MapFS{
+		"demo/.template/metadata.yaml": {Data: []byte("verify:\n  - test -f main.go && touch built\n  - exit 3\n")},
+	}
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Verify(templates, "demo", project)
+	if err != nil {
+		t.Fatalf("Verify error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("first command error = %v, output %q", results[0].Err, results[0].Output)
+	}
+	if results[1].Err == nil {
+		t.Fatalf("second command succeeded, want failure")
+	}
+	if !VerifyFailed(results) {
+		t.Fatalf("VerifyFailed = false, want true")
+	}
+	if _, err := os.Stat(filepath.Join(project, "built")); !os.IsNotExist(err) {
+		t.Fatalf("verify command wrote into the project directory (stat error = %v)", err)
+	}
+}
@@ -0,0 +1,250 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BaselineOptions controls Baseline.
+type BaselineOptions struct {
+	SquashOptions
+	// OutDir receives the baseline pair; it defaults to the migrations directory.
+	OutDir string
+	// ArchiveDir, when set, receives the superseded migration files, keeping
+	// their paths relative to the migrations directory.
+	ArchiveDir string
+	// DeleteSuperseded deletes the superseded migration files.
+	DeleteSuperseded bool
+	// VersionInsert ends the up migration with the schema_migrations row of
+	// the version the baseline replaces, for databases loaded from it
+	// without golang-migrate.
+	VersionInsert bool
+}
+
+// BaselineResult describes the files Baseline wrote and replaced.
+type BaselineResult struct {
+	UpPath, DownPath string
+	// Version is the highest version among the superseded migrations.
+	Version    uint64
+	Superseded []string
+}
+
+// Baseline squashes the migrations in dir into a 000001_baseline.up.sql and
+// .down.sql pair for golang-migrate, and archives or deletes the migrations
+// it replaces. Versions written with more digits, like timestamps, keep
+// their width.
+func Baseline(dir string, opts BaselineOptions) (*BaselineResult, Diagnostics, error) {
+	outDir := opts.OutDir
+	if outDir == "" {
+		outDir = dir
+	}
+	if opts.ArchiveDir != "" && opts.DeleteSuperseded {
+		return nil, nil, fmt.Errorf("superseded migrations can be archived or deleted, not both")
+	}
+	sameDir, err := isWithin(outDir, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sameDir && opts.ArchiveDir == "" && !opts.DeleteSuperseded {
+		return nil, nil, fmt.Errorf("the baseline would be replayed along with the migrations it replaces in %s: archive or delete them, or write it elsewhere", dir)
+	}
+	if opts.ArchiveDir != "" {
+		if inside, err := isWithin(opts.ArchiveDir, dir); err != nil {
+			return nil, nil, err
+		} else if inside {
+			return nil, nil, fmt.Errorf("archive directory %s is inside %s, where its migrations would be replayed again", opts.ArchiveDir, dir)
+		}
+	}
+
+	superseded, err := supersededFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := &BaselineResult{Superseded: superseded}
+	digits := 6
+	for _, f := range superseded {
+		if v, n, ok := migrationVersion(f); ok {
+			res.Version = max(res.Version, v)
+			digits = max(digits, n)
+		}
+	}
+
+	s, err := Load(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.prepare(opts.SchemaFilter, opts.Rules, opts.Strict); err != nil {
+		return nil, s.Diagnostics, err
+	}
+	up := s.RenderDDL(opts.IncludeIndexes, opts.SeparateFKs)
+	if opts.VersionInsert {
+		up += "\n" + versionInsertSQL(res.Version)
+	}
+	down := s.RenderDropDDL()
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, s.Diagnostics, err
+	}
+	prefix := fmt.Sprintf("%0*d_baseline", digits, 1)
+	res.UpPath = filepath.Join(outDir, prefix+".up.sql")
+	res.DownPath = filepath.Join(outDir, prefix+".down.sql")
+
+	// The baseline is written before the migrations it replaces are touched,
+	// under temporary names since it may replace an earlier baseline.
+	files := []struct{ path, sql string }{{res.UpPath, up}, {res.DownPath, down}}
+	removeTemp := func() {
+		for _, f := range files {
+			os.Remove(f.path + ".tmp")
+		}
+	}
+	for _, f := range files {
+		if err := os.WriteFile(f.path+".tmp", []byte(f.sql), 0644); err != nil {
+			removeTemp()
+			return nil, s.Diagnostics, fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+	}
+	for _, f := range superseded {
+		if err := supersede(dir, f, opts.ArchiveDir, opts.DeleteSuperseded); err != nil {
+			removeTemp()
+			return nil, s.Diagnostics, err
+		}
+	}
+	for _, f := range files {
+		if err := os.Rename(f.path+".tmp", f.path); err != nil {
+			return nil, s.Diagnostics, fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+	}
+	return res, s.Diagnostics, nil
+}
+
+// versionInsertSQL records version in golang-migrate's schema_migrations
+// table. The table is not created here, since golang-migrate owns it and a
+// later squash would otherwise pick it up.
+func versionInsertSQL(version uint64) string {
+	return fmt.Sprintf("insert into schema_migrations (version, dirty) values (%d, false);\n", version)
+}
+
+// supersededFiles returns the *.up.sql and *.down.sql files below dir.
+func supersededFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && (strings.HasSuffix(d.Name(), ".up.sql") || strings.HasSuffix(d.Name(), ".down.sql")) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortMigrationFiles(files)
+	return files, nil
+}
+
+// supersede moves the migration file f below dir into archiveDir, or deletes it.
+func supersede(dir, f, archiveDir string, remove bool) error {
+	switch {
+	case remove:
+		return os.Remove(f)
+	case archiveDir != "":
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(archiveDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(f, dst); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(path, dir string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false, nil
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))), nil
+}
+
+// RenderDropDDL renders statements that drop everything RenderDDL creates,
+// in reverse dependency order. Indexes, triggers and owned sequences go
+// with their tables.
+func (s *Schema) RenderDropDDL() string {
+	var b strings.Builder
+
+	views := make([]*View, 0, len(s.Views))
+	for _, v := range s.Views {
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].order > views[j].order })
+	for _, v := range views {
+		kind := "view"
+		if v.Materialized {
+			kind = "materialized view"
+		}
+		fmt.Fprintf(&b, "drop %s if exists %s;\n", kind, pqQuoteQualified(v.Schema, v.Name))
+	}
+
+	var tables []string
+	for _, key := range sortedKeys(s.Tables) {
+		// partitions are dropped with their parents
+		if t := s.Tables[key]; t.PartitionOf == nil {
+			tables = append(tables, pqQuoteQualified(t.Schema, t.Name))
+		}
+	}
+	if len(tables) > 0 {
+		fmt.Fprintf(&b, "drop table if exists %s;\n", strings.Join(tables, ", "))
+	}
+
+	funcs := make([]*Function, 0, len(s.Functions))
+	for _, f := range s.Functions {
+		funcs = append(funcs, f)
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].order > funcs[j].order })
+	for _, f := range funcs {
+		kind := "function"
+		if f.Procedure {
+			kind = "procedure"
+		}
+		fmt.Fprintf(&b, "drop %s if exists %s(%s);\n", kind, pqQuoteQualified(f.Schema, f.Name), strings.Join(f.Args, ", "))
+	}
+	for _, key := range sortedKeys(s.Sequences) {
+		q := s.Sequences[key]
+		fmt.Fprintf(&b, "drop sequence if exists %s;\n", pqQuoteQualified(q.Schema, q.Name))
+	}
+	for _, key := range sortedKeys(s.Enums) {
+		e := s.Enums[key]
+		fmt.Fprintf(&b, "drop type if exists %s;\n", pqQuoteQualified(e.Schema, e.Name))
+	}
+	exts := make([]*Extension, 0, len(s.Extensions))
+	for _, e := range s.Extensions {
+		exts = append(exts, e)
+	}
+	sort.Slice(exts, func(i, j int) bool { return exts[i].order > exts[j].order })
+	for _, e := range exts {
+		fmt.Fprintf(&b, "drop extension if exists %s;\n", pqQuoteIdent(e.Name))
+	}
+	for _, name := range s.schemaNames() {
+		fmt.Fprintf(&b, "drop schema if exists %s;\n", pqQuoteIdent(name))
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrationFilesNumericOrder(t *testing.T) {
+	t.Parallel()
+
+	dir := writeMigrations(t, map[string]string{
+		"10_c.up.sql":    "",
+		"9_b.up.sql":     "",
+		"1_a.up.sql":     "",
+		"100_d.up.sql":   "",
+		"seed.up.sql":    "",
+		"9_b.down.sql":   "",
+		"sub/2_x.up.sql": "",
+	})
+	files, err := MigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("MigrationFiles error = %v", err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"1_a.up.sql", "sub/2_x.up.sql", "9_b.up.sql", "10_c.up.sql", "100_d.up.sql", "seed.up.sql"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("MigrationFiles = %v, want %v", got, want)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	t.Parallel()
+
+	migrations := map[string]string{
+		"0001_init.up.sql":    "create extension if not exists citext;\ncreate type mood as enum ('ok');\ncreate table users (id int primary key, mood mood);\n",
+		"0001_init.down.sql":  "drop table users;\n",
+		"0002_more.up.sql":    "create table posts (id int primary key, user_id int references users (id));\ncreate view v as select id from posts;\ncreate schema app;\ncreate table app.audit (id int);\n",
+		"0010_index.up.sql":   "create index posts_user on posts (user_id);\n",
+		"0010_index.down.sql": "drop index posts_user;\n",
+	}
+
+	t.Run("archive", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeMigrations(t, migrations)
+		archive := filepath.Join(t.TempDir(), "archive")
+		res, _, err := Baseline(dir, BaselineOptions{
+			SquashOptions: SquashOptions{IncludeIndexes: true},
+			ArchiveDir:    archive,
+			VersionInsert: true,
+		})
+		if err != nil {
+			t.Fatalf("Baseline error = %v", err)
+		}
+		if res.Version != 10 || len(res.Superseded) != 5 {
+			t.Errorf("Baseline = version %d, %d superseded, want version 10, 5 superseded", res.Version, len(res.Superseded))
+		}
+		if want := filepath.Join(dir, "000001_baseline.up.sql"); res.UpPath != want {
+			t.Errorf("up path = %s, want %s", res.UpPath, want)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 2 {
+			t.Errorf("migrations dir has %d files, want the baseline pair", len(entries))
+		}
+		if _, err := os.Stat(filepath.Join(archive, "0002_more.up.sql")); err != nil {
+			t.Errorf("superseded migration not archived: %v", err)
+		}
+
+		up, _ := os.ReadFile(res.UpPath)
+		checkRendered(t, string(up), []string{
+			"create schema app;\n",
+			"create table app.audit (",
+			"create table users (",
+			"create index posts_user     on posts (user_id);",
+			"insert into schema_migrations (version, dirty) values (10, false);\n",
+		}, nil)
+		down, _ := os.ReadFile(res.DownPath)
+		checkRendered(t, string(down), []string{
+			"drop view if exists v;\n",
+			"drop table if exists app.audit, posts, users;\n",
+			"drop type if exists mood;\n",
+			"drop extension if exists citext;\n",
+			"drop schema if exists app;\n",
+		}, nil)
+
+		// the baseline replays to the same schema as the migrations
+		s, err := Load(dir)
+		if err != nil {
+			t.Fatalf("Load(baseline) error = %v", err)
+		}
+		if failing := s.Diagnostics.Failing(); len(failing) > 0 {
+			t.Errorf("baseline replay diagnostics: %+v", failing)
+		}
+		if _, ok := s.Tables["posts"]; !ok {
+			t.Error("baseline replay lost table posts")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeMigrations(t, migrations)
+		res, _, err := Baseline(dir, BaselineOptions{DeleteSuperseded: true})
+		if err != nil {
+			t.Fatalf("Baseline error = %v", err)
+		}
+		if _, err := os.Stat(res.Superseded[0]); !os.IsNotExist(err) {
+			t.Errorf("superseded migration %s still exists", res.Superseded[0])
+		}
+		up, _ := os.ReadFile(res.UpPath)
+		if strings.Contains(string(up), "schema_migrations") || strings.Contains(string(up), "create index") {
+			t.Errorf("baseline has a version insert or indexes it was not asked for:\n%s", up)
+		}
+	})
+
+	t.Run("other directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeMigrations(t, migrations)
+		out := t.TempDir()
+		if _, _, err := Baseline(dir, BaselineOptions{OutDir: out}); err != nil {
+			t.Fatalf("Baseline error = %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != len(migrations) {
+			t.Errorf("migrations dir has %d files, want them kept", len(entries))
+		}
+	})
+
+	t.Run("write failure keeps the migrations", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeMigrations(t, migrations)
+		out := filepath.Join(t.TempDir(), "out")
+		if err := os.WriteFile(out, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Baseline(dir, BaselineOptions{OutDir: out, DeleteSuperseded: true}); err == nil {
+			t.Fatal("Baseline into a file succeeded, want an error")
+		}
+		for name := range migrations {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("migration %s lost after a failed baseline: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("replaces an earlier baseline", func(t *testing.T) {
+		t.Parallel()
+
+		dir := writeMigrations(t, migrations)
+		archive := filepath.Join(t.TempDir(), "archive")
+		if _, _, err := Baseline(dir, BaselineOptions{DeleteSuperseded: true}); err != nil {
+			t.Fatalf("first Baseline error = %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "000002_more.up.sql"), []byte("create table more (id int);\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		res, _, err := Baseline(dir, BaselineOptions{ArchiveDir: archive})
+		if err != nil {
+			t.Fatalf("second Baseline error = %v", err)
+		}
+		up, _ := os.ReadFile(res.UpPath)
+		checkRendered(t, string(up), []string{"create table more (", "create table users ("}, nil)
+		if _, err := os.Stat(filepath.Join(archive, "000001_baseline.up.sql")); err != nil {
+			t.Errorf("earlier baseline not archived: %v", err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+			t.Errorf("migrations dir has %d files, want the baseline pair", len(entries))
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		opts    BaselineOptions
+		wantErr string
+	}{
+		{name: "superseded kept in place", opts: BaselineOptions{}, wantErr: "archive or delete them"},
+		{name: "archive and delete", opts: BaselineOptions{ArchiveDir: "x", DeleteSuperseded: true}, wantErr: "not both"},
+		{name: "archive inside migrations", opts: BaselineOptions{ArchiveDir: "old"}, wantErr: "inside"},
+	}
+	for _, tc := range errorTests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeMigrations(t, migrations)
+			if tc.opts.ArchiveDir != "" {
+				tc.opts.ArchiveDir = filepath.Join(dir, tc.opts.ArchiveDir)
+			}
+			if _, _, err := Baseline(dir, tc.opts); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("Baseline error = %v, want %q", err, tc.wantErr)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != len(migrations) {
+				t.Errorf("migrations dir has %d files after a failed baseline, want them untouched", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// deparseExpr renders an expression node from ParseToJSON output back to SQL
+// with pg_query's deparser, by wrapping it in a SELECT target list.
+func deparseExpr(node json.RawMessage) (string, error) {
+	if len(node) == 0 || string(node) == "null" {
+		return "", nil
+	}
+	doc := fmt.Sprintf(`{"stmts":[{"stmt":{"SelectStmt":{"targetList":[{"ResTarget":{"val":%s}}],"limitOption":"LIMIT_OPTION_DEFAULT","op":"SETOP_NONE"}}}]}`, node)
+	var tree pgquery.ParseResult
+	if err := protojson.Unmarshal([]byte(doc), &tree); err != nil {
+		return "", fmt.Errorf("failed to read expression: %w", err)
+	}
+	sql, err := pgquery.Deparse(&tree)
+	if err != nil {
+		return "", fmt.Errorf("failed to deparse expression: %w", err)
+	}
+	expr, ok := strings.CutPrefix(sql, "SELECT ")
+	if !ok {
+		return "", fmt.Errorf("unexpected deparser output %q", sql)
+	}
+	return expr, nil
+}
+
+// deparseAny is deparseExpr for a node decoded into a generic map.
+func deparseAny(node any) (string, error) {
+	if node == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return deparseExpr(b)
+}
+
+// deparseType renders a TypeName node, e.g. numeric(10, 2) or text[].
+func deparseType(typeName json.RawMessage) (string, error) {
+	cast := fmt.Sprintf(`{"TypeCast":{"arg":{"A_Const":{"isnull":true}},"typeName":%s}}`, typeName)
+	sql, err := deparseExpr(json.RawMessage(cast))
+	if err != nil {
+		return "", err
+	}
+	typ, ok := strings.CutPrefix(sql, "NULL::")
+	if !ok {
+		return "", fmt.Errorf("unexpected deparser output %q", sql)
+	}
+	return typ, nil
+}
+
+// columnType is deparseType as a column type is written in the squashed
+// DDL: built-in types without their pg_catalog schema, types in public
+// unqualified, and int as integer.
+func columnType(typeName json.RawMessage) (string, error) {
+	if len(typeName) == 0 {
+		return "", nil
+	}
+	typ, err := deparseType(typeName)
+	if err != nil {
+		return "", err
+	}
+	typ = strings.TrimPrefix(strings.TrimPrefix(typ, "pg_catalog."), "public.")
+	if typ == "int" || strings.HasPrefix(typ, "int[") {
+		typ = "integer" + typ[len("int"):]
+	}
+	return typ, nil
+}
+
+// collationName renders the collation of a column's CollateClause, e.g. "C".
+func collationName(collClause json.RawMessage) (string, error) {
+	if len(collClause) == 0 {
+		return "", nil
+	}
+	var clause struct {
+		Collname []any `json:"collname"`
+	}
+	if err := json.Unmarshal(collClause, &clause); err != nil {
+		return "", err
+	}
+	return joinQuotedName(parseStringList(clause.Collname)), nil
+}
+
+// indexElemSQL renders one IndexElem of a CREATE INDEX: a column or an
+// expression with its collation, operator class and ordering.
+func indexElemSQL(elem map[string]any) (string, error) {
+	var sql string
+	if name, ok := elem["name"].(string); ok && name != "" {
+		sql = pqQuoteIdent(name)
+	} else {
+		expr, err := deparseAny(elem["expr"])
+		if err != nil {
+			return "", err
+		}
+		sql = expr
+		// function calls stand alone, other expressions need parentheses
+		if m, _ := elem["expr"].(map[string]any); m["FuncCall"] == nil {
+			sql = "(" + sql + ")"
+		}
+	}
+	if collation := parseStringList(elem["collation"]); len(collation) > 0 {
+		sql += " collate " + joinQuotedName(collation)
+	}
+	if opclass := parseStringList(elem["opclass"]); len(opclass) > 0 {
+		sql += " " + joinQuotedName(opclass)
+	}
+	switch elem["ordering"] {
+	case "SORTBY_ASC":
+		sql += " asc"
+	case "SORTBY_DESC":
+		sql += " desc"
+	}
+	switch elem["nulls_ordering"] {
+	case "SORTBY_NULLS_FIRST":
+		sql += " nulls first"
+	case "SORTBY_NULLS_LAST":
+		sql += " nulls last"
+	}
+	return sql, nil
+}
@@ -0,0 +1,135 @@
+package schema
+
+import "testing"
+
+func TestDeparse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    []string // in this order
+		notWant []string
+	}{
+		{
+			name: "column types",
+			sql:  `create table t (a numeric(10,2), b varchar(255), c int[], d text[][], e timestamp(3) with time zone, f "char", g double precision, h bit(3), i interval day to second);`,
+			want: []string{
+				"a numeric(10, 2),",
+				"b varchar(255),",
+				"c integer[],",
+				"d text[][],",
+				"e timestamp (3) with time zone,",
+				`f "char",`,
+				"g double precision,",
+				"h bit(3),",
+				"i interval day to second\n",
+			},
+		},
+		{
+			name: "defaults",
+			sql: `create table t (a text default 'x', b int default 0, c boolean default false, d timestamptz default now(), e jsonb default '{}'::jsonb, f numeric(10,2) default -1.5, g text[] default array[]::text[]);
+alter table t alter column a set default 'y';
+alter table t alter column b drop default;`,
+			want: []string{
+				"a text default 'y',",
+				"b integer,",
+				"c boolean default false,",
+				"d timestamptz default now(),",
+				"e jsonb default '{}'::jsonb,",
+				"f numeric(10, 2) default -1.5,",
+				"g text[] default ARRAY[]::text[]\n",
+			},
+		},
+		{
+			name: "altered column type",
+			sql: `create table t (a int, b text);
+alter table t alter column a type numeric(12,4) using a::numeric(12,4);
+alter table t alter column b set data type varchar(40);`,
+			want: []string{"a numeric(12, 4),", "b varchar(40)\n"},
+		},
+		{
+			name: "index methods and options",
+			sql: `create table t (a text, b int, c tsvector, d int, r int4range, ts timestamptz);
+create index t_c on t using gin (c);
+create index t_r on t using gist (r);
+create index t_ts on t using brin (ts);
+create index t_ab on t using btree (a collate "C" text_pattern_ops, b desc nulls last);
+create unique index t_a on t (a) include (b, d) where d > 0;`,
+			want: []string{
+				"create unique index t_a     on t (a) include (b, d) where d > 0;",
+				`create index t_ab     on t (a collate "C" text_pattern_ops, b desc nulls last);`,
+				"create index t_c     on t using gin (c);",
+				"create index t_r     on t using gist (r);",
+				"create index t_ts     on t using brin (ts);",
+			},
+		},
+		{
+			name: "expression indexes",
+			sql: `create table t (a text, b int, c int);
+create index on t (lower(a));
+create index on t ((b + c), (a::int) desc);
+create index on t ((b + c), (c - b));
+create index on t ((1::int), coalesce(b, c), (a collate "C"));
+create index on t (b) include (c);
+create index on t (b, c);
+create index on t (lower(a));
+drop index t_expr_a_idx;`,
+			want: []string{
+				"create index t_b_c_idx     on t (b) include (c);",
+				"create index t_b_c_idx1     on t (b, c);",
+				"create index t_expr_expr1_idx     on t ((b + c), (c - b));",
+				"create index t_int4_coalesce_a_idx     on t ((1::int), (COALESCE(b, c)), (a COLLATE \"C\"));",
+				"create index t_lower_idx     on t (lower(a));",
+				"create index t_lower_idx1     on t (lower(a));",
+			},
+			notWant: []string{"t_expr_a_idx", "t_expr_expr_idx ", "(a::int)"},
+		},
+		{
+			name: "column collations",
+			sql: `create table t (name varchar(20) collate "C", code text collate "en_US", x text collate "C", y text);
+alter table t alter column x type varchar(5);
+alter table t alter column y type varchar(5) collate "C";
+alter table t add column z text collate "C" not null;`,
+			want: []string{
+				`    name varchar(20) collate "C",`,
+				`    code text collate "en_US",`,
+				"    x varchar(5),",
+				`    y varchar(5) collate "C",`,
+				`    z text collate "C" not null`,
+			},
+		},
+		{
+			name: "renamed and dropped index columns",
+			sql: `create table t (a text, b int, c int, d int);
+create index t_lower on t (lower(a) desc);
+create index t_sum on t ((b + c));
+create index t_inc on t (a) include (d);
+create index t_part on t (a) where b > 0;
+alter table t rename column a to name;
+alter table t drop column c;
+alter table t drop column d;`,
+			want: []string{
+				"create index t_lower     on t (lower(name) desc);",
+				"create index t_part     on t (name) where b > 0;",
+			},
+			notWant: []string{"t_sum", "t_inc"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("test.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			if failing := s.Diagnostics.Failing(); len(failing) > 0 {
+				t.Fatalf("unexpected diagnostics: %+v", failing)
+			}
+			checkRendered(t, s.RenderDDL(true, false), tc.want, tc.notWant)
+		})
+	}
+}
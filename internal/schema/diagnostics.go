@@ -0,0 +1,132 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Level says how much a skipped statement matters for the squashed output.
+type Level string
+
+const (
+	// LevelIgnored statements do not change the schema, like INSERT or SET.
+	LevelIgnored Level = "ignored"
+	// LevelUnsupported statements change the schema in ways the squashed
+	// output does not reproduce.
+	LevelUnsupported Level = "unsupported"
+	// LevelError statements could not be parsed or replayed.
+	LevelError Level = "error"
+)
+
+// Diagnostic reports a migration statement that was skipped or only partly replayed.
+type Diagnostic struct {
+	File      string
+	Statement int    // 1-based index of the statement in File
+	Kind      string // parse tree node, e.g. "GrantStmt", or "ParseError"
+	Level     Level
+	Message   string
+	SQL       string
+}
+
+// Diagnostics is the report of a replay.
+type Diagnostics []Diagnostic
+
+// Failing returns the diagnostics that make a strict replay fail: anything
+// unsupported or in error.
+func (d Diagnostics) Failing() Diagnostics {
+	var failing Diagnostics
+	for _, diag := range d {
+		if diag.Level != LevelIgnored {
+			failing = append(failing, diag)
+		}
+	}
+	return failing
+}
+
+// statements counts the distinct statements d reports on.
+func (d Diagnostics) statements() int {
+	seen := map[string]bool{}
+	for _, diag := range d {
+		seen[fmt.Sprintf("%s#%d", diag.File, diag.Statement)] = true
+	}
+	return len(seen)
+}
+
+// WriteReport writes the diagnostics grouped by level and statement kind.
+func (d Diagnostics) WriteReport(w io.Writer) error {
+	type group struct {
+		level Level
+		kind  string
+	}
+	groups := map[group]Diagnostics{}
+	var keys []group
+	for _, diag := range d {
+		g := group{diag.Level, diag.Kind}
+		if _, ok := groups[g]; !ok {
+			keys = append(keys, g)
+		}
+		groups[g] = append(groups[g], diag)
+	}
+	rank := map[Level]int{LevelError: 0, LevelUnsupported: 1, LevelIgnored: 2}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return rank[keys[i].level] < rank[keys[j].level]
+		}
+		return keys[i].kind < keys[j].kind
+	})
+
+	var b strings.Builder
+	for _, g := range keys {
+		fmt.Fprintf(&b, "%s: %s (%d)\n", g.level, g.kind, len(groups[g]))
+		for _, diag := range groups[g] {
+			fmt.Fprintf(&b, "  %s #%d: %s", diag.File, diag.Statement, diag.Message)
+			if diag.SQL != "" {
+				fmt.Fprintf(&b, ": %s", diag.SQL)
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// nonSchemaStatements are statement kinds that do not change the schema.
+var nonSchemaStatements = map[string]bool{
+	"InsertStmt":       true,
+	"UpdateStmt":       true,
+	"DeleteStmt":       true,
+	"MergeStmt":        true,
+	"SelectStmt":       true,
+	"CopyStmt":         true,
+	"TransactionStmt":  true,
+	"VariableSetStmt":  true,
+	"VariableShowStmt": true,
+	"LockStmt":         true,
+	"NotifyStmt":       true,
+	"ListenStmt":       true,
+	"UnlistenStmt":     true,
+	"VacuumStmt":       true,
+	"ExplainStmt":      true,
+	"CheckPointStmt":   true,
+	"DiscardStmt":      true,
+}
+
+// snippet shortens a statement to one line for reports.
+func snippet(sql string) string {
+	const maxLen = 80
+	s := strings.Join(strings.Fields(sql), " ")
+	if len(s) > maxLen {
+		s = s[:maxLen-3] + "..."
+	}
+	return s
+}
+
+// report records a diagnostic for the statement ApplySQL is replaying.
+func (s *Schema) report(level Level, format string, args ...any) {
+	d := s.current
+	d.Level = level
+	d.Message = fmt.Sprintf(format, args...)
+	s.Diagnostics = append(s.Diagnostics, d)
+}
@@ -0,0 +1,167 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplySQLDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	type diag struct {
+		statement int
+		kind      string
+		level     Level
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want []diag
+	}{
+		{
+			name: "supported DDL",
+			sql:  "create table t (id int primary key);\ncreate index t_id on t (id);\nalter table t add column x int;",
+		},
+		{
+			name: "statements that do not change the schema",
+			sql:  "begin;\ncreate table t (id int);\ninsert into t values (1);\nset search_path = public;\ncommit;",
+			want: []diag{
+				{1, "TransactionStmt", LevelIgnored},
+				{3, "InsertStmt", LevelIgnored},
+				{4, "VariableSetStmt", LevelIgnored},
+				{5, "TransactionStmt", LevelIgnored},
+			},
+		},
+		{
+			name: "unsupported statement kinds",
+			sql:  "create domain d as int;\ngrant select on t to reader;\ncreate table t2 as select 1;",
+			want: []diag{
+				{1, "CreateDomainStmt", LevelUnsupported},
+				{2, "GrantStmt", LevelUnsupported},
+				{3, "CreateTableAsStmt", LevelUnsupported},
+			},
+		},
+		{
+			name: "unsupported parts of supported statements",
+			sql: `create table t (id int, p int references t (id) deferrable, exclude using gist (id with =));
+alter table t set (fillfactor = 70), add column x int;
+drop domain d;
+comment on index t_id is 'x';
+alter view v rename to w;`,
+			want: []diag{
+				{1, "CreateStmt", LevelUnsupported},
+				{1, "CreateStmt", LevelUnsupported},
+				{2, "AlterTableStmt", LevelUnsupported},
+				{3, "DropStmt", LevelUnsupported},
+				{4, "CommentStmt", LevelUnsupported},
+				{5, "RenameStmt", LevelUnsupported},
+			},
+		},
+		{
+			name: "objects from outside the migrations",
+			sql:  "alter type outside add value 'x';\nalter sequence users_id_seq restart with 100;\nalter table outside add column x int;",
+			want: []diag{
+				{1, "AlterEnumStmt", LevelIgnored},
+				{2, "AlterSeqStmt", LevelIgnored},
+				{3, "AlterTableStmt", LevelIgnored},
+			},
+		},
+		{
+			name: "alter statements on other relations",
+			sql: `create table t (v int);
+create index t_v_idx on t (v);
+create view vv as select v from t;
+alter index t_v_idx set (fillfactor = 70);
+alter view vv owner to reader;`,
+			want: []diag{
+				{4, "AlterTableStmt", LevelUnsupported},
+				{5, "AlterTableStmt", LevelUnsupported},
+			},
+		},
+		{
+			name: "views a column rename cannot rewrite",
+			sql: `create table t (id int, b int);
+create view vall as select * from t;
+create view vext as select b from t, ext.things;
+create view vid as select id from t;
+alter table t rename column b to bee;`,
+			want: []diag{
+				{5, "RenameStmt", LevelUnsupported},
+				{5, "RenameStmt", LevelUnsupported},
+			},
+		},
+		{
+			name: "syntax error",
+			sql:  "create table a (id int);\ncreate tabel b (id int);\ncreate table c (id int);",
+			want: []diag{{2, "ParseError", LevelError}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("001.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			var got []diag
+			for _, d := range s.Diagnostics {
+				if d.File != "001.up.sql" || d.Message == "" || d.SQL == "" {
+					t.Fatalf("incomplete diagnostic %+v", d)
+				}
+				got = append(got, diag{d.Statement, d.Kind, d.Level})
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("Diagnostics = %+v, want %+v", s.Diagnostics, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("Diagnostics[%d] = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSyntaxErrorKeepsReplaying(t *testing.T) {
+	t.Parallel()
+
+	s := NewSchema()
+	if err := s.ApplySQL("001.up.sql", "create table a (id int);\ncreate tabel b (id int);\ncreate table c (id int);"); err != nil {
+		t.Fatalf("ApplySQL error = %v", err)
+	}
+	if _, ok := s.Tables["c"]; !ok {
+		t.Fatalf("table after the syntax error was not replayed: %v", s.Tables)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Parallel()
+
+	diags := Diagnostics{
+		{File: "002.up.sql", Statement: 1, Kind: "InsertStmt", Level: LevelIgnored, Message: "does not change the schema", SQL: "insert into t values (1)"},
+		{File: "001.up.sql", Statement: 3, Kind: "GrantStmt", Level: LevelUnsupported, Message: "statement is not replayed", SQL: "grant select on t to r"},
+		{File: "001.up.sql", Statement: 2, Kind: "ParseError", Level: LevelError, Message: "failed to parse: syntax error"},
+		{File: "002.up.sql", Statement: 4, Kind: "GrantStmt", Level: LevelUnsupported, Message: "statement is not replayed", SQL: "grant all on t to r"},
+	}
+	var b strings.Builder
+	if err := diags.WriteReport(&b); err != nil {
+		t.Fatalf("WriteReport error = %v", err)
+	}
+	want := `error: ParseError (1)
+  001.up.sql #2: failed to parse: syntax error
+unsupported: GrantStmt (2)
+  001.up.sql #3: statement is not replayed: grant select on t to r
+  002.up.sql #4: statement is not replayed: grant all on t to r
+ignored: InsertStmt (1)
+  002.up.sql #1: does not change the schema: insert into t values (1)
+`
+	if b.String() != want {
+		t.Fatalf("WriteReport() =\n%s\nwant\n%s", b.String(), want)
+	}
+	if got := len(diags.Failing()); got != 3 {
+		t.Fatalf("Failing() has %d diagnostics, want 3", got)
+	}
+}
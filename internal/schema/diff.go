@@ -0,0 +1,343 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Diffing two schemas into the statements of a migration. Schemas, tables,
+// columns, constraints, indexes and comments are compared; other objects are
+// not.
+// Constraints and indexes are matched by name, so a changed definition is
+// dropped and created again, and renamed columns show up as a dropped and an
+// added column.
+
+// DiffOptions controls DiffSources.
+type DiffOptions struct {
+	// SchemaFilter, Rules and Strict apply to both sides as in SquashOptions.
+	SchemaFilter []string
+	Rules        *Rules
+	Strict       bool
+}
+
+// DiffSources replays from and to, each a migrations directory or a SQL
+// file, and returns the up and down migrations between them along with the
+// statements either replay skipped.
+func DiffSources(from, to string, opts DiffOptions) (up, down string, diags Diagnostics, err error) {
+	var schemas [2]*Schema
+	for i, path := range []string{from, to} {
+		s, err := LoadSource(path)
+		if err != nil {
+			return "", "", diags, err
+		}
+		diags = append(diags, s.Diagnostics...)
+		if err := s.prepare(opts.SchemaFilter, opts.Rules, opts.Strict); err != nil {
+			return "", "", diags, fmt.Errorf("%s: %w", path, err)
+		}
+		schemas[i] = s
+	}
+	return RenderMigration(Diff(schemas[0], schemas[1])), RenderMigration(Diff(schemas[1], schemas[0])), diags, nil
+}
+
+// Diff returns the statements that turn the schema from into to. The
+// statements of the down migration are Diff(to, from).
+func Diff(from, to *Schema) []string {
+	var (
+		dropFKs, dropIndexes, dropConstraints, dropTables []string
+		dropSchemas, createSchemas, createTables          []string
+		alterColumns, addConstraints, addFKs              []string
+		createIndexes, comments                           []string
+	)
+
+	oldSchemas, newSchemas := map[string]bool{}, map[string]bool{}
+	for _, name := range from.schemaNames() {
+		oldSchemas[name] = true
+	}
+	for _, name := range to.schemaNames() {
+		newSchemas[name] = true
+		if !oldSchemas[name] {
+			createSchemas = append(createSchemas, fmt.Sprintf("create schema %s;", pqQuoteIdent(name)))
+		}
+	}
+	for _, name := range from.schemaNames() {
+		if !newSchemas[name] {
+			dropSchemas = append(dropSchemas, fmt.Sprintf("drop schema %s;", pqQuoteIdent(name)))
+		}
+	}
+
+	var dropped []string
+	for _, key := range sortedKeys(from.Tables) {
+		if _, ok := to.Tables[key]; !ok {
+			t := from.Tables[key]
+			dropped = append(dropped, pqQuoteQualified(t.Schema, t.Name))
+		}
+	}
+	if len(dropped) > 0 {
+		// one statement, so tables referencing each other drop together
+		dropTables = append(dropTables, fmt.Sprintf("drop table %s;", strings.Join(dropped, ", ")))
+	}
+
+	for _, key := range sortedKeys(to.Tables) {
+		t := to.Tables[key]
+		old, ok := from.Tables[key]
+		if !ok {
+			var b strings.Builder
+			writeTable(&b, t, nil)
+			createTables = append(createTables, strings.TrimSuffix(b.String(), "\n"))
+			for _, fk := range t.FKs {
+				addFKs = append(addFKs, addConstraintSQL(t, t.fkName(fk), fk.sql()))
+			}
+			for _, ix := range t.Indexes {
+				createIndexes = append(createIndexes, ix.sql(t))
+			}
+			continue
+		}
+
+		table := pqQuoteQualified(t.Schema, t.Name)
+		alterColumns = append(alterColumns, diffColumns(table, old, t)...)
+		comments = append(comments, diffComments(table, old, t)...)
+
+		oldFKs, newFKs := foreignKeySQL(old), foreignKeySQL(t)
+		dropFKs = append(dropFKs, droppedConstraints(old, oldFKs, newFKs)...)
+		addFKs = append(addFKs, addedConstraints(t, oldFKs, newFKs)...)
+		oldCons, newCons := constraintDefs(old), constraintDefs(t)
+		dropConstraints = append(dropConstraints, droppedConstraints(old, oldCons, newCons)...)
+		addConstraints = append(addConstraints, addedConstraints(t, oldCons, newCons)...)
+
+		oldIndexes, newIndexes := indexSQL(old), indexSQL(t)
+		for _, name := range sortedKeys(oldIndexes) {
+			if newIndexes[name] != oldIndexes[name] {
+				dropIndexes = append(dropIndexes, fmt.Sprintf("drop index %s;", pqQuoteQualified(t.Schema, name)))
+			}
+		}
+		for _, name := range sortedKeys(newIndexes) {
+			if newIndexes[name] != oldIndexes[name] {
+				createIndexes = append(createIndexes, newIndexes[name])
+			}
+		}
+	}
+
+	// Foreign keys go first and come back last, so the keys they rely on
+	// can change in between.
+	var stmts []string
+	for _, group := range [][]string{
+		dropFKs, dropIndexes, dropConstraints, dropTables, dropSchemas,
+		createSchemas, createTables, alterColumns, addConstraints, addFKs, createIndexes, comments,
+	} {
+		stmts = append(stmts, group...)
+	}
+	return stmts
+}
+
+// diffColumns returns the ALTER TABLE statements that turn the columns of
+// from into those of to.
+func diffColumns(table string, from, to *Table) []string {
+	var stmts []string
+	alter := func(format string, args ...any) {
+		stmts = append(stmts, fmt.Sprintf("alter table %s "+format+";", append([]any{table}, args...)...))
+	}
+	for _, c := range from.Columns {
+		if _, ok := to.ColumnPos[c.Name]; !ok {
+			alter("drop column %s", pqQuoteIdent(c.Name))
+		}
+	}
+	for _, c := range to.Columns {
+		pos, ok := from.ColumnPos[c.Name]
+		if !ok {
+			alter("add column %s", c.sql())
+			continue
+		}
+		old, c := storedColumn(from, from.Columns[pos]), storedColumn(to, c)
+		col := pqQuoteIdent(c.Name)
+		// generated columns cannot be altered into place
+		if old.Generated != c.Generated {
+			alter("drop column %s", col)
+			alter("add column %s", c.sql())
+			continue
+		}
+		if canonicalType(old.Type) != canonicalType(c.Type) || old.Collation != c.Collation {
+			alter("alter column %s type %s", col, c.typeSQL())
+		}
+		if old.DefaultSQL != c.DefaultSQL {
+			if c.DefaultSQL == "" {
+				alter("alter column %s drop default", col)
+			} else {
+				alter("alter column %s set default %s", col, c.DefaultSQL)
+			}
+		}
+		if oldIdentity, identity := identitySQL(old), identitySQL(c); oldIdentity != identity {
+			if oldIdentity != "" {
+				alter("alter column %s drop identity", col)
+			}
+			if identity != "" {
+				alter("alter column %s add %s", col, identity)
+			}
+		}
+		if old.NotNull != c.NotNull {
+			if c.NotNull {
+				alter("alter column %s set not null", col)
+			} else {
+				alter("alter column %s drop not null", col)
+			}
+		}
+	}
+	return stmts
+}
+
+// serialTypes maps the serial pseudo-types to the integer types of their columns.
+var serialTypes = map[string]string{
+	"smallserial": "smallint", "serial2": "smallint",
+	"serial": "integer", "serial4": "integer",
+	"bigserial": "bigint", "serial8": "bigint",
+}
+
+// typeNames maps the names of built-in types to their internal names, which
+// canonicalType compares.
+var typeNames = map[string]string{
+	"integer": "int4", "int": "int4", "smallint": "int2", "bigint": "int8",
+	"real": "float4", "double precision": "float8", "boolean": "bool",
+	"decimal": "numeric", "character varying": "varchar", "character": "char",
+	"bit varying": "varbit",
+}
+
+// timeZoneRe matches the SQL spellings of the time and timestamp types.
+var timeZoneRe = regexp.MustCompile(`^(timestamp|time)(\(\d+\))? (with|without) time zone`)
+
+// canonicalType spells typ by internal names, so the names a migration
+// uses and those pg_dump prints, like timestamptz and timestamp with time
+// zone, compare equal.
+func canonicalType(typ string) string {
+	typ = strings.Replace(typ, " (", "(", 1)
+	typ = timeZoneRe.ReplaceAllStringFunc(typ, func(m string) string {
+		sub := timeZoneRe.FindStringSubmatch(m)
+		if sub[3] == "with" {
+			return sub[1] + "tz" + sub[2]
+		}
+		return sub[1] + sub[2]
+	})
+	base, rest := typ, ""
+	if i := strings.IndexAny(typ, "(["); i >= 0 {
+		base, rest = typ[:i], typ[i:]
+	}
+	if name, ok := typeNames[base]; ok {
+		base = name
+	}
+	return base + rest
+}
+
+// nextvalRe matches a sequence default, with or without the regclass cast.
+var nextvalRe = regexp.MustCompile(`^nextval\('([^']+)'(?:::regclass)?\)$`)
+
+// storedColumn returns the column c of t as Postgres stores it, so that
+// spellings of the same column compare equal: a serial is an integer column
+// defaulting to its sequence, and sequence defaults are cast to regclass
+// and name sequences in public unqualified.
+func storedColumn(t *Table, c Column) Column {
+	if typ, ok := serialTypes[c.Type]; ok && c.DefaultSQL == "" {
+		seq := qualifiedKey(t.Schema, makeObjectName(t.Name, c.Name, "seq"))
+		c.Type, c.DefaultSQL, c.NotNull = typ, fmt.Sprintf("nextval(%s)", quoteLiteral(seq)), true
+	}
+	if m := nextvalRe.FindStringSubmatch(c.DefaultSQL); m != nil {
+		c.DefaultSQL = fmt.Sprintf("nextval(%s::regclass)", quoteLiteral(strings.TrimPrefix(m[1], "public.")))
+	}
+	return c
+}
+
+func identitySQL(c Column) string {
+	if c.Identity == nil {
+		return ""
+	}
+	return c.Identity.sql()
+}
+
+// diffComments returns the COMMENT statements that turn the comments of
+// from into those of to.
+func diffComments(table string, from, to *Table) []string {
+	var stmts []string
+	comment := func(target, old, text string) {
+		if old == text {
+			return
+		}
+		literal := "null"
+		if text != "" {
+			literal = quoteLiteral(text)
+		}
+		stmts = append(stmts, fmt.Sprintf("comment on %s is %s;", target, literal))
+	}
+	comment("table "+table, from.Comment, to.Comment)
+	for _, c := range to.Columns {
+		old := ""
+		if pos, ok := from.ColumnPos[c.Name]; ok {
+			old = from.Columns[pos].Comment
+		}
+		comment(fmt.Sprintf("column %s.%s", table, pqQuoteIdent(c.Name)), old, c.Comment)
+	}
+	return stmts
+}
+
+// constraintDefs maps the names of the primary key, unique and check
+// constraints of t to their definitions.
+func constraintDefs(t *Table) map[string]string {
+	defs := map[string]string{}
+	if len(t.PK) > 0 {
+		defs[t.pkName()] = t.pkSQL()
+	}
+	for _, uc := range t.UniqueCons {
+		defs[t.uniqueName(uc)] = uc.sql()
+	}
+	for _, ck := range t.Checks {
+		defs[t.checkName(ck)] = ck.sql()
+	}
+	return defs
+}
+
+// foreignKeySQL maps the names of the foreign keys of t to their definitions.
+func foreignKeySQL(t *Table) map[string]string {
+	defs := map[string]string{}
+	for _, fk := range t.FKs {
+		defs[t.fkName(fk)] = fk.sql()
+	}
+	return defs
+}
+
+// indexSQL maps the names of the indexes of t to their CREATE INDEX statements.
+func indexSQL(t *Table) map[string]string {
+	stmts := map[string]string{}
+	for _, ix := range t.Indexes {
+		stmts[ix.Name] = ix.sql(t)
+	}
+	return stmts
+}
+
+func droppedConstraints(t *Table, from, to map[string]string) []string {
+	var stmts []string
+	for _, name := range sortedKeys(from) {
+		if to[name] != from[name] {
+			stmts = append(stmts, fmt.Sprintf("alter table %s drop constraint %s;", pqQuoteQualified(t.Schema, t.Name), pqQuoteIdent(name)))
+		}
+	}
+	return stmts
+}
+
+func addedConstraints(t *Table, from, to map[string]string) []string {
+	var stmts []string
+	for _, name := range sortedKeys(to) {
+		if to[name] != from[name] {
+			stmts = append(stmts, addConstraintSQL(t, name, to[name]))
+		}
+	}
+	return stmts
+}
+
+func addConstraintSQL(t *Table, name, def string) string {
+	return fmt.Sprintf("alter table %s add %s;", pqQuoteQualified(t.Schema, t.Name), constraintSQL(name, def))
+}
+
+// RenderMigration joins statements into the contents of a migration file.
+func RenderMigration(stmts []string) string {
+	if len(stmts) == 0 {
+		return ""
+	}
+	return strings.Join(stmts, "\n") + "\n"
+}
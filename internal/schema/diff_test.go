@@ -0,0 +1,269 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string // in this order
+	}{
+		{
+			name: "no changes",
+			from: "create table t (id int primary key, name text);",
+			to:   "create table t (id int primary key, name text);",
+		},
+		{
+			name: "new and dropped tables",
+			from: "create table a (id int primary key);\ncreate table old (id int);",
+			to: `create table a (id int primary key);
+create table b (id int primary key, a_id int references a (id));
+create index b_a on b (a_id);`,
+			want: []string{
+				"drop table old;",
+				"create table b (\n    id integer not null,\n    a_id integer,\n    primary key (id)\n);",
+				"alter table b add constraint b_a_id_fkey foreign key (a_id) references a (id) on delete no action on update no action;",
+				"create index b_a     on b (a_id);",
+			},
+		},
+		{
+			name: "new and dropped schemas",
+			from: "create schema old;\ncreate table old.t (id int);",
+			to:   "create table app.t (id int);",
+			want: []string{
+				"drop table old.t;",
+				"drop schema old;",
+				"create schema app;",
+				"create table app.t (\n    id integer\n);",
+			},
+		},
+		{
+			name: "columns",
+			from: "create table t (a int, b text, c int not null, d text default 'x', e int);",
+			to:   "create table t (a bigint, b text not null, c int, d text, f numeric(10,2) default 0);",
+			want: []string{
+				"alter table t drop column e;",
+				"alter table t alter column a type bigint;",
+				"alter table t alter column b set not null;",
+				"alter table t alter column c drop not null;",
+				"alter table t alter column d drop default;",
+				"alter table t add column f numeric(10, 2) default 0;",
+			},
+		},
+		{
+			name: "collations",
+			from: `create table t (a text collate "C", b text, c text collate "C");`,
+			to:   `create table t (a text, b text collate "C", c text collate "C");`,
+			want: []string{
+				"alter table t alter column a type text;",
+				`alter table t alter column b type text collate "C";`,
+			},
+		},
+		{
+			name: "constraints and indexes",
+			from: `create table p (id int primary key);
+create table t (id int primary key, p_id int references p (id), n int check (n > 0), code text unique);
+create index t_n on t (n);`,
+			to: `create table p (id int primary key);
+create table t (id int primary key, p_id int references p (id) on delete cascade, n int check (n >= 0), code text);
+create index t_n on t (n) where n > 10;
+create index t_code on t using gin (code);`,
+			want: []string{
+				"alter table t drop constraint t_p_id_fkey;",
+				"drop index t_n;",
+				"alter table t drop constraint t_code_key;",
+				"alter table t drop constraint t_n_check;",
+				"alter table t add constraint t_n_check check (n >= 0);",
+				"alter table t add constraint t_p_id_fkey foreign key (p_id) references p (id) on delete cascade on update no action;",
+				"create index t_code     on t using gin (code);",
+				"create index t_n     on t (n) where n > 10;",
+			},
+		},
+		{
+			name: "comments",
+			from: "create table t (a int);\ncomment on column t.a is 'old';",
+			to:   "create table t (a int);\ncomment on table t is 'Things';",
+			want: []string{"comment on table t is 'Things';", "comment on column t.a is null;"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			from, to := diffTestSchema(t, tc.from), diffTestSchema(t, tc.to)
+			up := Diff(from, to)
+			if strings.Join(up, "\n") != strings.Join(tc.want, "\n") {
+				t.Fatalf("Diff() =\n%s\nwant\n%s", strings.Join(up, "\n"), strings.Join(tc.want, "\n"))
+			}
+
+			// applying up to from gives to, and down takes it back
+			down := Diff(to, from)
+			for _, step := range []struct {
+				name        string
+				start, want string
+				stmts       []string
+			}{
+				{"up", tc.from, tc.to, up},
+				{"down", tc.to, tc.from, down},
+			} {
+				got, want := diffTestSchema(t, step.start+"\n"+RenderMigration(step.stmts)), diffTestSchema(t, step.want)
+				// the migration names the constraints it adds
+				for _, s := range []*Schema{got, want} {
+					for _, table := range s.Tables {
+						table.nameConstraints()
+					}
+				}
+				if g, w := got.RenderDDL(true, false), want.RenderDDL(true, false); g != w {
+					t.Errorf("%s migration gives\n%s\nwant\n%s", step.name, g, w)
+				}
+			}
+		})
+	}
+}
+
+func diffTestSchema(t *testing.T, sql string) *Schema {
+	t.Helper()
+	s := NewSchema()
+	if err := s.ApplySQL("test.up.sql", sql); err != nil {
+		t.Fatalf("ApplySQL error = %v", err)
+	}
+	if failing := s.Diagnostics.Failing(); len(failing) > 0 {
+		t.Fatalf("unexpected diagnostics: %+v", failing)
+	}
+	s.Normalize(nil)
+	return s
+}
+
+func TestDiffEquivalentColumns(t *testing.T) {
+	t.Parallel()
+
+	from := diffTestSchema(t, "create table app.t (a int4, b timestamptz(3), c serial, d bigserial, e bool[], f varchar(10), g int default nextval('app.s'));")
+	to := diffTestSchema(t, `create table app.t (a integer, b timestamp(3) with time zone, c integer not null default nextval('app.t_c_seq'::regclass),
+d bigint default nextval('app.t_d_seq'::regclass) not null, e boolean[], f character varying(10), g int default nextval('app.s'::regclass));`)
+	if stmts := Diff(from, to); len(stmts) > 0 {
+		t.Errorf("Diff() = %q, want no statements", stmts)
+	}
+}
+
+// diffTestDump is a pg_dump --schema-only of the migrations in
+// TestDiffSources with an added users.bio column.
+const diffTestDump = `SET statement_timeout = 0;
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE TABLE public.posts (
+    id bigint NOT NULL,
+    user_id integer NOT NULL,
+    title character varying(200)
+);
+
+ALTER TABLE public.posts OWNER TO postgres;
+
+ALTER TABLE public.posts ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY (
+    SEQUENCE NAME public.posts_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    name text,
+    email text,
+    created_at timestamp with time zone DEFAULT now(),
+    bio text,
+    CONSTRAINT users_name_check CHECK ((length(name) > 0))
+);
+
+ALTER TABLE public.users OWNER TO postgres;
+
+CREATE SEQUENCE public.users_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.users_id_seq OWNER TO postgres;
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+
+ALTER TABLE ONLY public.posts
+    ADD CONSTRAINT posts_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+CREATE INDEX posts_user_id_idx ON public.posts USING btree (user_id);
+
+ALTER TABLE ONLY public.posts
+    ADD CONSTRAINT posts_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE;`
+
+func TestDiffSources(t *testing.T) {
+	t.Parallel()
+
+	dir := writeMigrations(t, map[string]string{
+		"000001_init.up.sql": `create table users (id serial primary key, name text check (length(name) > 0), email text unique, created_at timestamptz default now());
+create table posts (id bigint generated by default as identity primary key, user_id int not null references users (id) on delete cascade, title varchar(200));
+create index on posts (user_id);`,
+	})
+	dump := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(dump, []byte(diffTestDump), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	up, down, _, err := DiffSources(dir, dump, DiffOptions{})
+	if err != nil {
+		t.Fatalf("DiffSources error = %v", err)
+	}
+	if want := "alter table users add column bio text;\n"; up != want {
+		t.Errorf("up =\n%swant\n%s", up, want)
+	}
+	if want := "alter table users drop column bio;\n"; down != want {
+		t.Errorf("down =\n%swant\n%s", down, want)
+	}
+}
+
+func TestWriteMigration(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"0009_a.up.sql", "0009_a.down.sql", "0010_b.up.sql", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upPath, downPath, err := WriteMigration(dir, "Add users!", "up\n", "down\n")
+	if err != nil {
+		t.Fatalf("WriteMigration error = %v", err)
+	}
+	if want := filepath.Join(dir, "0011_add_users_.up.sql"); upPath != want {
+		t.Errorf("up path = %s, want %s", upPath, want)
+	}
+	if want := filepath.Join(dir, "0011_add_users_.down.sql"); downPath != want {
+		t.Errorf("down path = %s, want %s", downPath, want)
+	}
+	if got, err := os.ReadFile(downPath); err != nil || string(got) != "down\n" {
+		t.Errorf("down file = %q, %v", got, err)
+	}
+
+	if got, err := NextMigration(t.TempDir(), "init"); err != nil || got != "000001_init" {
+		t.Errorf("NextMigration(empty dir) = %q, %v, want 000001_init", got, err)
+	}
+}
@@ -0,0 +1,327 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of Squash besides DDL: the model as data, Go structs, and
+// entity-relationship diagrams of the foreign keys.
+const (
+	FormatDDL     = "ddl"
+	FormatJSON    = "json"
+	FormatYAML    = "yaml"
+	FormatGo      = "go"
+	FormatMermaid = "mermaid"
+	FormatDot     = "dot"
+)
+
+// Formats lists the output formats Render accepts.
+var Formats = []string{FormatDDL, FormatJSON, FormatYAML, FormatGo, FormatMermaid, FormatDot}
+
+// Render renders the schema in one of Formats; an empty format is DDL.
+func (s *Schema) Render(format string, opts SquashOptions) (string, error) {
+	switch format {
+	case "", FormatDDL:
+		return s.RenderDDL(opts.IncludeIndexes, opts.SeparateFKs), nil
+	case FormatJSON:
+		return s.RenderJSON()
+	case FormatYAML:
+		return s.RenderYAML()
+	case FormatGo:
+		return s.RenderGo(opts.GoPackage)
+	case FormatMermaid:
+		return s.RenderMermaid(), nil
+	case FormatDot:
+		return s.RenderDot(), nil
+	}
+	return "", fmt.Errorf("unknown format %q: want one of %s", format, strings.Join(Formats, ", "))
+}
+
+func (s *Schema) RenderJSON() (string, error) {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func (s *Schema) RenderYAML() (string, error) {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// RenderGo renders a Go struct with db tags for every table, in package pkg.
+// Nullable columns are pointers; partitions share their parent's struct.
+func (s *Schema) RenderGo(pkg string) (string, error) {
+	if pkg == "" {
+		pkg = "models"
+	}
+	imports := map[string]bool{}
+	var body strings.Builder
+	for _, key := range sortedKeys(s.Tables) {
+		t := s.Tables[key]
+		if t.PartitionOf != nil {
+			continue
+		}
+		name := goName(t.Name)
+		if t.Schema != "" && t.Schema != "public" {
+			name = goName(t.Schema) + name
+		}
+		fmt.Fprintf(&body, "\n// %s is a row of %s.\n", name, qualifiedKey(t.Schema, t.Name))
+		if t.Comment != "" {
+			fmt.Fprintf(&body, "//\n// %s\n", strings.ReplaceAll(t.Comment, "\n", "\n// "))
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", name)
+		for _, c := range t.Columns {
+			typ, imp := goType(c)
+			if imp != "" {
+				imports[imp] = true
+			}
+			fmt.Fprintf(&body, "\t%s %s `db:%q`", goName(c.Name), typ, c.Name)
+			if c.Comment != "" {
+				fmt.Fprintf(&body, " // %s", strings.ReplaceAll(c.Comment, "\n", " "))
+			}
+			body.WriteString("\n")
+		}
+		body.WriteString("}\n")
+	}
+
+	var b strings.Builder
+	b.WriteString("// Code generated by gallium schema squash. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n", pkg)
+	if len(imports) > 0 {
+		b.WriteString("\nimport (\n")
+		for _, imp := range sortedKeys(imports) {
+			fmt.Fprintf(&b, "\t%q\n", imp)
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString(body.String())
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return "", fmt.Errorf("failed to format Go source: %w", err)
+	}
+	return string(src), nil
+}
+
+// goInitialisms are written in upper case in Go names, as golint wants.
+var goInitialisms = map[string]bool{
+	"api": true, "db": true, "html": true, "http": true, "id": true, "ip": true,
+	"json": true, "sql": true, "ssh": true, "uid": true, "uri": true, "url": true,
+	"uuid": true, "xml": true,
+}
+
+// goName turns a SQL identifier like user_id into an exported Go name like UserID.
+func goName(ident string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(ident, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if goInitialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	name := b.String()
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "X" + name
+	}
+	return name
+}
+
+// typmodRe matches the modifiers of a type, like (10, 2) in numeric(10, 2).
+var typmodRe = regexp.MustCompile(`\s*\([^)]*\)`)
+
+// baseType returns a column type without its modifiers or array brackets,
+// and whether it is an array.
+func baseType(typ string) (string, bool) {
+	typ = typmodRe.ReplaceAllString(typ, "")
+	array := false
+	if i := strings.Index(typ, "["); i >= 0 {
+		typ, array = typ[:i], true
+	}
+	return strings.TrimSpace(typ), array
+}
+
+// goType maps the column c to a Go type and the package it needs, if any.
+func goType(c Column) (string, string) {
+	base, array := baseType(c.Type)
+	var typ, imp string
+	switch base {
+	case "smallint", "int2", "smallserial", "serial2":
+		typ = "int16"
+	case "integer", "int", "int4", "serial", "serial4":
+		typ = "int32"
+	case "bigint", "int8", "bigserial", "serial8":
+		typ = "int64"
+	case "real", "float4":
+		typ = "float32"
+	case "double precision", "float8", "float":
+		typ = "float64"
+	case "boolean", "bool":
+		typ = "bool"
+	case "bytea":
+		typ = "[]byte"
+	case "json", "jsonb":
+		typ, imp = "json.RawMessage", "encoding/json"
+	case "date", "timestamp", "timestamptz", "timestamp with time zone", "timestamp without time zone",
+		"time", "timetz", "time with time zone", "time without time zone":
+		typ, imp = "time.Time", "time"
+	default:
+		// text, character types, numeric (kept exact), uuid, enums and
+		// anything else drivers scan as text
+		typ = "string"
+	}
+	if array {
+		return "[]" + typ, imp
+	}
+	// nullable columns, except those whose type already has a nil value
+	if !c.NotNull && !strings.HasPrefix(typ, "[]") && typ != "json.RawMessage" {
+		typ = "*" + typ
+	}
+	return typ, imp
+}
+
+// erEntity names a table in a diagram.
+func erEntity(t *Table) string {
+	name := t.Name
+	if t.Schema != "" && t.Schema != "public" {
+		name = t.Schema + "." + t.Name
+	}
+	return name
+}
+
+// erTables returns the tables to draw; partitions are left out.
+func (s *Schema) erTables() []*Table {
+	var tables []*Table
+	for _, key := range sortedKeys(s.Tables) {
+		if t := s.Tables[key]; t.PartitionOf == nil {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// keyMarks returns the PK, FK and UK marks of each column of t.
+func keyMarks(t *Table) map[string][]string {
+	marks := map[string][]string{}
+	add := func(cols []string, mark string) {
+		for _, c := range cols {
+			if !containsString(marks[c], mark) {
+				marks[c] = append(marks[c], mark)
+			}
+		}
+	}
+	add(t.PK, "PK")
+	for _, fk := range t.FKs {
+		add(fk.Columns, "FK")
+	}
+	for _, uc := range t.UniqueCons {
+		add(uc.Columns, "UK")
+	}
+	return marks
+}
+
+// mermaidWordRe matches what mermaid does not allow in names and types.
+var mermaidWordRe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// RenderMermaid renders a mermaid erDiagram of the tables and their foreign keys.
+func (s *Schema) RenderMermaid() string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	entity := func(t *Table) string { return mermaidWordRe.ReplaceAllString(erEntity(t), "_") }
+	tables := s.erTables()
+	for _, t := range tables {
+		marks := keyMarks(t)
+		fmt.Fprintf(&b, "    %s {\n", entity(t))
+		for _, c := range t.Columns {
+			base, array := baseType(c.Type)
+			typ := mermaidWordRe.ReplaceAllString(base, "_")
+			if array {
+				typ += "_array"
+			}
+			fmt.Fprintf(&b, "        %s %s", typ, mermaidWordRe.ReplaceAllString(c.Name, "_"))
+			if m := marks[c.Name]; len(m) > 0 {
+				fmt.Fprintf(&b, " %s", strings.Join(m, ", "))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, t := range tables {
+		t.sortFKs()
+		for _, fk := range t.FKs {
+			ref, ok := s.Tables[qualifiedKey(fk.RefSchema, fk.RefTable)]
+			if !ok {
+				continue
+			}
+			// many rows reference one; optional when a column may be null
+			parent := "||"
+			for _, col := range fk.Columns {
+				if pos, ok := t.ColumnPos[col]; ok && !t.Columns[pos].NotNull {
+					parent = "o|"
+				}
+			}
+			fmt.Fprintf(&b, "    %s }o--%s %s : %q\n", entity(t), parent, entity(ref), strings.Join(fk.Columns, ", "))
+		}
+	}
+	return b.String()
+}
+
+// RenderDot renders a Graphviz digraph of the tables and their foreign keys.
+func (s *Schema) RenderDot() string {
+	var b strings.Builder
+	b.WriteString("digraph schema {\n")
+	b.WriteString("    rankdir=LR;\n")
+	b.WriteString("    node [shape=record, fontname=\"Helvetica\"];\n")
+	tables := s.erTables()
+	for _, t := range tables {
+		marks := keyMarks(t)
+		var fields []string
+		for _, c := range t.Columns {
+			field := c.Name + " : " + c.Type
+			if m := marks[c.Name]; len(m) > 0 {
+				field += " (" + strings.Join(m, ", ") + ")"
+			}
+			fields = append(fields, dotEscape(field)+"\\l")
+		}
+		fmt.Fprintf(&b, "    %q [label=\"{%s|%s}\"];\n", erEntity(t), dotEscape(erEntity(t)), strings.Join(fields, ""))
+	}
+	for _, t := range tables {
+		t.sortFKs()
+		for _, fk := range t.FKs {
+			if _, ok := s.Tables[qualifiedKey(fk.RefSchema, fk.RefTable)]; !ok {
+				continue
+			}
+			ref := fk.RefTable
+			if fk.RefSchema != "" && fk.RefSchema != "public" {
+				ref = fk.RefSchema + "." + fk.RefTable
+			}
+			fmt.Fprintf(&b, "    %q -> %q [label=%q];\n", erEntity(t), ref, strings.Join(fk.Columns, ", "))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotEscape escapes the characters that structure record labels.
+func dotEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`{}|<>"\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,152 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const exportTestSQL = `create type mood as enum ('ok', 'meh');
+create table users (id bigint generated always as identity primary key, email text not null unique, mood mood, tags text[], profile jsonb, created_at timestamptz not null default now());
+comment on table users is 'People';
+create table app.posts (id serial primary key, user_id bigint not null references users (id) on delete cascade, editor_id bigint references users (id), price numeric(10,2), body bytea);
+create index posts_user on app.posts (user_id);`
+
+func exportTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	s := NewSchema()
+	if err := s.ApplySQL("test.up.sql", exportTestSQL); err != nil {
+		t.Fatalf("ApplySQL error = %v", err)
+	}
+	s.Normalize(nil)
+	return s
+}
+
+func TestRenderFormats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format string
+		want   []string // in this order
+	}{
+		{
+			format: FormatGo,
+			want: []string{
+				"// Code generated by gallium schema squash. DO NOT EDIT.\n\npackage models\n",
+				"import (\n\t\"encoding/json\"\n\t\"time\"\n)\n",
+				"// AppPosts is a row of app.posts.\ntype AppPosts struct {\n",
+				"\tID       int32   `db:\"id\"`\n",
+				"\tUserID   int64   `db:\"user_id\"`\n",
+				"\tEditorID *int64  `db:\"editor_id\"`\n",
+				"\tPrice    *string `db:\"price\"`\n",
+				"\tBody     []byte  `db:\"body\"`\n",
+				"// Users is a row of users.\n//\n// People\ntype Users struct {\n",
+				"\tEmail     string          `db:\"email\"`\n",
+				"\tMood      *string         `db:\"mood\"`\n",
+				"\tTags      []string        `db:\"tags\"`\n",
+				"\tProfile   json.RawMessage `db:\"profile\"`\n",
+				"\tCreatedAt time.Time       `db:\"created_at\"`\n",
+			},
+		},
+		{
+			format: FormatMermaid,
+			want: []string{
+				"erDiagram\n",
+				"    app_posts {\n        serial id PK\n        bigint user_id FK\n",
+				"        numeric price\n",
+				"    users {\n        bigint id PK\n        text email UK\n",
+				"        text_array tags\n",
+				"    app_posts }o--o| users : \"editor_id\"\n",
+				"    app_posts }o--|| users : \"user_id\"\n",
+			},
+		},
+		{
+			format: FormatDot,
+			want: []string{
+				"digraph schema {\n",
+				`    "app.posts" [label="{app.posts|id : serial (PK)\luser_id : bigint (FK)\l`,
+				`price : numeric(10, 2)\l`,
+				`    "users" [label="{users|id : bigint (PK)\lemail : text (UK)\l`,
+				`    "app.posts" -> "users" [label="editor_id"];`,
+				`    "app.posts" -> "users" [label="user_id"];`,
+				"}\n",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format, func(t *testing.T) {
+			t.Parallel()
+
+			out, err := exportTestSchema(t).Render(tc.format, SquashOptions{})
+			if err != nil {
+				t.Fatalf("Render(%s) error = %v", tc.format, err)
+			}
+			checkRendered(t, out, tc.want, nil)
+		})
+	}
+
+	if _, err := NewSchema().Render("xml", SquashOptions{}); err == nil || !strings.Contains(err.Error(), "unknown format") {
+		t.Errorf("Render(xml) error = %v, want unknown format", err)
+	}
+}
+
+func TestRenderData(t *testing.T) {
+	t.Parallel()
+
+	s := exportTestSchema(t)
+	var fromJSON, fromYAML Schema
+	out, err := s.RenderJSON()
+	if err != nil {
+		t.Fatalf("RenderJSON error = %v", err)
+	}
+	if err := json.Unmarshal([]byte(out), &fromJSON); err != nil {
+		t.Fatalf("RenderJSON output does not decode: %v", err)
+	}
+	if out, err = s.RenderYAML(); err != nil {
+		t.Fatalf("RenderYAML error = %v", err)
+	}
+	if err := yaml.Unmarshal([]byte(out), &fromYAML); err != nil {
+		t.Fatalf("RenderYAML output does not decode: %v", err)
+	}
+
+	for name, got := range map[string]Schema{"json": fromJSON, "yaml": fromYAML} {
+		posts := got.Tables["app.posts"]
+		if posts == nil || len(posts.Columns) != 5 || posts.Indexes[0].Name != "posts_user" {
+			t.Fatalf("%s: app.posts = %+v", name, posts)
+		}
+		fk := posts.FKs[0]
+		if fk.RefTable != "users" || fk.OnDelete != "CASCADE" || strings.Join(fk.Columns, ",") != "user_id" {
+			t.Errorf("%s: posts foreign key = %+v", name, fk)
+		}
+		users := got.Tables["users"]
+		if id := users.Columns[0]; id.Identity == nil || !id.Identity.Always || id.Type != "bigint" || !id.NotNull {
+			t.Errorf("%s: users.id = %+v", name, id)
+		}
+		if users.Comment != "People" || users.Columns[5].DefaultSQL != "now()" {
+			t.Errorf("%s: users = %+v", name, users)
+		}
+		if e := got.Enums["mood"]; e == nil || strings.Join(e.Values, ",") != "ok,meh" {
+			t.Errorf("%s: enum mood = %+v", name, e)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	t.Parallel()
+
+	for ident, want := range map[string]string{
+		"user_id":     "UserID",
+		"api_url":     "APIURL",
+		"createdAt":   "CreatedAt",
+		"2fa_enabled": "X2faEnabled",
+		"Weird Name":  "WeirdName",
+	} {
+		if got := goName(ident); got != want {
+			t.Errorf("goName(%q) = %q, want %q", ident, got, want)
+		}
+	}
+}
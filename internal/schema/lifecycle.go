@@ -0,0 +1,724 @@
+package schema
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Dropping and renaming tables, columns, constraints and indexes. Postgres
+// drops dependent objects along with them and names unnamed constraints and
+// indexes itself, so both are mirrored here.
+
+// maxIdentifierLen is NAMEDATALEN - 1; Postgres truncates longer names.
+const maxIdentifierLen = 63
+
+// makeObjectName builds a name the way Postgres' makeObjectName does:
+// name1_name2_label, shortening the longer of name1 and name2 until it fits.
+func makeObjectName(name1, name2, label string) string {
+	overhead := 0
+	if name2 != "" {
+		overhead++
+	}
+	if label != "" {
+		overhead += len(label) + 1
+	}
+	n1, n2 := len(name1), len(name2)
+	for n1+n2 > maxIdentifierLen-overhead {
+		if n1 > n2 {
+			n1--
+		} else {
+			n2--
+		}
+	}
+	name := name1[:n1]
+	if name2 != "" {
+		name += "_" + name2[:n2]
+	}
+	if label != "" {
+		name += "_" + label
+	}
+	return name
+}
+
+// defaultIndexName is the name Postgres gives CREATE INDEX without a name:
+// the table, the column names and "idx", with a number added to "idx" when
+// another relation in the schema already has that name.
+func (s *Schema) defaultIndexName(t *Table, params []map[string]any) string {
+	var cols []string
+	for _, p := range params {
+		ie, _ := p["IndexElem"].(map[string]any)
+		col, _ := ie["name"].(string)
+		if col == "" {
+			col = "expr"
+			if name, _ := figureColname(ie["expr"]); name != "" {
+				col = name
+			}
+		}
+		// like ChooseIndexColumnNames, number names that repeat
+		name := col
+		for i := 1; containsString(cols, name); i++ {
+			suffix := strconv.Itoa(i)
+			name = col[:min(len(col), maxIdentifierLen-len(suffix))] + suffix
+		}
+		cols = append(cols, name)
+	}
+	label := "idx"
+	for i := 1; ; i++ {
+		name := makeObjectName(t.Name, strings.Join(cols, "_"), label)
+		if !s.relationNameInUse(t.Schema, name) {
+			return name
+		}
+		label = "idx" + strconv.Itoa(i)
+	}
+}
+
+// figureColname mirrors Postgres' FigureColnameInternal, which names an
+// expression's column: a column or function by its name, a cast by its
+// argument or else its type, and a few constructs by their keyword. It
+// returns "" when Postgres has no name for the expression, and the strength
+// of the name, which lets a cast prefer its argument's.
+func figureColname(expr any) (string, int) {
+	node, _ := expr.(map[string]any)
+	last := func(list any) string {
+		names := parseStringList(list)
+		if len(names) == 0 {
+			return ""
+		}
+		return names[len(names)-1]
+	}
+	switch {
+	case node["ColumnRef"] != nil:
+		cr, _ := node["ColumnRef"].(map[string]any)
+		if name := last(cr["fields"]); name != "" {
+			return name, 2
+		}
+	case node["A_Indirection"] != nil:
+		ind, _ := node["A_Indirection"].(map[string]any)
+		if name := last(ind["indirection"]); name != "" {
+			return name, 2
+		}
+		return figureColname(ind["arg"])
+	case node["FuncCall"] != nil:
+		fc, _ := node["FuncCall"].(map[string]any)
+		if name := last(fc["funcname"]); name != "" {
+			return name, 2
+		}
+	case node["A_Expr"] != nil:
+		if ae, _ := node["A_Expr"].(map[string]any); ae["kind"] == "AEXPR_NULLIF" {
+			return "nullif", 2
+		}
+	case node["TypeCast"] != nil:
+		tc, _ := node["TypeCast"].(map[string]any)
+		name, strength := figureColname(tc["arg"])
+		if strength <= 1 {
+			if tn, ok := tc["typeName"].(map[string]any); ok {
+				return last(tn["names"]), 1
+			}
+		}
+		return name, strength
+	case node["CollateClause"] != nil:
+		cc, _ := node["CollateClause"].(map[string]any)
+		return figureColname(cc["arg"])
+	case node["CaseExpr"] != nil:
+		ce, _ := node["CaseExpr"].(map[string]any)
+		if name, strength := figureColname(ce["defresult"]); strength > 1 {
+			return name, strength
+		}
+		return "case", 1
+	case node["A_ArrayExpr"] != nil:
+		return "array", 2
+	case node["RowExpr"] != nil:
+		return "row", 2
+	case node["CoalesceExpr"] != nil:
+		return "coalesce", 2
+	case node["MinMaxExpr"] != nil:
+		switch mm, _ := node["MinMaxExpr"].(map[string]any); mm["op"] {
+		case "IS_GREATEST":
+			return "greatest", 2
+		case "IS_LEAST":
+			return "least", 2
+		}
+	}
+	return "", 0
+}
+
+// relationNameInUse reports whether a table, view, sequence or index in
+// schema, including those behind primary keys and unique constraints, is
+// called name. Postgres keeps all of them in one namespace.
+func (s *Schema) relationNameInUse(schema, name string) bool {
+	key := qualifiedKey(schema, name)
+	if s.Tables[key] != nil || s.Views[key] != nil || s.Sequences[key] != nil {
+		return true
+	}
+	for _, t := range s.Tables {
+		if t.Schema != schema {
+			continue
+		}
+		if len(t.PK) > 0 && t.pkName() == name {
+			return true
+		}
+		for _, uc := range t.UniqueCons {
+			if t.uniqueName(uc) == name {
+				return true
+			}
+		}
+		for _, ix := range t.Indexes {
+			if ix.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Constraint names, as given or as Postgres would have chosen them.
+
+func (t *Table) pkName() string {
+	if t.PKName != "" {
+		return t.PKName
+	}
+	return makeObjectName(t.Name, "", "pkey")
+}
+
+func (t *Table) uniqueName(uc UniqueConstraint) string {
+	if uc.Name != "" {
+		return uc.Name
+	}
+	return makeObjectName(t.Name, strings.Join(uc.Columns, "_"), "key")
+}
+
+func (t *Table) fkName(fk ForeignKey) string {
+	if fk.Name != "" {
+		return fk.Name
+	}
+	return makeObjectName(t.Name, strings.Join(fk.Columns, "_"), "fkey")
+}
+
+func (t *Table) checkName(ck CheckConstraint) string {
+	if ck.Name != "" {
+		return ck.Name
+	}
+	// named after the column when the expression uses exactly one
+	col := ""
+	if cols := exprColumns(ck.Expr); len(cols) == 1 {
+		col = cols[0]
+	}
+	return makeObjectName(t.Name, col, "check")
+}
+
+// nameConstraints pins the generated names of unnamed constraints, which
+// Postgres keeps when the table or its columns are renamed later.
+func (t *Table) nameConstraints() {
+	if len(t.PK) > 0 {
+		t.PKName = t.pkName()
+	}
+	for i := range t.UniqueCons {
+		t.UniqueCons[i].Name = t.uniqueName(t.UniqueCons[i])
+	}
+	for i := range t.FKs {
+		t.FKs[i].Name = t.fkName(t.FKs[i])
+	}
+	for i := range t.Checks {
+		t.Checks[i].Name = t.checkName(t.Checks[i])
+	}
+}
+
+// renameConstraint renames the constraint called oldName and reports whether there was one.
+func (t *Table) renameConstraint(oldName, newName string) bool {
+	if len(t.PK) > 0 && t.pkName() == oldName {
+		t.PKName = newName
+		return true
+	}
+	for i := range t.UniqueCons {
+		if t.uniqueName(t.UniqueCons[i]) == oldName {
+			t.UniqueCons[i].Name = newName
+			return true
+		}
+	}
+	for i := range t.FKs {
+		if t.fkName(t.FKs[i]) == oldName {
+			t.FKs[i].Name = newName
+			return true
+		}
+	}
+	for i := range t.Checks {
+		if t.checkName(t.Checks[i]) == oldName {
+			t.Checks[i].Name = newName
+			return true
+		}
+	}
+	return false
+}
+
+// findIndex finds the index schema.name. Indexes live in their table's schema.
+func (s *Schema) findIndex(schema, name string) (*Table, int, bool) {
+	for _, key := range sortedKeys(s.Tables) {
+		t := s.Tables[key]
+		if t.Schema != schema {
+			continue
+		}
+		for i := range t.Indexes {
+			if t.Indexes[i].Name == name {
+				return t, i, true
+			}
+		}
+	}
+	return nil, -1, false
+}
+
+// renameIndex replays ALTER INDEX ... RENAME TO; renaming the index of a
+// primary key or unique constraint renames the constraint.
+func (s *Schema) renameIndex(schema, oldName, newName string) {
+	if t, i, ok := s.findIndex(schema, oldName); ok {
+		t.Indexes[i].Name = newName
+		return
+	}
+	for _, key := range sortedKeys(s.Tables) {
+		if t := s.Tables[key]; t.Schema == schema && t.renameConstraint(oldName, newName) {
+			return
+		}
+	}
+}
+
+// usesColumn reports whether the index covers, includes or filters on name.
+func (ix Index) usesColumn(name string) bool {
+	if containsString(ix.Include, pqQuoteIdent(name)) || containsString(exprColumns(ix.Where), name) {
+		return true
+	}
+	for _, elem := range ix.Columns {
+		used := false
+		walkIndexElem(elem, func(field map[string]any, key string) {
+			used = used || field[key] == name
+		})
+		if used {
+			return true
+		}
+	}
+	return false
+}
+
+// renameColumn rewrites the references to the column oldName in the index.
+func (ix *Index) renameColumn(oldName, newName string) {
+	for i, col := range ix.Include {
+		if col == pqQuoteIdent(oldName) {
+			ix.Include[i] = pqQuoteIdent(newName)
+		}
+	}
+	ix.Where = renameColumnInExpr(ix.Where, oldName, newName)
+	for i, elem := range ix.Columns {
+		changed := false
+		ie := walkIndexElem(elem, func(field map[string]any, key string) {
+			if field[key] == oldName {
+				field[key] = newName
+				changed = true
+			}
+		})
+		if !changed {
+			continue
+		}
+		if sql, err := indexElemSQL(ie); err == nil {
+			ix.Columns[i] = sql
+		}
+	}
+}
+
+// walkIndexElem parses a rendered index element and calls fn with the node
+// and key holding each column name it uses: the element's own name or the
+// String nodes of the column references in its expression. It returns the
+// parsed IndexElem, or nil when elem cannot be parsed.
+func walkIndexElem(elem string, fn func(field map[string]any, key string)) map[string]any {
+	tree, err := pgquery.ParseToJSON("create index on t (" + elem + ")")
+	if err != nil {
+		return nil
+	}
+	var doc struct {
+		Stmts []struct {
+			Stmt struct {
+				IndexStmt struct {
+					IndexParams []struct {
+						IndexElem map[string]any `json:"IndexElem"`
+					} `json:"indexParams"`
+				} `json:"IndexStmt"`
+			} `json:"stmt"`
+		} `json:"stmts"`
+	}
+	if err := json.Unmarshal([]byte(tree), &doc); err != nil || len(doc.Stmts) != 1 || len(doc.Stmts[0].Stmt.IndexStmt.IndexParams) != 1 {
+		return nil
+	}
+	ie := doc.Stmts[0].Stmt.IndexStmt.IndexParams[0].IndexElem
+	if _, ok := ie["name"].(string); ok {
+		fn(ie, "name")
+	}
+	walkColumnRefs(ie["expr"], func(field map[string]any) { fn(field, "sval") })
+	return ie
+}
+
+// ownedByTable splits a sequence's OWNED BY into its table and column.
+func (q *Sequence) ownedByTable() (schema, table, column string, ok bool) {
+	parts := strings.Split(q.OwnedBy, ".")
+	if q.OwnedBy == "" || len(parts) < 2 {
+		return "", "", "", false
+	}
+	schema, table = splitQualified(parts[:len(parts)-1])
+	return schema, table, parts[len(parts)-1], true
+}
+
+// dropTable drops t with its partitions, triggers, owned sequences and the
+// views that read it, and the foreign keys of other tables that reference it.
+func (s *Schema) dropTable(t *Table) {
+	key := qualifiedKey(t.Schema, t.Name)
+	if s.Tables[key] != t {
+		return
+	}
+	delete(s.Tables, key)
+
+	for _, other := range s.Tables {
+		if p := other.PartitionOf; p != nil && p.ParentSchema == t.Schema && p.Parent == t.Name {
+			s.dropTable(other)
+		}
+	}
+	for _, other := range s.Tables {
+		other.FKs = filterFKs(other.FKs, func(fk ForeignKey) bool {
+			return fk.RefSchema == t.Schema && fk.RefTable == t.Name
+		})
+	}
+	for key, tr := range s.Triggers {
+		if tr.Schema == t.Schema && tr.Table == t.Name {
+			delete(s.Triggers, key)
+		}
+	}
+	for key, q := range s.Sequences {
+		if schema, table, _, ok := q.ownedByTable(); ok && schema == t.Schema && table == t.Name {
+			delete(s.Sequences, key)
+		}
+	}
+	s.dropDependentViews(t.Schema, t.Name)
+}
+
+// dropDependentViews drops the views that read schema.name, and the views
+// that read those, as DROP ... CASCADE does.
+func (s *Schema) dropDependentViews(schema, name string) {
+	for key, v := range s.Views {
+		doc, err := parseStmtTree(v.SQL)
+		if err != nil {
+			s.report(LevelUnsupported, "view %s is kept although it may read %s, which was dropped: %v", key, qualifiedKey(schema, name), err)
+			continue
+		}
+		if len(readRelations(doc, schema, name)) > 0 {
+			delete(s.Views, key)
+			s.dropDependentViews(v.Schema, v.Name)
+		}
+	}
+}
+
+// dropColumn drops a column and, like Postgres, the indexes, constraints,
+// owned sequences and views that use it and the foreign keys that reference
+// it. Views that may use it are kept and reported.
+func (s *Schema) dropColumn(t *Table, name string) {
+	if _, ok := t.ColumnPos[name]; !ok {
+		return
+	}
+	t.dropColumn(name)
+
+	if containsString(t.PK, name) {
+		s.dropReferencingFKs(t, t.PK)
+		t.PK, t.PKName = nil, ""
+	}
+	uniques := t.UniqueCons[:0]
+	for _, uc := range t.UniqueCons {
+		if containsString(uc.Columns, name) {
+			s.dropReferencingFKs(t, uc.Columns)
+			continue
+		}
+		uniques = append(uniques, uc)
+	}
+	t.UniqueCons = uniques
+	t.FKs = filterFKs(t.FKs, func(fk ForeignKey) bool { return containsString(fk.Columns, name) })
+	checks := t.Checks[:0]
+	for _, ck := range t.Checks {
+		if !containsString(exprColumns(ck.Expr), name) {
+			checks = append(checks, ck)
+		}
+	}
+	t.Checks = checks
+	indexes := t.Indexes[:0]
+	for _, ix := range t.Indexes {
+		if !ix.usesColumn(name) {
+			indexes = append(indexes, ix)
+		}
+	}
+	t.Indexes = indexes
+	for key, q := range s.Sequences {
+		if schema, table, column, ok := q.ownedByTable(); ok && schema == t.Schema && table == t.Name && column == name {
+			delete(s.Sequences, key)
+		}
+	}
+	for key, v := range s.Views {
+		doc, err := parseStmtTree(v.SQL)
+		if err != nil {
+			s.report(LevelUnsupported, "view %s is kept although it may use %s.%s, which was dropped: %v", key, qualifiedKey(t.Schema, t.Name), name, err)
+			continue
+		}
+		u := s.newColumnUse(doc, t, name)
+		uses, uncertain := false, false
+		walkColumnRefNodes(doc, func(ref map[string]any) {
+			switch u.match(ref) {
+			case useYes:
+				uses = true
+			case useMaybe:
+				uncertain = true
+			}
+		})
+		switch {
+		case uses:
+			delete(s.Views, key)
+			s.dropDependentViews(v.Schema, v.Name)
+		case uncertain:
+			s.report(LevelUnsupported, "view %s is kept although it may use %s.%s, which was dropped", key, qualifiedKey(t.Schema, t.Name), name)
+		}
+	}
+}
+
+// Whether a column reference in a view uses a given column.
+const (
+	useNo = iota
+	useYes
+	useMaybe
+)
+
+// columnUse decides which column references of a parsed statement use a
+// column of t. The relations of all FROM clauses share one scope, so a
+// reference that could resolve to more than one of them is undecided.
+type columnUse struct {
+	t       *Table
+	column  string
+	names   []string // names the statement refers to t by
+	unknown bool     // some relation's columns are not known
+	other   bool     // another known relation has the column too
+}
+
+func (s *Schema) newColumnUse(doc any, t *Table, column string) *columnUse {
+	u := &columnUse{t: t, column: column}
+	for _, rv := range readRelations(doc, t.Schema, t.Name) {
+		name := t.Name
+		if alias, ok := rv["alias"].(map[string]any); ok {
+			name, _ = alias["aliasname"].(string)
+		}
+		u.names = append(u.names, name)
+	}
+	walkNodes(doc, func(key string, node map[string]any) {
+		switch key {
+		case "RangeVar":
+			relSchema, _ := node["schemaname"].(string)
+			relName, _ := node["relname"].(string)
+			if localSchema(relSchema) == t.Schema && relName == t.Name {
+				return
+			}
+			other, ok := s.Tables[qualifiedKey(localSchema(relSchema), relName)]
+			if !ok {
+				u.unknown = true
+			} else if _, ok := other.colIndex(column); ok {
+				u.other = true
+			}
+		case "RangeSubselect", "RangeFunction", "RangeTableFunc":
+			u.unknown = true
+		}
+	})
+	return u
+}
+
+// match reports whether the ColumnRef ref uses the column. A * expands to
+// every column of the relations it covers.
+func (u *columnUse) match(ref map[string]any) int {
+	if len(u.names) == 0 {
+		return useNo
+	}
+	fields, _ := ref["fields"].([]any)
+	if len(fields) == 0 {
+		return useNo
+	}
+	last, _ := fields[len(fields)-1].(map[string]any)
+	_, star := last["A_Star"]
+	if len(fields) > 1 {
+		qualifier, _ := fields[len(fields)-2].(map[string]any)
+		str, _ := qualifier["String"].(map[string]any)
+		if name, _ := str["sval"].(string); !containsString(u.names, name) {
+			return useNo
+		}
+		if star || columnRefName(ref) == u.column {
+			return useYes
+		}
+		return useNo
+	}
+	if !star && columnRefName(ref) != u.column {
+		return useNo
+	}
+	if star || !(u.unknown || u.other) {
+		return useYes
+	}
+	return useMaybe
+}
+
+// columnRefName is the column a ColumnRef names, or "" for a *.
+func columnRefName(ref map[string]any) string {
+	fields, _ := ref["fields"].([]any)
+	if len(fields) == 0 {
+		return ""
+	}
+	last, _ := fields[len(fields)-1].(map[string]any)
+	str, _ := last["String"].(map[string]any)
+	name, _ := str["sval"].(string)
+	return name
+}
+
+// readRelations returns the RangeVars of a parsed statement that name schema.name.
+func readRelations(doc any, schema, name string) []map[string]any {
+	var rels []map[string]any
+	walkNodes(doc, func(key string, node map[string]any) {
+		relSchema, _ := node["schemaname"].(string)
+		if key == "RangeVar" && node["relname"] == name && localSchema(relSchema) == schema {
+			rels = append(rels, node)
+		}
+	})
+	return rels
+}
+
+// walkNodes calls fn with every node of a parsed tree and the key it is under.
+func walkNodes(node any, fn func(key string, node map[string]any)) {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, v := range n {
+			if child, ok := v.(map[string]any); ok {
+				fn(key, child)
+			}
+			walkNodes(v, fn)
+		}
+	case []any:
+		for _, v := range n {
+			walkNodes(v, fn)
+		}
+	}
+}
+
+// walkColumnRefNodes calls fn with every ColumnRef of a parsed tree.
+func walkColumnRefNodes(doc any, fn func(ref map[string]any)) {
+	walkNodes(doc, func(key string, node map[string]any) {
+		if key == "ColumnRef" {
+			fn(node)
+		}
+	})
+}
+
+// dropConstraint replays ALTER TABLE ... DROP CONSTRAINT name.
+func (s *Schema) dropConstraint(t *Table, name string) {
+	if len(t.PK) > 0 && t.pkName() == name {
+		s.dropReferencingFKs(t, t.PK)
+		t.PK, t.PKName = nil, ""
+		return
+	}
+	for i, uc := range t.UniqueCons {
+		if t.uniqueName(uc) == name {
+			s.dropReferencingFKs(t, uc.Columns)
+			t.UniqueCons = append(t.UniqueCons[:i], t.UniqueCons[i+1:]...)
+			return
+		}
+	}
+	for i, fk := range t.FKs {
+		if t.fkName(fk) == name {
+			t.FKs = append(t.FKs[:i], t.FKs[i+1:]...)
+			return
+		}
+	}
+	for i, ck := range t.Checks {
+		if t.checkName(ck) == name {
+			t.Checks = append(t.Checks[:i], t.Checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// dropReferencingFKs drops the foreign keys that reference cols of t, as
+// dropping the key they rely on does with CASCADE.
+func (s *Schema) dropReferencingFKs(t *Table, cols []string) {
+	key := strings.Join(cols, ",")
+	for _, other := range s.Tables {
+		other.FKs = filterFKs(other.FKs, func(fk ForeignKey) bool {
+			if fk.RefSchema != t.Schema || fk.RefTable != t.Name {
+				return false
+			}
+			refCols := fk.RefColumns
+			if len(refCols) == 0 {
+				refCols = t.PK
+			}
+			return strings.Join(refCols, ",") == key
+		})
+	}
+}
+
+// filterFKs returns the foreign keys for which drop reports false.
+func filterFKs(fks []ForeignKey, drop func(ForeignKey) bool) []ForeignKey {
+	kept := fks[:0]
+	for _, fk := range fks {
+		if !drop(fk) {
+			kept = append(kept, fk)
+		}
+	}
+	return kept
+}
+
+// exprColumns returns the distinct columns the expression expr refers to.
+func exprColumns(expr string) []string {
+	doc, ok := parseExprTree(expr)
+	if !ok {
+		return nil
+	}
+	var cols []string
+	walkColumnRefs(doc, func(field map[string]any) {
+		if name, _ := field["sval"].(string); name != "" && !containsString(cols, name) {
+			cols = append(cols, name)
+		}
+	})
+	return cols
+}
+
+// parseExprTree parses expr as the target of a SELECT into a generic tree.
+func parseExprTree(expr string) (any, bool) {
+	if expr == "" {
+		return nil, false
+	}
+	tree, err := pgquery.ParseToJSON("select " + expr)
+	if err != nil {
+		return nil, false
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(tree), &doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// walkColumnRefs calls fn with the String node naming the column of every ColumnRef in node.
+func walkColumnRefs(node any, fn func(field map[string]any)) {
+	switch n := node.(type) {
+	case map[string]any:
+		if ref, ok := n["ColumnRef"].(map[string]any); ok {
+			if fields, ok := ref["fields"].([]any); ok && len(fields) > 0 {
+				if f, ok := fields[len(fields)-1].(map[string]any); ok {
+					if str, ok := f["String"].(map[string]any); ok {
+						fn(str)
+					}
+				}
+			}
+		}
+		for _, v := range n {
+			walkColumnRefs(v, fn)
+		}
+	case []any:
+		for _, v := range n {
+			walkColumnRefs(v, fn)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package schema
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    []string // in this order
+		notWant []string
+		reports []string // diagnostic messages
+	}{
+		{
+			name: "drop schema-qualified tables",
+			sql: `create table app.users (id int primary key);
+create table orders (id int, user_id int references app.users (id));
+create table keep (id int);
+drop table if exists app.users, orders, missing cascade;`,
+			want:    []string{"create table keep ("},
+			notWant: []string{"users", "orders"},
+		},
+		{
+			name: "public and unqualified names are the same table",
+			sql: `create table users (id int primary key);
+create table public.b (id int);
+alter table public.users add column name text;
+alter table b add column x int;
+create table orders (id int, user_id int references public.users (id));
+create index b_x on public.b (x);
+drop table public.orders;
+alter table public.b rename to c;`,
+			want: []string{
+				"create table c (\n    id integer,\n    x integer\n);",
+				"create table users (\n    id integer,\n    name text,\n    primary key (id)\n);",
+				"create index b_x     on c (x);",
+			},
+			notWant: []string{"create table b", "public.", "orders", "create table users (\n    id integer,\n    primary key"},
+		},
+		{
+			name: "schema-qualified objects keep their schema",
+			sql: `create type app.status as enum ('on', 'off');
+create sequence app.counter;
+create table app.users (id int primary key, status app.status, n int default nextval('app.counter'));
+create table users (id int primary key);
+create table app.posts (id int, user_id int references app.users (id), owner_id int references users (id));
+create index posts_user on app.posts (user_id);
+create function app.f() returns int language sql as $$ select count(*)::int from app.posts $$;
+alter table app.users rename to members;
+alter sequence app.counter owned by app.members.n;`,
+			want: []string{
+				"create type app.status as enum ('on', 'off');",
+				"create sequence app.counter;",
+				"create function app.f()",
+				"create table app.members (\n    id integer,\n    status app.status,\n    n integer default nextval('app.counter'),\n    constraint users_pkey primary key (id)\n);",
+				"create table users (\n    id integer,\n    primary key (id)\n);",
+				"create table app.posts (",
+				"    foreign key (owner_id) references users (id)",
+				"    foreign key (user_id) references app.members (id)",
+				"alter sequence app.counter owned by app.members.n;",
+				"create index posts_user     on app.posts (user_id);",
+			},
+			notWant: []string{"app.users (", "references app.users", "public."},
+		},
+		{
+			name: "drop table drops dependents",
+			sql: `create table users (id int primary key);
+create table orders (id int, user_id int references users (id)) partition by range (id);
+create table orders_1 partition of orders for values from (1) to (10);
+create sequence users_id_seq owned by users.id;
+create function touch() returns trigger language plpgsql as $$ begin return new; end $$;
+create trigger users_touch before update on users for each row execute function touch();
+create trigger orders_touch before update on orders for each row execute function touch();
+drop table users cascade;
+drop table orders;`,
+			want:    []string{"create function touch()"},
+			notWant: []string{"create table", "create trigger", "users_id_seq"},
+		},
+		{
+			name: "drop table keeps unrelated foreign keys",
+			sql: `create table a (id int primary key);
+create table b (id int primary key);
+create table c (a_id int references a (id), b_id int references b (id));
+drop table a cascade;`,
+			want:    []string{"foreign key (b_id) references b (id)"},
+			notWant: []string{"references a"},
+		},
+		{
+			name: "drop index",
+			sql: `create table app.t (a int, b int);
+create index t_a on app.t (a);
+create index on app.t (b);
+create index on app.t (lower(a::text));
+drop index app.t_b_idx;
+drop index concurrently if exists app.t_lower_idx, app.missing;`,
+			want:    []string{"create index t_a     on app.t (a);"},
+			notWant: []string{"t_b_idx", "lower"},
+		},
+		{
+			name: "rename index",
+			sql: `create table t (a int, b int unique, c int, constraint t_c_uniq unique (c));
+create index t_a on t (a);
+alter index t_a rename to t_a_idx;
+alter index t_b_key rename to t_b_uniq;
+alter index if exists t_c_uniq rename to t_c_u;`,
+			want: []string{
+				"constraint t_b_uniq unique (b),",
+				"constraint t_c_u unique (c)",
+				"create index t_a_idx     on t (a);",
+			},
+		},
+		{
+			name: "drop named constraints",
+			sql: `create table p (id int, constraint p_pk primary key (id));
+create table t (a int, b int, p_id int,
+  constraint t_a_u unique (a),
+  constraint t_p_fk foreign key (p_id) references p (id),
+  constraint t_b_ck check (b > 0),
+  constraint t_b_ck2 check (b < 10));
+alter table t drop constraint t_a_u, drop constraint t_p_fk, drop constraint if exists missing;
+alter table t drop constraint t_b_ck;
+alter table p drop constraint p_pk;`,
+			want:    []string{"constraint t_b_ck2 check (b < 10)"},
+			notWant: []string{"unique", "foreign key", "t_b_ck ", "primary key"},
+		},
+		{
+			name: "drop constraints by generated name",
+			sql: `create table p (id int primary key, code text unique);
+create table t (id int, p_id int references p (id), n int check (n > 0), m int, check (n < m));
+alter table t drop constraint t_p_id_fkey, drop constraint t_n_check;
+alter table p drop constraint p_code_key;
+alter table t drop constraint t_check;`,
+			want:    []string{"primary key (id)"},
+			notWant: []string{"foreign key", "check", "unique"},
+		},
+		{
+			name: "dropping a primary key cascades to foreign keys",
+			sql: `create table p (id int primary key);
+create table t (p_id int references p);
+alter table p drop constraint p_pkey cascade;`,
+			notWant: []string{"primary key", "foreign key"},
+		},
+		{
+			name: "rename constraint",
+			sql: `create table p (id int primary key);
+create table t (id int, p_id int references p (id), constraint t_pos check (id > 0));
+alter table t rename constraint t_p_id_fkey to t_parent;
+alter table t rename constraint t_pos to t_positive;
+alter table p rename constraint p_pkey to p_pk;`,
+			want: []string{
+				"constraint p_pk primary key (id)",
+				"constraint t_parent foreign key (p_id) references p (id)",
+				"constraint t_positive check (id > 0)",
+			},
+		},
+		{
+			name: "renamed table keeps generated constraint names",
+			sql: `create table t (id int primary key, n int check (n > 0));
+alter table t rename to u;
+alter table u drop constraint t_n_check;`,
+			want:    []string{"create table u (", "constraint t_pkey primary key (id)"},
+			notWant: []string{"check"},
+		},
+		{
+			name: "drop column drops what uses it",
+			sql: `create table p (id int primary key, code text unique, n int, m int);
+create index p_n on p (n);
+create index p_nm on p (n, m);
+create index p_m on p (m);
+alter table p add constraint p_n_pos check (n > 0);
+create table t (code text references p (code), n int references p (id));
+create sequence p_n_seq owned by p.n;
+alter table p drop column n;
+alter table p drop column code cascade;`,
+			want:    []string{"create table p (\n    id integer,\n    m integer,\n    primary key (id)\n);", "foreign key (n) references p (id)", "create index p_m"},
+			notWant: []string{"p_n", "references p (code)", "unique"},
+		},
+		{
+			name: "drop table drops the views that read it",
+			sql: `create table u (id int);
+create table keep (id int);
+create view vu as select id from u;
+create view vvu as select * from vu;
+create materialized view mu as select k.id from keep k join u on u.id = k.id;
+create view vkeep as select id from keep;
+drop table u cascade;`,
+			want:    []string{"create view vkeep as select id from keep;"},
+			notWant: []string{"vu", "mu", " u "},
+		},
+		{
+			name: "drop column drops the views that use it",
+			sql: `create table t (id int, b int);
+create table u (id int, c int);
+create view vb as select id, b from t;
+create view vq as select x.id from t x where x.b > 0;
+create view vall as select * from t;
+create view vvb as select id from vb;
+create view vid as select id from t;
+create view vjoin as select t.id, u.c from t join u on u.id = t.id;
+create view vu as select c from t, u;
+alter table t drop column b cascade;`,
+			want: []string{
+				"create view vid as select id from t;",
+				"create view vjoin as select t.id, u.c from t join u on u.id = t.id;",
+				"create view vu as select c from t, u;",
+			},
+			notWant: []string{"vb ", "vq", "vall", "vvb"},
+		},
+		{
+			name: "drop column keeps and reports views it cannot decide",
+			sql: `create table t (id int, b int);
+create view vm as select b from t, ext.things;
+create view vf as select b from t, generate_series(1, 2) g;
+alter table t drop column b cascade;`,
+			want: []string{"create view vm as select b from t, ext.things;", "create view vf as"},
+			reports: []string{
+				"view vf is kept although it may use t.b, which was dropped",
+				"view vm is kept although it may use t.b, which was dropped",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("test.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			checkRendered(t, s.RenderDDL(true, false), tc.want, tc.notWant)
+			var reports []string
+			for _, d := range s.Diagnostics {
+				reports = append(reports, d.Message)
+			}
+			sort.Strings(reports)
+			if strings.Join(reports, "\n") != strings.Join(tc.reports, "\n") {
+				t.Fatalf("diagnostics = %q, want %q", reports, tc.reports)
+			}
+		})
+	}
+}
+
+func TestMakeObjectName(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		name1, name2, label string
+		want                string
+	}{
+		{"users", "", "pkey", "users_pkey"},
+		{"users", "email", "key", "users_email_key"},
+		{"users", "", "check", "users_check"},
+		{long, "email", "fkey", strings.Repeat("a", 52) + "_email_fkey"},
+		{long, long, "idx", strings.Repeat("a", 29) + "_" + strings.Repeat("a", 29) + "_idx"},
+	}
+	for _, tc := range tests {
+		if got := makeObjectName(tc.name1, tc.name2, tc.label); got != tc.want {
+			t.Fatalf("makeObjectName(%q, %q, %q) = %q, want %q", tc.name1, tc.name2, tc.label, got, tc.want)
+		}
+	}
+}
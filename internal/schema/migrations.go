@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// golang-migrate migration files are named VERSION_TITLE.up.sql and
+// VERSION_TITLE.down.sql, where VERSION is an unsigned integer.
+
+var migrationNameRe = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+
+// migrationVersion returns the version prefix of a migration file name and
+// the number of digits it is written with.
+func migrationVersion(name string) (version uint64, digits int, ok bool) {
+	m := migrationNameRe.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return 0, 0, false
+	}
+	v, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return v, len(m[1]), true
+}
+
+// sortMigrationFiles sorts migration files by their version prefixes, so
+// 10_x.up.sql follows 9_x.up.sql, then by path. Files without a version
+// come last.
+func sortMigrationFiles(files []string) {
+	sort.Slice(files, func(i, j int) bool {
+		vi, _, iok := migrationVersion(files[i])
+		vj, _, jok := migrationVersion(files[j])
+		switch {
+		case iok != jok:
+			return iok
+		case vi != vj:
+			return vi < vj
+		}
+		return files[i] < files[j]
+	})
+}
+
+// NextMigration returns the file name prefix, VERSION_TITLE, of the
+// migration that follows the ones in dir. The version is one more than the
+// highest one in dir, written with as many digits; the first migration is
+// 000001.
+func NextMigration(dir, title string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	var last uint64
+	digits := 6
+	for _, e := range entries {
+		if v, n, ok := migrationVersion(e.Name()); ok && !e.IsDir() && v >= last {
+			last, digits = v, n
+		}
+	}
+	return fmt.Sprintf("%0*d_%s", digits, last+1, migrationTitle(title)), nil
+}
+
+// migrationTitle turns title into the part of a file name after the version.
+func migrationTitle(title string) string {
+	title = strings.ToLower(strings.TrimSpace(title))
+	title = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, title)
+	if title == "" {
+		return "migration"
+	}
+	return title
+}
+
+// WriteMigration writes up and down as the next migration pair in dir and
+// returns the paths of the two files.
+func WriteMigration(dir, title, up, down string) (upPath, downPath string, err error) {
+	prefix, err := NextMigration(dir, title)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+	upPath = filepath.Join(dir, prefix+".up.sql")
+	downPath = filepath.Join(dir, prefix+".down.sql")
+	for _, f := range []struct{ path, sql string }{{upPath, up}, {downPath, down}} {
+		if err := os.WriteFile(f.path, []byte(f.sql), 0644); err != nil {
+			return "", "", fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+	}
+	return upPath, downPath, nil
+}
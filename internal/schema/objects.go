@@ -0,0 +1,762 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Non-table objects. Enums and sequences are modelled so later ALTERs can be
+// replayed; views, functions, triggers and extensions keep the SQL of the
+// statement that last created them.
+
+type Enum struct {
+	Schema string   `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Name   string   `json:"name" yaml:"name"`
+	Values []string `json:"values" yaml:"values"`
+}
+
+type Sequence struct {
+	Schema    string `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Name      string `json:"name,omitempty" yaml:"name,omitempty"`
+	Type      string `json:"type,omitempty" yaml:"type,omitempty"`
+	Increment string `json:"increment,omitempty" yaml:"increment,omitempty"`
+	MinValue  string `json:"min_value,omitempty" yaml:"min_value,omitempty"`
+	MaxValue  string `json:"max_value,omitempty" yaml:"max_value,omitempty"`
+	Start     string `json:"start,omitempty" yaml:"start,omitempty"`
+	Cache     string `json:"cache,omitempty" yaml:"cache,omitempty"`
+	Cycle     bool   `json:"cycle,omitempty" yaml:"cycle,omitempty"`
+	OwnedBy   string `json:"owned_by,omitempty" yaml:"owned_by,omitempty"` // table.column, rendered once the tables exist
+}
+
+type View struct {
+	Schema       string
+	Name         string
+	Materialized bool
+	SQL          string
+	order        int
+}
+
+type Function struct {
+	Schema    string
+	Name      string
+	Args      []string // input argument types, which identify overloads
+	Procedure bool
+	SQL       string
+	order     int
+}
+
+type Trigger struct {
+	Schema string // of the table
+	Table  string
+	Name   string
+	SQL    string
+	order  int
+}
+
+type Extension struct {
+	Name  string
+	SQL   string
+	order int
+}
+
+// qualifiedKey is the map key used for objects that live in a schema.
+// Unqualified names are in public, so users and public.users share a key.
+func qualifiedKey(schema, name string) string {
+	if schema = localSchema(schema); schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// localSchema returns schema, or "" for public, where unqualified names live.
+func localSchema(schema string) string {
+	if schema == "public" {
+		return ""
+	}
+	return schema
+}
+
+// nextOrder returns increasing numbers so objects render in creation order.
+func (s *Schema) nextOrder() int {
+	s.order++
+	return s.order
+}
+
+// nameNode is a {"String": {"sval": ...}} list element.
+type nameNode struct {
+	String struct {
+		Sval string `json:"sval"`
+	} `json:"String"`
+}
+
+func nodeNames(nodes []nameNode) []string {
+	parts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		parts = append(parts, n.String.Sval)
+	}
+	return parts
+}
+
+// splitQualified splits [schema,] name parts; public comes back as "".
+func splitQualified(parts []string) (schema, name string) {
+	switch len(parts) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", parts[0]
+	}
+	return localSchema(parts[len(parts)-2]), parts[len(parts)-1]
+}
+
+// typeNode is a TypeName node.
+type typeNode struct {
+	Names       []nameNode        `json:"names"`
+	ArrayBounds []json.RawMessage `json:"arrayBounds"`
+}
+
+// signatureType renders a type for function identity: pg_catalog is dropped
+// so "int" and "integer" compare equal.
+func (t typeNode) signatureType() string {
+	parts := nodeNames(t.Names)
+	if len(parts) == 2 && parts[0] == "pg_catalog" {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, ".") + strings.Repeat("[]", len(t.ArrayBounds))
+}
+
+// statementSQL normalizes the text of one split statement for output.
+func statementSQL(sql string) string {
+	return strings.TrimSuffix(strings.TrimSpace(sql), ";") + ";"
+}
+
+func applyCreateEnum(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		TypeName []nameNode `json:"typeName"`
+		Vals     []nameNode `json:"vals"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := splitQualified(nodeNames(node.TypeName))
+	s.Enums[qualifiedKey(schema, name)] = &Enum{Schema: schema, Name: name, Values: nodeNames(node.Vals)}
+	return nil
+}
+
+func applyAlterEnum(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		TypeName           []nameNode `json:"typeName"`
+		OldVal             string     `json:"oldVal"`
+		NewVal             string     `json:"newVal"`
+		NewValNeighbor     string     `json:"newValNeighbor"`
+		NewValIsAfter      bool       `json:"newValIsAfter"`
+		SkipIfNewValExists bool       `json:"skipIfNewValExists"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := splitQualified(nodeNames(node.TypeName))
+	e, ok := s.Enums[qualifiedKey(schema, name)]
+	if !ok {
+		s.report(LevelIgnored, "type %s is not created by these migrations", qualifiedKey(schema, name))
+		return nil
+	}
+
+	if node.OldVal != "" {
+		for i, v := range e.Values {
+			if v == node.OldVal {
+				e.Values[i] = node.NewVal
+			}
+		}
+		return nil
+	}
+	if containsString(e.Values, node.NewVal) {
+		return nil
+	}
+
+	pos := len(e.Values)
+	if node.NewValNeighbor != "" {
+		for i, v := range e.Values {
+			if v == node.NewValNeighbor {
+				pos = i
+				if node.NewValIsAfter {
+					pos++
+				}
+			}
+		}
+	}
+	e.Values = append(e.Values[:pos], append([]string{node.NewVal}, e.Values[pos:]...)...)
+	return nil
+}
+
+// defElem is an option of CREATE/ALTER SEQUENCE and similar statements.
+type defElem struct {
+	DefElem struct {
+		Defname string          `json:"defname"`
+		Arg     json.RawMessage `json:"arg"`
+	} `json:"DefElem"`
+}
+
+// defElemValue renders a DefElem argument: a number, a type or a name list.
+func defElemValue(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var arg struct {
+		Integer *struct {
+			Ival int64 `json:"ival"`
+		} `json:"Integer"`
+		Float *struct {
+			Fval string `json:"fval"`
+		} `json:"Float"`
+		String *struct {
+			Sval string `json:"sval"`
+		} `json:"String"`
+		Boolean *struct {
+			Boolval bool `json:"boolval"`
+		} `json:"Boolean"`
+		TypeName *typeNode `json:"TypeName"`
+		List     *struct {
+			Items []nameNode `json:"items"`
+		} `json:"List"`
+	}
+	if err := json.Unmarshal(raw, &arg); err != nil {
+		return ""
+	}
+	switch {
+	case arg.Integer != nil:
+		return fmt.Sprint(arg.Integer.Ival)
+	case arg.Float != nil:
+		return arg.Float.Fval
+	case arg.String != nil:
+		return arg.String.Sval
+	case arg.Boolean != nil:
+		return fmt.Sprint(arg.Boolean.Boolval)
+	case arg.TypeName != nil:
+		return arg.TypeName.signatureType()
+	case arg.List != nil:
+		return strings.Join(nodeNames(arg.List.Items), ".")
+	}
+	return ""
+}
+
+func (q *Sequence) applyOptions(options []defElem) {
+	for _, o := range options {
+		value := defElemValue(o.DefElem.Arg)
+		switch o.DefElem.Defname {
+		case "as":
+			q.Type = value
+		case "increment":
+			q.Increment = value
+		case "minvalue":
+			q.MinValue = value
+		case "maxvalue":
+			q.MaxValue = value
+		case "start":
+			q.Start = value
+		case "cache":
+			q.Cache = value
+		case "cycle":
+			q.Cycle = value == "true"
+		case "owned_by":
+			if strings.EqualFold(value, "none") {
+				value = ""
+			}
+			q.OwnedBy = value
+		}
+	}
+}
+
+func applyCreateSequence(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		Sequence    json.RawMessage `json:"sequence"`
+		Options     []defElem       `json:"options"`
+		IfNotExists bool            `json:"if_not_exists"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := parseRangeVar(node.Sequence)
+	key := qualifiedKey(schema, name)
+	if _, exists := s.Sequences[key]; exists && node.IfNotExists {
+		return nil
+	}
+	q := &Sequence{Schema: schema, Name: name}
+	q.applyOptions(node.Options)
+	s.Sequences[key] = q
+	return nil
+}
+
+func applyAlterSequence(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		Sequence json.RawMessage `json:"sequence"`
+		Options  []defElem       `json:"options"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := parseRangeVar(node.Sequence)
+	q, ok := s.Sequences[qualifiedKey(schema, name)]
+	if !ok {
+		// e.g. the implicit sequence of a serial column
+		s.report(LevelIgnored, "sequence %s is not created by these migrations", qualifiedKey(schema, name))
+		return nil
+	}
+	q.applyOptions(node.Options)
+	return nil
+}
+
+// applyCreateSchema replays CREATE SCHEMA; objects created along with the
+// schema are not replayed.
+func applyCreateSchema(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		Schemaname string            `json:"schemaname"`
+		SchemaElts []json.RawMessage `json:"schemaElts"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	if len(node.SchemaElts) > 0 {
+		s.report(LevelUnsupported, "objects created by CREATE SCHEMA are not replayed")
+	}
+	// CREATE SCHEMA AUTHORIZATION alone names the schema after the role
+	if name := localSchema(node.Schemaname); name != "" {
+		s.Namespaces[name] = true
+	}
+	return nil
+}
+
+// dropSchema drops the schema name and everything in it, as DROP SCHEMA
+// ... CASCADE does.
+func (s *Schema) dropSchema(name string) {
+	delete(s.Namespaces, name)
+	for _, t := range s.Tables {
+		if t.Schema == name {
+			s.dropTable(t)
+		}
+	}
+	for key, e := range s.Enums {
+		if e.Schema == name {
+			delete(s.Enums, key)
+		}
+	}
+	for key, q := range s.Sequences {
+		if q.Schema == name {
+			delete(s.Sequences, key)
+		}
+	}
+	for key, v := range s.Views {
+		if v.Schema == name {
+			delete(s.Views, key)
+		}
+	}
+	for key, f := range s.Functions {
+		if f.Schema == name {
+			delete(s.Functions, key)
+		}
+	}
+	for key, t := range s.Triggers {
+		if t.Schema == name {
+			delete(s.Triggers, key)
+		}
+	}
+}
+
+func applyCreateExtension(s *Schema, raw json.RawMessage, sql string) error {
+	var node struct {
+		Extname     string `json:"extname"`
+		IfNotExists bool   `json:"if_not_exists"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	if _, exists := s.Extensions[node.Extname]; exists && node.IfNotExists {
+		return nil
+	}
+	s.Extensions[node.Extname] = &Extension{Name: node.Extname, SQL: statementSQL(sql), order: s.nextOrder()}
+	return nil
+}
+
+func applyCreateView(s *Schema, raw json.RawMessage, sql string) error {
+	var node struct {
+		View json.RawMessage `json:"view"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := parseRangeVar(node.View)
+	s.Views[qualifiedKey(schema, name)] = &View{Schema: schema, Name: name, SQL: statementSQL(sql), order: s.nextOrder()}
+	return nil
+}
+
+// applyCreateTableAs records materialized views; CREATE TABLE AS reports
+// whether it was handled since the resulting columns are unknown without a database.
+func applyCreateTableAs(s *Schema, raw json.RawMessage, sql string) (bool, error) {
+	var node struct {
+		Into struct {
+			Rel json.RawMessage `json:"rel"`
+		} `json:"into"`
+		Objtype     string `json:"objtype"`
+		IfNotExists bool   `json:"if_not_exists"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return false, err
+	}
+	if node.Objtype != "OBJECT_MATVIEW" {
+		return false, nil
+	}
+	schema, name := parseRangeVar(node.Into.Rel)
+	key := qualifiedKey(schema, name)
+	if _, exists := s.Views[key]; exists && node.IfNotExists {
+		return true, nil
+	}
+	s.Views[key] = &View{Schema: schema, Name: name, Materialized: true, SQL: statementSQL(sql), order: s.nextOrder()}
+	return true, nil
+}
+
+// functionKey identifies a function overload by name and input argument types.
+func functionKey(schema, name string, args []string) string {
+	return qualifiedKey(schema, name) + "(" + strings.Join(args, ",") + ")"
+}
+
+func applyCreateFunction(s *Schema, raw json.RawMessage, sql string) error {
+	var node struct {
+		IsProcedure bool       `json:"is_procedure"`
+		Funcname    []nameNode `json:"funcname"`
+		Parameters  []struct {
+			FunctionParameter struct {
+				ArgType typeNode `json:"argType"`
+				Mode    string   `json:"mode"`
+			} `json:"FunctionParameter"`
+		} `json:"parameters"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := splitQualified(nodeNames(node.Funcname))
+	args := []string{}
+	for _, p := range node.Parameters {
+		switch p.FunctionParameter.Mode {
+		case "FUNC_PARAM_OUT", "FUNC_PARAM_TABLE":
+			continue
+		}
+		args = append(args, p.FunctionParameter.ArgType.signatureType())
+	}
+	s.Functions[functionKey(schema, name, args)] = &Function{
+		Schema:    schema,
+		Name:      name,
+		Args:      args,
+		Procedure: node.IsProcedure,
+		SQL:       statementSQL(sql),
+		order:     s.nextOrder(),
+	}
+	return nil
+}
+
+func applyCreateTrigger(s *Schema, raw json.RawMessage, sql string) error {
+	var node struct {
+		Trigname string          `json:"trigname"`
+		Relation json.RawMessage `json:"relation"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, table := parseRangeVar(node.Relation)
+	s.Triggers[qualifiedKey(qualifiedKey(schema, table), node.Trigname)] = &Trigger{
+		Schema: schema,
+		Table:  table,
+		Name:   node.Trigname,
+		SQL:    statementSQL(sql),
+		order:  s.nextOrder(),
+	}
+	return nil
+}
+
+// dropObject is one entry of DropStmt.objects in any of the shapes pg_query uses.
+type dropObject struct {
+	List *struct {
+		Items []nameNode `json:"items"`
+	} `json:"List"`
+	String *struct {
+		Sval string `json:"sval"`
+	} `json:"String"`
+	TypeName       *typeNode `json:"TypeName"`
+	ObjectWithArgs *struct {
+		Objname []nameNode `json:"objname"`
+		Objargs []struct {
+			TypeName typeNode `json:"TypeName"`
+		} `json:"objargs"`
+		ArgsUnspecified bool `json:"args_unspecified"`
+	} `json:"ObjectWithArgs"`
+}
+
+// names returns the name parts of a dropped object.
+func (o dropObject) names() []string {
+	switch {
+	case o.List != nil:
+		return nodeNames(o.List.Items)
+	case o.String != nil:
+		return []string{o.String.Sval}
+	case o.TypeName != nil:
+		return nodeNames(o.TypeName.Names)
+	case o.ObjectWithArgs != nil:
+		return nodeNames(o.ObjectWithArgs.Objname)
+	}
+	return nil
+}
+
+// applyDropObjects removes the non-table objects a DropStmt names. It reports
+// whether removeType is one it handles.
+func applyDropObjects(s *Schema, removeType string, objects []dropObject) bool {
+	for _, obj := range objects {
+		schema, name := splitQualified(obj.names())
+		key := qualifiedKey(schema, name)
+		switch removeType {
+		case "OBJECT_TYPE":
+			delete(s.Enums, key)
+		case "OBJECT_SEQUENCE":
+			delete(s.Sequences, key)
+		case "OBJECT_VIEW", "OBJECT_MATVIEW":
+			delete(s.Views, key)
+			s.dropDependentViews(schema, name)
+		case "OBJECT_EXTENSION":
+			delete(s.Extensions, name)
+		case "OBJECT_SCHEMA":
+			s.dropSchema(localSchema(name))
+		case "OBJECT_TRIGGER":
+			parts := obj.names()
+			if len(parts) < 2 {
+				continue
+			}
+			tableSchema, table := splitQualified(parts[:len(parts)-1])
+			delete(s.Triggers, qualifiedKey(qualifiedKey(tableSchema, table), parts[len(parts)-1]))
+		case "OBJECT_FUNCTION", "OBJECT_PROCEDURE", "OBJECT_ROUTINE":
+			if obj.ObjectWithArgs == nil || obj.ObjectWithArgs.ArgsUnspecified {
+				for k, f := range s.Functions {
+					if f.Schema == schema && f.Name == name {
+						delete(s.Functions, k)
+					}
+				}
+				continue
+			}
+			args := []string{}
+			for _, arg := range obj.ObjectWithArgs.Objargs {
+				args = append(args, arg.TypeName.signatureType())
+			}
+			delete(s.Functions, functionKey(schema, name, args))
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// --- rendering ---
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// schemaNames returns the schemas other than public that the migrations
+// create or that objects live in, sorted.
+func (s *Schema) schemaNames() []string {
+	names := map[string]bool{}
+	add := func(schema string) {
+		if schema = localSchema(schema); schema != "" {
+			names[schema] = true
+		}
+	}
+	for name := range s.Namespaces {
+		add(name)
+	}
+	for _, t := range s.Tables {
+		add(t.Schema)
+	}
+	for _, e := range s.Enums {
+		add(e.Schema)
+	}
+	for _, q := range s.Sequences {
+		add(q.Schema)
+	}
+	for _, v := range s.Views {
+		add(v.Schema)
+	}
+	for _, f := range s.Functions {
+		add(f.Schema)
+	}
+	return sortedKeys(names)
+}
+
+// RenderSchemasDDL creates the schemas the other objects go in.
+func (s *Schema) RenderSchemasDDL() string {
+	var b strings.Builder
+	for _, name := range s.schemaNames() {
+		fmt.Fprintf(&b, "create schema %s;\n", pqQuoteIdent(name))
+	}
+	return b.String()
+}
+
+func (s *Schema) RenderExtensionsDDL() string {
+	exts := make([]*Extension, 0, len(s.Extensions))
+	for _, e := range s.Extensions {
+		exts = append(exts, e)
+	}
+	sort.Slice(exts, func(i, j int) bool { return exts[i].order < exts[j].order })
+	var b strings.Builder
+	for _, e := range exts {
+		fmt.Fprintln(&b, e.SQL)
+	}
+	return b.String()
+}
+
+func (s *Schema) RenderTypesDDL() string {
+	var b strings.Builder
+	for _, key := range sortedKeys(s.Enums) {
+		e := s.Enums[key]
+		values := make([]string, 0, len(e.Values))
+		for _, v := range e.Values {
+			values = append(values, quoteLiteral(v))
+		}
+		fmt.Fprintf(&b, "create type %s as enum (%s);\n", pqQuoteQualified(e.Schema, e.Name), strings.Join(values, ", "))
+	}
+	return b.String()
+}
+
+func (s *Schema) RenderSequencesDDL() string {
+	var b strings.Builder
+	for _, key := range sortedKeys(s.Sequences) {
+		q := s.Sequences[key]
+		fmt.Fprintf(&b, "create sequence %s", pqQuoteQualified(q.Schema, q.Name))
+		if opts := q.optionsSQL(); opts != "" {
+			b.WriteString(" " + opts)
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// optionsSQL renders the options that differ from the defaults, space separated.
+func (q *Sequence) optionsSQL() string {
+	// an ascending sequence starts at its minvalue, 1 by default
+	startDefault := ""
+	if q.MinValue == "" && !strings.HasPrefix(q.Increment, "-") {
+		startDefault = "1"
+	}
+	var opts []string
+	for _, opt := range []struct{ keyword, value, def string }{
+		{"as", q.Type, ""},
+		{"increment by", q.Increment, "1"},
+		{"minvalue", q.MinValue, ""},
+		{"maxvalue", q.MaxValue, ""},
+		{"start with", q.Start, startDefault},
+		{"cache", q.Cache, "1"},
+	} {
+		if opt.value != "" && opt.value != opt.def {
+			opts = append(opts, opt.keyword+" "+opt.value)
+		}
+	}
+	if q.Cycle {
+		opts = append(opts, "cycle")
+	}
+	return strings.Join(opts, " ")
+}
+
+// RenderSequenceOwnershipDDL ties sequences to their columns; it must follow the tables.
+func (s *Schema) RenderSequenceOwnershipDDL() string {
+	var b strings.Builder
+	for _, key := range sortedKeys(s.Sequences) {
+		q := s.Sequences[key]
+		if q.OwnedBy != "" {
+			fmt.Fprintf(&b, "alter sequence %s owned by %s;\n", pqQuoteQualified(q.Schema, q.Name), q.OwnedBy)
+		}
+	}
+	return b.String()
+}
+
+func (s *Schema) RenderFunctionsDDL() string {
+	if len(s.Functions) == 0 {
+		return ""
+	}
+	funcs := make([]*Function, 0, len(s.Functions))
+	for _, f := range s.Functions {
+		funcs = append(funcs, f)
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].order < funcs[j].order })
+
+	var b strings.Builder
+	// like pg_dump: bodies may reference tables that are created later
+	b.WriteString("set check_function_bodies = false;\n")
+	for _, f := range funcs {
+		fmt.Fprintln(&b, f.SQL)
+	}
+	return b.String()
+}
+
+// RenderViewsDDL emits views in creation order, so views built on other views follow them.
+func (s *Schema) RenderViewsDDL() string {
+	views := make([]*View, 0, len(s.Views))
+	for _, v := range s.Views {
+		views = append(views, v)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].order < views[j].order })
+	var b strings.Builder
+	for _, v := range views {
+		fmt.Fprintln(&b, v.SQL)
+	}
+	return b.String()
+}
+
+func (s *Schema) RenderTriggersDDL() string {
+	triggers := make([]*Trigger, 0, len(s.Triggers))
+	for _, t := range s.Triggers {
+		triggers = append(triggers, t)
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].order < triggers[j].order })
+	var b strings.Builder
+	for _, t := range triggers {
+		fmt.Fprintln(&b, t.SQL)
+	}
+	return b.String()
+}
+
+// RenderDDL renders the whole schema in dependency order: schemas,
+// extensions, types, sequences and functions first, then tables, sequence
+// ownership, indexes, views and finally triggers. separateFKs adds all
+// foreign keys after the tables, as RenderTablesDDL does.
+func (s *Schema) RenderDDL(includeIndexes, separateFKs bool) string {
+	sections := []string{
+		s.RenderSchemasDDL(),
+		s.RenderExtensionsDDL(),
+		s.RenderTypesDDL(),
+		s.RenderSequencesDDL(),
+		s.RenderFunctionsDDL(),
+		s.RenderTablesDDL(separateFKs),
+		s.RenderSequenceOwnershipDDL(),
+	}
+	if includeIndexes {
+		sections = append(sections, s.RenderIndexesDDL())
+	}
+	sections = append(sections, s.RenderViewsDDL(), s.RenderTriggersDDL())
+
+	var b strings.Builder
+	for _, section := range sections {
+		if section == "" {
+			continue
+		}
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(section)
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjects(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    []string // in this order
+		notWant []string
+	}{
+		{
+			name: "enum with added and renamed values",
+			sql: `create type mood as enum ('sad', 'ok');
+alter type mood add value 'happy' after 'ok';
+alter type mood add value 'meh' before 'ok';
+alter type mood add value if not exists 'ok';
+alter type mood rename value 'sad' to 'blue';`,
+			want: []string{"create type mood as enum ('blue', 'meh', 'ok', 'happy');"},
+		},
+		{
+			name:    "dropped enum",
+			sql:     "create type mood as enum ('a');\ndrop type mood;",
+			notWant: []string{"create type"},
+		},
+		{
+			name: "sequence options and ownership",
+			sql: `create table t (id bigint);
+create sequence t_id_seq as bigint increment by 2 minvalue 1 no maxvalue start with 10 cache 5 cycle;
+alter sequence t_id_seq no cycle owned by t.id;`,
+			want: []string{
+				"create sequence t_id_seq as int8 increment by 2 minvalue 1 start with 10 cache 5;",
+				"create table t (",
+				"alter sequence t_id_seq owned by t.id;",
+			},
+		},
+		{
+			name:    "dropped sequence",
+			sql:     "create sequence s;\ndrop sequence if exists s;",
+			notWant: []string{"create sequence"},
+		},
+		{
+			name:    "extension",
+			sql:     `create extension if not exists "uuid-ossp";` + "\n" + `create extension if not exists "uuid-ossp" with schema other;`,
+			want:    []string{`create extension if not exists "uuid-ossp";`},
+			notWant: []string{"other"},
+		},
+		{
+			name: "views in creation order after tables",
+			sql: `create view b_view as select 1 as x;
+create table z (id int);
+create view a_view as select x from b_view;
+create or replace view b_view as select 2 as x;
+create materialized view m as select * from z with no data;`,
+			want: []string{
+				"create table z (",
+				"create view a_view as select x from b_view;",
+				"create or replace view b_view as select 2 as x;",
+				"create materialized view m as select * from z with no data;",
+			},
+			notWant: []string{"select 1 as x"},
+		},
+		{
+			name:    "dropped views",
+			sql:     "create view v as select 1;\ncreate materialized view m as select 1;\ndrop view v;\ndrop materialized view m;",
+			notWant: []string{"view"},
+		},
+		{
+			name: "alter index, view and sequence create no tables",
+			sql: `create table t (v int);
+create index t_v_idx on t (v);
+create view vv as select v from t;
+create sequence s;
+alter index t_v_idx set (fillfactor = 70);
+alter view vv owner to reader;
+alter sequence s owner to reader;`,
+			want:    []string{"create sequence s;", "create table t (", "create index t_v_idx", "create view vv as select v from t;"},
+			notWant: []string{"create table t_v_idx", "create table vv", "create table s"},
+		},
+		{
+			name: "schemas",
+			sql: `create schema app;
+create schema if not exists empty;
+create schema public;
+create table app.t (id int primary key);
+create type audit.kind as enum ('a');
+create schema gone;
+create table gone.t (id int primary key);
+create table u (t_id int references gone.t (id));
+drop schema gone cascade;`,
+			want:    []string{"create schema app;\ncreate schema audit;\ncreate schema empty;\n\ncreate type audit.kind", "create table app.t (", "create table u (\n    t_id integer\n);"},
+			notWant: []string{"gone", "schema public"},
+		},
+		{
+			name: "function overloads and trigger",
+			sql: `create table t (id int);
+create function touch() returns trigger language plpgsql as $$ begin return new; end $$;
+create function f(a integer) returns int language sql as $$ select a $$;
+create function f(a text) returns text language sql as $$ select a $$;
+create or replace function f(a int) returns int language sql as $$ select a + 1 $$;
+create trigger t_touch before update on t for each row execute function touch();`,
+			want: []string{
+				"set check_function_bodies = false;",
+				"create function touch()",
+				"create function f(a text)",
+				"select a + 1",
+				"create table t (",
+				"create trigger t_touch before update on t for each row execute function touch();",
+			},
+			notWant: []string{"$$ select a $$;\ncreate function f(a text)"},
+		},
+		{
+			name: "dropped function overload and trigger",
+			sql: `create table t (id int);
+create function f(a integer) returns int language sql as $$ select a $$;
+create function f(a text) returns text language sql as $$ select a $$;
+create function g() returns trigger language plpgsql as $$ begin return new; end $$;
+create trigger trg after insert on t for each row execute function g();
+drop function f(int);
+drop trigger trg on t;`,
+			want:    []string{"create function f(a text)", "create function g()"},
+			notWant: []string{"f(a integer)", "create trigger"},
+		},
+		{
+			name:    "drop function without arguments drops every overload",
+			sql:     "create function f(a int) returns int language sql as $$ select a $$;\ncreate function f() returns int language sql as $$ select 1 $$;\ndrop function f;",
+			notWant: []string{"create function"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("test.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			checkRendered(t, s.RenderDDL(true, false), tc.want, tc.notWant)
+		})
+	}
+}
+
+// checkRendered fails unless ddl contains want in order and none of notWant.
+func checkRendered(t *testing.T, ddl string, want, notWant []string) {
+	t.Helper()
+	rest := ddl
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i < 0 {
+			t.Fatalf("RenderDDL missing %q (or out of order):\n%s", w, ddl)
+		}
+		rest = rest[i+len(w):]
+	}
+	for _, unwanted := range notWant {
+		if strings.Contains(ddl, unwanted) {
+			t.Fatalf("RenderDDL contains %q:\n%s", unwanted, ddl)
+		}
+	}
+}
+
+func TestRenderDDLOrder(t *testing.T) {
+	t.Parallel()
+
+	s := NewSchema()
+	err := s.ApplySQL("test.up.sql", `create view v as select * from t;
+create trigger trg before insert on t for each row execute function fn();
+create index t_id on t (id);
+create table t (id int, m mood default nextval('s'));
+create function fn() returns trigger language plpgsql as $$ begin return new; end $$;
+create sequence s;
+create type mood as enum ('a');
+create extension pgcrypto;`)
+	if err != nil {
+		t.Fatalf("ApplySQL error = %v", err)
+	}
+
+	got := s.RenderDDL(true, false)
+	order := []string{"create extension", "create type", "create sequence", "create function", "create table", "create index", "create view", "create trigger"}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(got, want)
+		if i < 0 || i < last {
+			t.Fatalf("RenderDDL does not emit %q after the previous kinds:\n%s", want, got)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,242 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules is a normalization rules file. Rules fix up the replayed schema where
+// migrations alone do not produce the intended shape, for example columns
+// whose type was only ever changed by a data migration.
+type Rules struct {
+	Tables []TableRule `yaml:"tables"`
+}
+
+// TableRule applies to every table whose name, or schema-qualified name,
+// matches the path.Match pattern Table. Like unquoted identifiers, table and
+// column patterns match case-insensitively. Renames (old name to new name, skipped
+// when the new name exists) run first, then column rules in order, then
+// required indexes.
+type TableRule struct {
+	Table   string            `yaml:"table"`
+	Renames map[string]string `yaml:"renames"`
+	Columns []ColumnRule      `yaml:"columns"`
+	Indexes []IndexRule       `yaml:"indexes"`
+}
+
+// ColumnRule changes every column matching one of the path.Match patterns in
+// Column or Columns. Default is only set on columns without a default.
+type ColumnRule struct {
+	Column  string   `yaml:"column"`
+	Columns []string `yaml:"columns"`
+	Type    string   `yaml:"type"`
+	Default string   `yaml:"default"`
+	NotNull *bool    `yaml:"notNull"`
+}
+
+// IndexRule requires an index. Columns are written as in CREATE INDEX:
+// identifiers or parenthesized expressions. A missing index is added with
+// Columns. An existing index with the same name keeps its columns and gains
+// those of Extend it lacks, appended in order; when Extend is empty it gains
+// the missing Columns instead.
+type IndexRule struct {
+	Name    string   `yaml:"name"`
+	Columns []string `yaml:"columns"`
+	Extend  []string `yaml:"extend"`
+	Unique  bool     `yaml:"unique"`
+}
+
+// LoadRules reads a rules file.
+func LoadRules(file string) (*Rules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// ParseRules decodes and validates rules from YAML.
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+func (r *Rules) validate() error {
+	for i, tr := range r.Tables {
+		if tr.Table == "" {
+			return fmt.Errorf("tables[%d]: table is required", i)
+		}
+		patterns := []string{tr.Table}
+		for j, cr := range tr.Columns {
+			if len(cr.patterns()) == 0 {
+				return fmt.Errorf("tables[%d] (%s): columns[%d]: column or columns is required", i, tr.Table, j)
+			}
+			patterns = append(patterns, cr.patterns()...)
+		}
+		for j, ir := range tr.Indexes {
+			if ir.Name == "" || len(ir.Columns) == 0 {
+				return fmt.Errorf("tables[%d] (%s): indexes[%d]: name and columns are required", i, tr.Table, j)
+			}
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("tables[%d]: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (cr ColumnRule) patterns() []string {
+	if cr.Column == "" {
+		return cr.Columns
+	}
+	return append([]string{cr.Column}, cr.Columns...)
+}
+
+func (tr TableRule) matches(t *Table) bool {
+	if matchFold(tr.Table, t.Name) {
+		return true
+	}
+	schema := t.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	return matchFold(tr.Table, schema+"."+t.Name)
+}
+
+func (cr ColumnRule) matches(name string) bool {
+	for _, pattern := range cr.patterns() {
+		if matchFold(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFold reports whether name matches the path.Match pattern, ignoring case.
+func matchFold(pattern, name string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
+
+// Normalize applies rules, which may be nil, and marks primary key columns not null.
+func (s *Schema) Normalize(rules *Rules) {
+	for _, t := range s.Tables {
+		if rules != nil {
+			for _, tr := range rules.Tables {
+				if tr.matches(t) {
+					tr.apply(t)
+				}
+			}
+		}
+		// ensure PK columns flagged not null
+		for _, pk := range t.PK {
+			if i, ok := t.colIndex(pk); ok {
+				t.Columns[i].NotNull = true
+			}
+		}
+	}
+}
+
+func (tr TableRule) apply(t *Table) {
+	froms := make([]string, 0, len(tr.Renames))
+	for from := range tr.Renames {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		to := tr.Renames[from]
+		if _, exists := t.colIndex(to); exists {
+			continue
+		}
+		t.renameColumn(from, to)
+	}
+
+	for _, cr := range tr.Columns {
+		for i := range t.Columns {
+			c := &t.Columns[i]
+			if !cr.matches(c.Name) {
+				continue
+			}
+			if cr.Type != "" {
+				c.Type = cr.Type
+			}
+			if cr.Default != "" && c.DefaultSQL == "" {
+				c.DefaultSQL = cr.Default
+			}
+			if cr.NotNull != nil {
+				c.NotNull = *cr.NotNull
+			}
+		}
+	}
+
+	for _, ir := range tr.Indexes {
+		ix := t.index(ir.Name)
+		if ix == nil {
+			t.Indexes = append(t.Indexes, Index{Name: ir.Name, Columns: append([]string(nil), ir.Columns...), Unique: ir.Unique})
+			continue
+		}
+		extend := ir.Extend
+		if len(extend) == 0 {
+			extend = ir.Columns
+		}
+		for _, col := range extend {
+			if !hasIndexColumn(ix.Columns, col) {
+				ix.Columns = append(ix.Columns, col)
+			}
+		}
+	}
+}
+
+// index returns the index named name, compared case-insensitively.
+func (t *Table) index(name string) *Index {
+	for i := range t.Indexes {
+		if strings.EqualFold(t.Indexes[i].Name, name) {
+			return &t.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// hasIndexColumn reports whether columns holds col. Identifiers compare
+// case-insensitively with or without quotes, expressions exactly.
+func hasIndexColumn(columns []string, col string) bool {
+	for _, c := range columns {
+		if c == col {
+			return true
+		}
+		if !strings.HasPrefix(c, "(") && !strings.HasPrefix(col, "(") &&
+			strings.EqualFold(strings.Trim(c, `"`), strings.Trim(col, `"`)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestTable(s *Schema, schema, name string, cols ...Column) *Table {
+	t := s.ensureTable(schema, name)
+	for _, c := range cols {
+		t.addColumn(c)
+	}
+	return t
+}
+
+func TestExampleRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := LoadRules("examples/enforcement-rules.yaml")
+	if err != nil {
+		t.Fatalf("LoadRules error = %v", err)
+	}
+
+	s := NewSchema()
+	ep := newTestTable(s, "", "enforcement_point",
+		Column{Name: "id", Type: "text"},
+		Column{Name: "mode", Type: "int4"},
+		Column{Name: "created_at", Type: "timestamp", DefaultSQL: "clock_timestamp()"},
+	)
+	ep.PK = []string{"id"}
+	state := newTestTable(s, "", "enforcement_state",
+		Column{Name: "enforcement_point_id", Type: "uuid"},
+		Column{Name: "enforcement_error_jsonb", Type: "text"},
+	)
+	other := newTestTable(s, "", "unrelated", Column{Name: "created_at", Type: "timestamp"})
+
+	s.Normalize(rules)
+
+	wantEP := []Column{
+		{Name: "id", Type: "uuid", NotNull: true},
+		{Name: "mode", Type: "integer", DefaultSQL: "2", NotNull: true},
+		{Name: "created_at", Type: "timestamp with time zone", DefaultSQL: "clock_timestamp()", NotNull: true},
+	}
+	if !reflect.DeepEqual(ep.Columns, wantEP) {
+		t.Fatalf("enforcement_point columns = %+v, want %+v", ep.Columns, wantEP)
+	}
+
+	if _, ok := state.colIndex("enforcement_error"); !ok {
+		t.Fatalf("enforcement_state columns = %+v, want enforcement_error_jsonb renamed", state.Columns)
+	}
+	if i, _ := state.colIndex("enforcement_error"); state.Columns[i].Type != "jsonb" {
+		t.Fatalf("enforcement_error type = %q, want jsonb", state.Columns[i].Type)
+	}
+	// The index columns match what the hardcoded normalization produced: a
+	// missing index is created whole, an existing one only gains the expression.
+	expr := `("enforcement_error" ->> 'error_token')`
+	ix := state.index("idx_enforcement_state_enforcement_error")
+	if want := []string{"enforcement_point_id", "enforcement_status", expr}; ix == nil || !reflect.DeepEqual(ix.Columns, want) {
+		t.Fatalf("enforcement_state indexes = %+v, want required index on %v", state.Indexes, want)
+	}
+	existing := NewSchema()
+	indexed := newTestTable(existing, "", "enforcement_state", Column{Name: "enforcement_error", Type: "jsonb"})
+	indexed.Indexes = []Index{{Name: "idx_enforcement_state_enforcement_error", Columns: []string{"tenant_id"}}}
+	existing.Normalize(rules)
+	if want := []string{"tenant_id", expr}; !reflect.DeepEqual(indexed.Indexes[0].Columns, want) {
+		t.Fatalf("existing index columns = %v, want %v", indexed.Indexes[0].Columns, want)
+	}
+
+	if other.Columns[0].Type != "timestamp" {
+		t.Fatalf("unrelated table changed: %+v", other.Columns)
+	}
+}
+
+func TestRulesApply(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseRules([]byte(`
+tables:
+  - table: "app.*"
+    renames:
+      old_name: name
+    columns:
+      - column: "*_at"
+        type: timestamptz
+        default: now()
+      - column: name
+        notNull: true
+    indexes:
+      - name: items_name
+        columns: [name, "(lower(name))"]
+        unique: true
+`))
+	if err != nil {
+		t.Fatalf("ParseRules error = %v", err)
+	}
+
+	s := NewSchema()
+	items := newTestTable(s, "app", "items",
+		Column{Name: "old_name", Type: "text"},
+		Column{Name: "created_at", Type: "timestamp"},
+		Column{Name: "deleted_at", Type: "timestamp", DefaultSQL: "null"},
+		Column{Name: "Updated_AT", Type: "timestamp"},
+	)
+	items.Indexes = []Index{{Name: "ITEMS_NAME", Columns: []string{`"name"`}}}
+	public := newTestTable(s, "", "items", Column{Name: "created_at", Type: "timestamp"})
+
+	s.Normalize(rules)
+
+	want := []Column{
+		{Name: "name", Type: "text", NotNull: true},
+		{Name: "created_at", Type: "timestamptz", DefaultSQL: "now()"},
+		{Name: "deleted_at", Type: "timestamptz", DefaultSQL: "null"},
+		{Name: "Updated_AT", Type: "timestamptz", DefaultSQL: "now()"},
+	}
+	if !reflect.DeepEqual(items.Columns, want) {
+		t.Fatalf("app.items columns = %+v, want %+v", items.Columns, want)
+	}
+	if got := items.Indexes; len(got) != 1 || !reflect.DeepEqual(got[0].Columns, []string{`"name"`, "(lower(name))"}) {
+		t.Fatalf("app.items indexes = %+v, want items_name extended with (lower(name))", got)
+	}
+	if public.Columns[0].Type != "timestamp" {
+		t.Fatalf("public.items changed: %+v", public.Columns)
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{name: "unknown key", yaml: "tables:\n  - table: t\n    colums: []\n", wantErr: "colums"},
+		{name: "missing table", yaml: "tables:\n  - columns:\n      - column: a\n", wantErr: "table is required"},
+		{name: "missing column", yaml: "tables:\n  - table: t\n    columns:\n      - type: text\n", wantErr: "column or columns is required"},
+		{name: "index without columns", yaml: "tables:\n  - table: t\n    indexes:\n      - name: i\n", wantErr: "name and columns are required"},
+		{name: "bad pattern", yaml: "tables:\n  - table: \"[\"\n", wantErr: "invalid pattern"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseRules([]byte(tc.yaml))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("ParseRules error = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,76 +1,131 @@
-package main
+// Package schema replays Postgres migrations into an in-memory model of the
+// resulting schema and renders it back as consolidated DDL.
+package schema
 
 import (
 	"encoding/json"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
-
-	pgquery "github.com/pganalyze/pg_query_go/v6"
 )
 
 // --- very small in-memory model ---
 
+// The model is serialized by the json and yaml output formats of Squash.
+
 type Column struct {
-	Name       string
-	Type       string
-	NotNull    bool
-	DefaultSQL string
+	Name       string    `json:"name" yaml:"name"`
+	Type       string    `json:"type" yaml:"type"`
+	Collation  string    `json:"collation,omitempty" yaml:"collation,omitempty"` // as written after COLLATE, e.g. "C"
+	NotNull    bool      `json:"not_null,omitempty" yaml:"not_null,omitempty"`
+	DefaultSQL string    `json:"default,omitempty" yaml:"default,omitempty"`
+	Generated  string    `json:"generated,omitempty" yaml:"generated,omitempty"` // expression of a stored generated column
+	Identity   *Identity `json:"identity,omitempty" yaml:"identity,omitempty"`   // set for identity columns
+	Comment    string    `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// Identity describes a GENERATED ... AS IDENTITY column.
+type Identity struct {
+	Always  bool     `json:"always,omitempty" yaml:"always,omitempty"` // GENERATED ALWAYS rather than BY DEFAULT
+	Options Sequence `json:"options" yaml:"options"`                   // options of the backing sequence; only the option fields are used
 }
 
 type Table struct {
-	Schema    string
-	Name      string
-	Columns   []Column
-	PK        []string
-	Indexes   []Index
-	Comment   string
-	ColumnPos map[string]int // for quick updates
+	Schema    string         `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Name      string         `json:"name" yaml:"name"`
+	Columns   []Column       `json:"columns" yaml:"columns"`
+	PK        []string       `json:"primary_key,omitempty" yaml:"primary_key,omitempty"`
+	PKName    string         `json:"primary_key_name,omitempty" yaml:"primary_key_name,omitempty"` // set when the primary key constraint was named
+	Indexes   []Index        `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	Comment   string         `json:"comment,omitempty" yaml:"comment,omitempty"`
+	ColumnPos map[string]int `json:"-" yaml:"-"` // for quick updates
 	// new: track uniques and foreign keys declared as constraints
-	UniqueCons []UniqueConstraint
-	FKs        []ForeignKey
+	UniqueCons []UniqueConstraint `json:"unique_constraints,omitempty" yaml:"unique_constraints,omitempty"`
+	FKs        []ForeignKey       `json:"foreign_keys,omitempty" yaml:"foreign_keys,omitempty"`
+	Checks     []CheckConstraint  `json:"checks,omitempty" yaml:"checks,omitempty"`
+	// PartitionBy is the partition key of a partitioned table, e.g. "range (created_at)".
+	PartitionBy string `json:"partition_by,omitempty" yaml:"partition_by,omitempty"`
+	// PartitionOf is set when the table is a partition of another table.
+	PartitionOf *Partition `json:"partition_of,omitempty" yaml:"partition_of,omitempty"`
 }
 
 type Index struct {
-	Name    string
-	Columns []string // already-quoted identifiers or raw expressions
-	Unique  bool
+	Name    string   `json:"name" yaml:"name"`
+	Columns []string `json:"columns" yaml:"columns"` // already-quoted identifiers or raw expressions
+	Unique  bool     `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Method  string   `json:"method,omitempty" yaml:"method,omitempty"`   // access method, e.g. gin; empty for btree
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"` // already-quoted INCLUDE columns
+	Where   string   `json:"where,omitempty" yaml:"where,omitempty"`     // predicate of a partial index
 }
 
 // Unique constraint captured as a table-level constraint (not a separate CREATE INDEX)
 type UniqueConstraint struct {
-	Name    string
-	Columns []string
+	Name    string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Columns []string `json:"columns" yaml:"columns"`
+}
+
+// CheckConstraint is a CHECK constraint; column constraints are kept at table level too.
+type CheckConstraint struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Expr string `json:"expr" yaml:"expr"`
+}
+
+// Partition places a table in a partitioned table.
+type Partition struct {
+	ParentSchema string `json:"parent_schema,omitempty" yaml:"parent_schema,omitempty"`
+	Parent       string `json:"parent" yaml:"parent"`
+	Bound        string `json:"bound" yaml:"bound"` // e.g. "for values in (1, 2)" or "default"
 }
 
 // Foreign key definition captured at table level
 type ForeignKey struct {
-	Name       string
-	Columns    []string
-	RefSchema  string
-	RefTable   string
-	RefColumns []string
-	OnDelete   string
-	OnUpdate   string
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Columns    []string `json:"columns" yaml:"columns"`
+	RefSchema  string   `json:"ref_schema,omitempty" yaml:"ref_schema,omitempty"`
+	RefTable   string   `json:"ref_table" yaml:"ref_table"`
+	RefColumns []string `json:"ref_columns,omitempty" yaml:"ref_columns,omitempty"`
+	OnDelete   string   `json:"on_delete,omitempty" yaml:"on_delete,omitempty"` // e.g. CASCADE
+	OnUpdate   string   `json:"on_update,omitempty" yaml:"on_update,omitempty"`
 }
 
+// Schema is serialized with its tables, enums and sequences; views,
+// functions, triggers and extensions are kept as SQL and left out.
 type Schema struct {
-	Tables map[string]*Table // key is schema.name (or name if schema empty)
+	Tables     map[string]*Table     `json:"tables" yaml:"tables"` // key is schema.name (or name if schema empty)
+	Enums      map[string]*Enum      `json:"enums,omitempty" yaml:"enums,omitempty"`
+	Sequences  map[string]*Sequence  `json:"sequences,omitempty" yaml:"sequences,omitempty"`
+	Views      map[string]*View      `json:"-" yaml:"-"`
+	Functions  map[string]*Function  `json:"-" yaml:"-"` // key is schema.name(argtypes)
+	Triggers   map[string]*Trigger   `json:"-" yaml:"-"` // key is schema.table.name
+	Extensions map[string]*Extension `json:"-" yaml:"-"` // key is the extension name
+	Namespaces map[string]bool       `json:"-" yaml:"-"` // Postgres schemas the migrations create, other than public
+
+	// Diagnostics lists the statements ApplySQL skipped or only partly replayed.
+	Diagnostics Diagnostics `json:"-" yaml:"-"`
+
+	order   int        // creation counter for objects rendered in creation order
+	current Diagnostic // the statement being replayed, for report
 }
 
-func NewSchema() *Schema { return &Schema{Tables: map[string]*Table{}} }
+func NewSchema() *Schema {
+	return &Schema{
+		Tables:     map[string]*Table{},
+		Enums:      map[string]*Enum{},
+		Sequences:  map[string]*Sequence{},
+		Views:      map[string]*View{},
+		Functions:  map[string]*Function{},
+		Triggers:   map[string]*Trigger{},
+		Extensions: map[string]*Extension{},
+		Namespaces: map[string]bool{},
+	}
+}
 
 // --- helpers ---
 
 // ensureTable creates or returns a table entry for the given schema/name
 func (s *Schema) ensureTable(schema, name string) *Table {
-	key := name
-	if schema != "" {
-		key = schema + "." + name
-	}
+	schema = localSchema(schema)
+	key := qualifiedKey(schema, name)
 	if t, ok := s.Tables[key]; ok {
 		return t
 	}
@@ -119,272 +174,41 @@ func (t *Table) dropColumn(name string) {
 	}
 }
 
-// rename a column in-place (updates ColumnPos)
+// rename a column in-place (updates ColumnPos and the constraints and plain
+// index columns that name it)
 func (t *Table) renameColumn(oldName, newName string) {
-	if i, ok := t.colIndex(oldName); ok {
-		old := t.Columns[i]
-		delete(t.ColumnPos, old.Name)
-		old.Name = newName
-		t.Columns[i] = old
-		t.ColumnPos[newName] = i
+	i, ok := t.colIndex(oldName)
+	if !ok {
+		return
 	}
-}
+	old := t.Columns[i]
+	delete(t.ColumnPos, old.Name)
+	t.Columns[i].Name = newName
+	t.ColumnPos[newName] = i
 
-// Normalize mutates schema to match expected shapes (types/defaults/indexes)
-func (s *Schema) Normalize() {
-	for _, t := range s.Tables {
-		switch t.Name {
-		case "enforcement_point":
-			// types
-			if i, ok := t.colIndex("id"); ok {
-				t.Columns[i].Type = "uuid"
-			}
-			if i, ok := t.colIndex("tenant_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"type", "name", "csp_org_id", "csp_id", "group_name", "account_id", "region", "cloud", "association"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "text"
-				}
-			}
-			if i, ok := t.colIndex("mode"); ok {
-				t.Columns[i].Type = "integer"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "2"
-				}
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"created_at", "updated_at"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if t.Columns[i].DefaultSQL == "" {
-						t.Columns[i].DefaultSQL = "now()"
-					}
-					t.Columns[i].NotNull = true
-				}
-			}
-			if i, ok := t.colIndex("vnet_csp_id"); ok {
-				t.Columns[i].Type = "text"
-			}
-			if i, ok := t.colIndex("illumio_created"); ok {
-				t.Columns[i].Type = "boolean"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "false"
-				}
-			}
-		case "policy":
-			if i, ok := t.colIndex("policy"); ok {
-				t.Columns[i].Type = "jsonb"
-			}
-			if i, ok := t.colIndex("policy_type"); ok {
-				t.Columns[i].Type = "text"
-				// part of PK => ensure not null
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"created_at", "updated_at"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if t.Columns[i].DefaultSQL == "" {
-						t.Columns[i].DefaultSQL = "now()"
-					}
-					t.Columns[i].NotNull = true
-				}
-			}
-		case "enforcement_state":
-			// timestamps
-			for _, n := range []string{"last_checked_at", "last_enforced_at", "last_notification_at", "last_polled_at", "status_updated_at", "created_at", "updated_at", "retry_after"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if n == "created_at" || n == "updated_at" {
-						if t.Columns[i].DefaultSQL == "" {
-							t.Columns[i].DefaultSQL = "now()"
-						}
-						t.Columns[i].NotNull = true
-					}
-				}
-			}
-			// integers and text
-			if i, ok := t.colIndex("processing_status"); ok {
-				t.Columns[i].Type = "integer"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "0"
-				}
-			}
-			if i, ok := t.colIndex("retry_counter"); ok {
-				t.Columns[i].Type = "integer"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "0"
-				}
-			}
-			if i, ok := t.colIndex("retry_on_success_counter"); ok {
-				t.Columns[i].Type = "integer"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "0"
-				}
-			}
-			for _, n := range []string{"lro_token", "enforcement_status", "policy_href"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "text"
-				}
-			}
-			if i, ok := t.colIndex("force_enforcement"); ok {
-				t.Columns[i].Type = "boolean"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "false"
-				}
-			}
-			// jsonb error: rename if required
-			if _, ok := t.colIndex("enforcement_error"); !ok {
-				if _, ok2 := t.colIndex("enforcement_error_jsonb"); ok2 {
-					t.renameColumn("enforcement_error_jsonb", "enforcement_error")
-				}
-			}
-			if i, ok := t.colIndex("enforcement_error"); ok {
-				t.Columns[i].Type = "jsonb"
-			}
-			// ensure functional index exists
-			hasIx := false
-			expr := "(\"enforcement_error\" ->> 'error_token')"
-			for i := range t.Indexes {
-				ix := &t.Indexes[i]
-				if strings.EqualFold(ix.Name, "idx_enforcement_state_enforcement_error") {
-					hasIx = true
-					// ensure expr present
-					found := false
-					for _, c := range ix.Columns {
-						if c == expr {
-							found = true
-							break
-						}
-					}
-					if !found {
-						ix.Columns = append(ix.Columns, expr)
-					}
-				}
-			}
-			if !hasIx {
-				t.Indexes = append(t.Indexes, Index{
-					Name:    "idx_enforcement_state_enforcement_error",
-					Columns: []string{pqQuoteIdent("enforcement_point_id"), pqQuoteIdent("enforcement_status"), expr},
-					Unique:  false,
-				})
-			}
-		case "tamper_state":
-			for _, n := range []string{"created_at", "updated_at"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if t.Columns[i].DefaultSQL == "" {
-						t.Columns[i].DefaultSQL = "now()"
-					}
-					t.Columns[i].NotNull = true
-				}
-			}
-			if i, ok := t.colIndex("last_verified_at"); ok {
-				t.Columns[i].Type = "timestamp with time zone"
-			}
-		case "workload_enforcement_point_association":
-			// enforce UUIDs and timestamps
-			for _, n := range []string{"workload_resource_id", "nic_resource_id", "enforcement_point_id"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "uuid"
-				}
-			}
-			for _, n := range []string{"workload_csp_id", "nic_csp_id", "association_type"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "text"
-				}
-			}
-			for _, n := range []string{"created_at", "updated_at"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if t.Columns[i].DefaultSQL == "" {
-						t.Columns[i].DefaultSQL = "now()"
-					}
-					t.Columns[i].NotNull = true
-				}
-			}
-		case "enforcement_point_effectiveness":
-			if i, ok := t.colIndex("enforcement_point_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			if i, ok := t.colIndex("tenant_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"noneffective_types", "noneffective_rules"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "jsonb"
-				}
-			}
-			for _, n := range []string{"created_at", "updated_at"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "timestamp with time zone"
-					if t.Columns[i].DefaultSQL == "" {
-						t.Columns[i].DefaultSQL = "now()"
-					}
-					t.Columns[i].NotNull = true
-				}
-			}
-		case "enforcement_point_effectiveness_report":
-			if i, ok := t.colIndex("enforcement_point_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			if i, ok := t.colIndex("tenant_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"csp_id", "account_id", "org_id", "name", "type"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "text"
-				}
-			}
-			for _, n := range []string{"noneffective_types", "noneffective_rules", "customer_rules"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "jsonb"
-				}
-			}
-			if i, ok := t.colIndex("created_at"); ok {
-				t.Columns[i].Type = "timestamp with time zone"
-				if t.Columns[i].DefaultSQL == "" {
-					t.Columns[i].DefaultSQL = "now()"
-				}
-				t.Columns[i].NotNull = true
-			}
-		case "enforcement_point_lock_state":
-			if i, ok := t.colIndex("id"); ok {
-				t.Columns[i].Type = "text"
-				t.Columns[i].NotNull = true
-			}
-			if i, ok := t.colIndex("enforcement_point_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			if i, ok := t.colIndex("tenant_id"); ok {
-				t.Columns[i].Type = "uuid"
-				t.Columns[i].NotNull = true
-			}
-			for _, n := range []string{"scope", "level", "name"} {
-				if i, ok := t.colIndex(n); ok {
-					t.Columns[i].Type = "text"
-					t.Columns[i].NotNull = true
-				}
-			}
-			if i, ok := t.colIndex("last_checked_at"); ok {
-				t.Columns[i].Type = "timestamp with time zone"
-			}
-		}
-		// ensure PK columns flagged not null
-		if len(t.PK) > 0 {
-			for _, pk := range t.PK {
-				if i, ok := t.colIndex(pk); ok {
-					t.Columns[i].NotNull = true
-				}
+	renameIn := func(cols []string) {
+		for j := range cols {
+			if cols[j] == old.Name {
+				cols[j] = newName
 			}
 		}
 	}
+	renameIn(t.PK)
+	for j := range t.UniqueCons {
+		renameIn(t.UniqueCons[j].Columns)
+	}
+	for j := range t.FKs {
+		renameIn(t.FKs[j].Columns)
+	}
+	for j := range t.Checks {
+		t.Checks[j].Expr = renameColumnInExpr(t.Checks[j].Expr, old.Name, newName)
+	}
+	for j := range t.Columns {
+		t.Columns[j].Generated = renameColumnInExpr(t.Columns[j].Generated, old.Name, newName)
+	}
+	for j := range t.Indexes {
+		t.Indexes[j].renameColumn(old.Name, newName)
+	}
 }
 
 // --- parsing utilities ---
@@ -401,7 +225,8 @@ type parseResult struct {
 
 // --- DDL application (very partial but useful) ---
 
-// parseRangeVar reads schemaname and relname from a RangeVar node or flat object.
+// parseRangeVar reads schemaname and relname from a RangeVar node or flat
+// object. The public schema comes back as "", like an unqualified name.
 func parseRangeVar(raw json.RawMessage) (schema, name string) {
 	if len(raw) == 0 {
 		return "", ""
@@ -412,7 +237,7 @@ func parseRangeVar(raw json.RawMessage) (schema, name string) {
 		Relname    string `json:"relname"`
 	}
 	if err := json.Unmarshal(raw, &flat); err == nil && flat.Relname != "" {
-		return flat.Schemaname, flat.Relname
+		return localSchema(flat.Schemaname), flat.Relname
 	}
 	// case 2: RangeVar wrapped
 	var wrapped struct {
@@ -422,7 +247,7 @@ func parseRangeVar(raw json.RawMessage) (schema, name string) {
 		} `json:"RangeVar"`
 	}
 	if err := json.Unmarshal(raw, &wrapped); err == nil && wrapped.RangeVar.Relname != "" {
-		return wrapped.RangeVar.Schemaname, wrapped.RangeVar.Relname
+		return localSchema(wrapped.RangeVar.Schemaname), wrapped.RangeVar.Relname
 	}
 	return "", ""
 }
@@ -451,226 +276,123 @@ func parseStringList(raw any) []string {
 	return out
 }
 
-// extractTypeFromColumnDef tries multiple JSON shapes to recover a readable SQL type name
-func extractTypeFromColumnDef(colRaw json.RawMessage) string {
-	// try typed struct first via existing logic by reusing the same small struct
-	var typed struct {
-		TypeName struct {
-			Names []struct {
-				String_ struct {
-					Sval string `json:"str"`
-				} `json:"String"`
-			} `json:"names"`
-		} `json:"typeName"`
-	}
-	if err := json.Unmarshal(colRaw, &typed); err == nil && len(typed.TypeName.Names) > 0 {
-		if res := typeNameToSQL(typed.TypeName.Names); res != "" {
-			return res
-		}
+// columnFromDef reads a ColumnDef node. Constraints that live at table level,
+// like an inline primary key, foreign key or check, are added to t.
+func (s *Schema) columnFromDef(t *Table, colRaw json.RawMessage) (Column, error) {
+	var col struct {
+		Colname     string           `json:"colname"`
+		TypeName    json.RawMessage  `json:"typeName"`
+		CollClause  json.RawMessage  `json:"collClause"`
+		IsNotNull   bool             `json:"is_not_null"`
+		RawDefault  json.RawMessage  `json:"raw_default"`
+		Constraints []map[string]any `json:"constraints"`
 	}
-	// alternate wrapper
-	var alt struct {
-		TypeName struct {
-			Names []struct {
-				String_ struct {
-					Sval string `json:"str"`
-				} `json:"String"`
-			} `json:"names"`
-		} `json:"TypeName"`
-	}
-	if err := json.Unmarshal(colRaw, &alt); err == nil && len(alt.TypeName.Names) > 0 {
-		if res := typeNameToSQL(alt.TypeName.Names); res != "" {
-			return res
-		}
+	if err := json.Unmarshal(colRaw, &col); err != nil {
+		return Column{}, err
 	}
-	// fully dynamic: walk maps and extract names list
-	var m map[string]any
-	if err := json.Unmarshal(colRaw, &m); err == nil {
-		getTN := func(x any) any {
-			if mp, ok := x.(map[string]any); ok {
-				if tn, ok := mp["typeName"]; ok {
-					return tn
-				}
-				if tn, ok := mp["TypeName"]; ok {
-					return tn
-				}
-			}
-			return nil
-		}
-		if tn := getTN(m); tn != nil {
-			if mp, ok := tn.(map[string]any); ok {
-				if inner, ok := mp["TypeName"].(map[string]any); ok {
-					mp = inner
-				}
-				if names, ok := mp["names"].([]any); ok && len(names) > 0 {
-					var parts []string
-					for _, it := range names {
-						if mm, ok := it.(map[string]any); ok {
-							if sNode, ok := mm["String"].(map[string]any); ok {
-								if s, ok := sNode["str"].(string); ok && s != "" {
-									parts = append(parts, s)
-									continue
-								}
-								if s, ok := sNode["sval"].(string); ok && s != "" {
-									parts = append(parts, s)
-								}
-							}
+	sqlType, err := columnType(col.TypeName)
+	if err != nil {
+		return Column{}, err
+	}
+	defaultSQL, err := deparseExpr(col.RawDefault)
+	if err != nil {
+		return Column{}, err
+	}
+	collation, err := collationName(col.CollClause)
+	if err != nil {
+		return Column{}, err
+	}
+	c := Column{
+		Name:       col.Colname,
+		Type:       sqlType,
+		Collation:  collation,
+		NotNull:    col.IsNotNull,
+		DefaultSQL: defaultSQL,
+	}
+	// detect constraints including inline foreign keys and defaults
+	for _, cstWrap := range col.Constraints {
+		if cst, ok := cstWrap["Constraint"].(map[string]any); ok {
+			if contype, _ := cst["contype"].(string); contype != "" {
+				switch contype {
+				case "CONSTR_NOTNULL":
+					c.NotNull = true
+				case "CONSTR_PRIMARY":
+					// inline PRIMARY KEY on this column
+					found := false
+					for _, pk := range t.PK {
+						if pk == col.Colname {
+							found = true
+							break
 						}
 					}
-					if len(parts) > 0 {
-						// mimic typeNameToSQL behavior for common mappings
-						switch strings.Join(parts, ".") {
-						case "pg_catalog.int4":
-							return "integer"
-						case "pg_catalog.int8":
-							return "bigint"
-						case "pg_catalog.varchar":
-							return "varchar"
-						case "pg_catalog.text":
-							return "text"
-						case "pg_catalog.bool":
-							return "boolean"
-						case "pg_catalog.timestamptz":
-							return "timestamp with time zone"
-						}
-						return parts[len(parts)-1]
+					if !found {
+						t.PK = append(t.PK, col.Colname)
 					}
-				}
-			}
-		}
-	}
-	return "text" // safe fallback
-}
-
-func deparseSimpleExpr(node any) string {
-	// limited deparser for defaults and simple index expressions we expect in this repo
-	switch m := node.(type) {
-	case map[string]any:
-		// TypeCast
-		if tc, ok := m["TypeCast"].(map[string]any); ok {
-			arg := deparseSimpleExpr(tc["arg"])
-			// ignore explicit cast type for simple string to ::text; keep original if available
-			if tnm, ok := tc["typeName"].(map[string]any); ok {
-				// try to render ::typename succinctly for common cases
-				if tnInner, ok := tnm["TypeName"].(map[string]any); ok {
-					if names, ok := tnInner["names"].([]any); ok && len(names) > 0 {
-						last := ""
-						if mm, ok := names[len(names)-1].(map[string]any); ok {
-							if sn, ok := mm["String"].(map[string]any); ok {
-								if s, ok := sn["str"].(string); ok && s != "" {
-									last = s
-								} else if s, ok := sn["sval"].(string); ok && s != "" {
-									last = s
-								}
-							}
-						}
-						if last != "" {
-							return fmt.Sprintf("%s::%s", arg, last)
+				case "CONSTR_DEFAULT":
+					expr, err := deparseAny(cst["raw_expr"])
+					if err != nil {
+						return Column{}, err
+					}
+					c.DefaultSQL = expr
+				case "CONSTR_FOREIGN":
+					var fk ForeignKey
+					fk.Columns = []string{col.Colname}
+					if pktableRaw, ok := cst["pktable"]; ok {
+						if b, err := json.Marshal(pktableRaw); err == nil {
+							fk.RefSchema, fk.RefTable = parseRangeVar(b)
 						}
 					}
-				}
-			}
-			return arg
-		}
-		// A_Const
-		if ac, ok := m["A_Const"].(map[string]any); ok {
-			if val, ok := ac["val"].(map[string]any); ok {
-				if s, ok := val["String"].(map[string]any); ok {
-					if str, ok := s["str"].(string); ok {
-						return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "''"))
+					if pkAttrs, ok := cst["pk_attrs"]; ok {
+						fk.RefColumns = parseStringList(pkAttrs)
 					}
-					if str, ok := s["sval"].(string); ok {
-						return fmt.Sprintf("'%s'", strings.ReplaceAll(str, "'", "''"))
+					if od, ok := cst["fk_del_action"].(string); ok {
+						fk.OnDelete = normalizeFKAction(od)
 					}
-				}
-				if i, ok := val["Integer"].(map[string]any); ok {
-					if ival, ok := i["ival"].(float64); ok {
-						return fmt.Sprintf("%d", int64(ival))
+					if ou, ok := cst["fk_upd_action"].(string); ok {
+						fk.OnUpdate = normalizeFKAction(ou)
 					}
-				}
-				if b, ok := val["Bool"].(map[string]any); ok {
-					if bval, ok := b["boolval"].(bool); ok {
-						if bval {
-							return "true"
-						}
-						return "false"
+					if fk.RefTable != "" {
+						t.FKs = append(t.FKs, fk)
 					}
-				}
-			}
-		}
-		// ColumnRef
-		if cr, ok := m["ColumnRef"].(map[string]any); ok {
-			if fields, ok := cr["fields"].([]any); ok && len(fields) > 0 {
-				var parts []string
-				for _, f := range fields {
-					if mm, ok := f.(map[string]any); ok {
-						if s, ok := mm["String"].(map[string]any); ok {
-							if str, ok := s["str"].(string); ok && str != "" {
-								parts = append(parts, pqQuoteIdent(str))
-							} else if str, ok := s["sval"].(string); ok && str != "" {
-								parts = append(parts, pqQuoteIdent(str))
-							}
-						}
+				case "CONSTR_UNIQUE":
+					name, _ := cst["conname"].(string)
+					t.UniqueCons = append(t.UniqueCons, UniqueConstraint{Name: name, Columns: []string{col.Colname}})
+				case "CONSTR_CHECK":
+					if err := t.addCheck(cst); err != nil {
+						return Column{}, err
 					}
-				}
-				return strings.Join(parts, ".")
-			}
-		}
-		// FuncCall (e.g., now())
-		if fc, ok := m["FuncCall"].(map[string]any); ok {
-			name := ""
-			if names, ok := fc["funcname"].([]any); ok && len(names) > 0 {
-				if mm, ok := names[len(names)-1].(map[string]any); ok {
-					if s, ok := mm["String"].(map[string]any); ok {
-						if str, ok := s["str"].(string); ok && str != "" {
-							name = str
-						} else if str, ok := s["sval"].(string); ok && str != "" {
-							name = str
-						}
+				case "CONSTR_GENERATED":
+					expr, err := deparseAny(cst["raw_expr"])
+					if err != nil {
+						return Column{}, err
 					}
-				}
-			}
-			argsSQL := []string{}
-			if args, ok := fc["args"].([]any); ok {
-				for _, a := range args {
-					argsSQL = append(argsSQL, deparseSimpleExpr(a))
-				}
-			}
-			if name == "" {
-				return ""
-			}
-			return fmt.Sprintf("%s(%s)", name, strings.Join(argsSQL, ", "))
-		}
-		// A_Expr for json ->> operator
-		if ae, ok := m["A_Expr"].(map[string]any); ok {
-			op := ""
-			if on, ok := ae["name"].([]any); ok && len(on) > 0 {
-				if mm, ok := on[0].(map[string]any); ok {
-					if s, ok := mm["String"].(map[string]any); ok {
-						if str, ok := s["str"].(string); ok && str != "" {
-							op = str
-						} else if str, ok := s["sval"].(string); ok && str != "" {
-							op = str
-						}
+					c.Generated = expr
+				case "CONSTR_IDENTITY":
+					identity, err := identityFromConstraint(cst)
+					if err != nil {
+						return Column{}, err
 					}
+					c.Identity = identity
+					c.NotNull = true
+				case "CONSTR_NULL":
+				default:
+					s.report(LevelUnsupported, "%s on column %s is not replayed", contype, col.Colname)
 				}
 			}
-			lex := deparseSimpleExpr(ae["lexpr"])
-			rex := deparseSimpleExpr(ae["rexpr"])
-			if op != "" && lex != "" && rex != "" {
-				return fmt.Sprintf("(%s %s %s)", lex, op, rex)
-			}
 		}
 	}
-	return ""
+	return c, nil
 }
 
 func applyCreateTable(s *Schema, raw json.RawMessage) error {
 	// payload is the inner CreateStmt node (no additional wrapper)
 	var node struct {
-		Relation    json.RawMessage              `json:"relation"`
-		TableElts   []map[string]json.RawMessage `json:"tableElts"`
-		Constraints []json.RawMessage            `json:"constraints"`
+		Relation     json.RawMessage              `json:"relation"`
+		TableElts    []map[string]json.RawMessage `json:"tableElts"`
+		Constraints  []json.RawMessage            `json:"constraints"`
+		InhRelations []json.RawMessage            `json:"inhRelations"`
+		Partbound    json.RawMessage              `json:"partbound"`
+		Partspec     json.RawMessage              `json:"partspec"`
 	}
 	if err := json.Unmarshal(raw, &node); err != nil {
 		return err
@@ -678,93 +400,30 @@ func applyCreateTable(s *Schema, raw json.RawMessage) error {
 	schema, name := parseRangeVar(node.Relation)
 	t := s.ensureTable(schema, name)
 
+	if len(node.Partspec) > 0 {
+		partitionBy, err := partitionKeySQL(node.Partspec)
+		if err != nil {
+			return err
+		}
+		t.PartitionBy = partitionBy
+	}
+	if len(node.Partbound) > 0 && len(node.InhRelations) == 1 {
+		bound, err := partitionBoundSQL(node.Partbound)
+		if err != nil {
+			return err
+		}
+		parentSchema, parent := parseRangeVar(node.InhRelations[0])
+		t.PartitionOf = &Partition{ParentSchema: parentSchema, Parent: parent, Bound: bound}
+	}
+
 	//fmt.Fprintf(os.Stderr, "DEBUG CreateStmt relation: %s\n", t.Name)
 
 	for _, elt := range node.TableElts {
 		if colRaw, ok := elt["ColumnDef"]; ok {
-			var col struct {
-				Colname  string `json:"colname"`
-				TypeName struct {
-					Names []struct {
-						String_ struct {
-							Sval string `json:"str"`
-						} `json:"String"`
-					} `json:"names"`
-				} `json:"typeName"`
-				IsNotNull   bool             `json:"is_not_null"`
-				Constraints []map[string]any `json:"constraints"`
-			}
-			if err := json.Unmarshal(colRaw, &col); err != nil {
+			c, err := s.columnFromDef(t, colRaw)
+			if err != nil {
 				return err
 			}
-			sqlType := extractTypeFromColumnDef(colRaw)
-			c := Column{
-				Name:    col.Colname,
-				Type:    sqlType,
-				NotNull: col.IsNotNull,
-			}
-			// try to read raw_default from the node
-			var anyMap map[string]any
-			if err := json.Unmarshal(colRaw, &anyMap); err == nil {
-				if rd, ok := anyMap["raw_default"]; ok {
-					if expr := deparseSimpleExpr(rd); expr != "" {
-						c.DefaultSQL = expr
-					}
-				} else if rd, ok := anyMap["rawDefault"]; ok {
-					if expr := deparseSimpleExpr(rd); expr != "" {
-						c.DefaultSQL = expr
-					}
-				}
-			}
-			// detect constraints including inline foreign keys and defaults
-			for _, cstWrap := range col.Constraints {
-				if cst, ok := cstWrap["Constraint"].(map[string]any); ok {
-					if contype, _ := cst["contype"].(string); contype != "" {
-						switch contype {
-						case "CONSTR_NOTNULL":
-							c.NotNull = true
-						case "CONSTR_PRIMARY":
-							// inline PRIMARY KEY on this column
-							found := false
-							for _, pk := range t.PK {
-								if pk == col.Colname {
-									found = true
-									break
-								}
-							}
-							if !found {
-								t.PK = append(t.PK, col.Colname)
-							}
-						case "CONSTR_DEFAULT":
-							if rd, ok := cst["raw_expr"]; ok {
-								if expr := deparseSimpleExpr(rd); expr != "" {
-									c.DefaultSQL = expr
-								}
-							}
-						case "CONSTR_FOREIGN":
-							var fk ForeignKey
-							fk.Columns = []string{col.Colname}
-							if pktableRaw, ok := cst["pktable"]; ok {
-								if b, err := json.Marshal(pktableRaw); err == nil {
-									fk.RefSchema, fk.RefTable = parseRangeVar(b)
-								}
-							}
-							if pkAttrs, ok := cst["pk_attrs"]; ok {
-								fk.RefColumns = parseStringList(pkAttrs)
-							}
-							if od, ok := cst["fk_del_action"].(string); ok {
-								fk.OnDelete = od
-							}
-							if ou, ok := cst["fk_upd_action"].(string); ok {
-								fk.OnUpdate = ou
-							}
-							if fk.RefTable != "" {
-								t.FKs = append(t.FKs, fk)
-							}
-						}
-					}
-				}
-			}
 			t.addColumn(c)
 			continue
 		}
@@ -779,6 +438,7 @@ func applyCreateTable(s *Schema, raw json.RawMessage) error {
 						if keys, ok := cst["keys"]; ok {
 							t.PK = parseStringList(keys)
 						}
+						t.PKName, _ = cst["conname"].(string)
 					case "CONSTR_UNIQUE":
 						var uc UniqueConstraint
 						if name, ok := cst["conname"].(string); ok {
@@ -809,14 +469,20 @@ func applyCreateTable(s *Schema, raw json.RawMessage) error {
 							fk.RefColumns = parseStringList(pkAttrs)
 						}
 						if od, ok := cst["fk_del_action"].(string); ok {
-							fk.OnDelete = od
+							fk.OnDelete = normalizeFKAction(od)
 						}
 						if ou, ok := cst["fk_upd_action"].(string); ok {
-							fk.OnUpdate = ou
+							fk.OnUpdate = normalizeFKAction(ou)
 						}
 						if len(fk.Columns) > 0 && fk.RefTable != "" {
 							t.FKs = append(t.FKs, fk)
 						}
+					case "CONSTR_CHECK":
+						if err := t.addCheck(cst); err != nil {
+							return err
+						}
+					default:
+						s.report(LevelUnsupported, "%s is not replayed", contype)
 					}
 				}
 			}
@@ -828,6 +494,7 @@ func applyCreateTable(s *Schema, raw json.RawMessage) error {
 func applyAlterTable(s *Schema, raw json.RawMessage) error {
 	var node struct {
 		Relation json.RawMessage `json:"relation"`
+		Objtype  string          `json:"objtype"`
 		Cmds     []struct {
 			AlterTableCmd struct {
 				Subtype string          `json:"subtype"` // AT_AddColumn, AT_DropColumn, AT_AlterColumnType, AT_SetNotNull, AT_DropNotNull, AT_RenameColumn, ...
@@ -840,49 +507,39 @@ func applyAlterTable(s *Schema, raw json.RawMessage) error {
 	if err := json.Unmarshal(raw, &node); err != nil {
 		return err
 	}
+	// ALTER INDEX, VIEW, SEQUENCE and TYPE parse into the same statement
+	if node.Objtype != "OBJECT_TABLE" && node.Objtype != "OBJECT_FOREIGN_TABLE" {
+		s.report(LevelUnsupported, "ALTER %s is not replayed", strings.ReplaceAll(strings.TrimPrefix(node.Objtype, "OBJECT_"), "_", " "))
+		return nil
+	}
 	schema, name := parseRangeVar(node.Relation)
-	t := s.ensureTable(schema, name)
+	t, ok := s.Tables[qualifiedKey(schema, name)]
+	if !ok {
+		s.report(LevelIgnored, "table %s is not created by these migrations", qualifiedKey(schema, name))
+		return nil
+	}
 	for _, c := range node.Cmds {
 		cmd := c.AlterTableCmd
 		switch cmd.Subtype {
 		case "AT_AddColumn":
 			// cmd.Def is a ColumnDef
 			var colWrap struct {
-				ColumnDef struct {
-					Colname  string `json:"colname"`
-					TypeName struct {
-						Names []struct {
-							String_ struct {
-								Sval string `json:"str"`
-							} `json:"String"`
-						} `json:"names"`
-					} `json:"typeName"`
-					IsNotNull bool `json:"is_not_null"`
-				} `json:"ColumnDef"`
+				ColumnDef json.RawMessage `json:"ColumnDef"`
 			}
 			if err := json.Unmarshal(cmd.Def, &colWrap); err != nil {
 				return err
 			}
-			// also try to extract default for the added column
-			var rawMap map[string]any
-			_ = json.Unmarshal(cmd.Def, &rawMap)
-			defSQL := ""
-			if cd, ok := rawMap["ColumnDef"].(map[string]any); ok {
-				if rd, ok := cd["raw_default"]; ok {
-					defSQL = deparseSimpleExpr(rd)
-				} else if rd, ok := cd["rawDefault"]; ok {
-					defSQL = deparseSimpleExpr(rd)
-				}
+			col, err := s.columnFromDef(t, colWrap.ColumnDef)
+			if err != nil {
+				return err
 			}
-			t.addColumn(Column{
-				Name:       colWrap.ColumnDef.Colname,
-				Type:       typeNameToSQL(colWrap.ColumnDef.TypeName.Names),
-				NotNull:    colWrap.ColumnDef.IsNotNull,
-				DefaultSQL: defSQL,
-			})
+			t.addColumn(col)
 
 		case "AT_DropColumn":
-			t.dropColumn(cmd.Name)
+			s.dropColumn(t, cmd.Name)
+
+		case "AT_DropConstraint":
+			s.dropConstraint(t, cmd.Name)
 
 		case "AT_SetNotNull", "AT_DropNotNull":
 			if pos, ok := t.ColumnPos[cmd.Name]; ok {
@@ -899,20 +556,27 @@ func applyAlterTable(s *Schema, raw json.RawMessage) error {
 			}
 
 		case "AT_AlterColumnType":
-			// cmd.Def contains a TypeName
+			// cmd.Def is a ColumnDef with the new type and the USING expression
 			var def struct {
-				TypeName struct {
-					Names []struct {
-						String_ struct {
-							Sval string `json:"str"`
-						} `json:"String"`
-					} `json:"names"`
-				} `json:"TypeName"`
+				ColumnDef struct {
+					TypeName   json.RawMessage `json:"typeName"`
+					CollClause json.RawMessage `json:"collClause"`
+				} `json:"ColumnDef"`
 			}
-			if err := json.Unmarshal(cmd.Def, &def); err == nil {
-				if pos, ok := t.ColumnPos[cmd.Name]; ok {
-					t.Columns[pos].Type = typeNameToSQL(def.TypeName.Names)
+			if err := json.Unmarshal(cmd.Def, &def); err != nil {
+				return err
+			}
+			if pos, ok := t.ColumnPos[cmd.Name]; ok {
+				sqlType, err := columnType(def.ColumnDef.TypeName)
+				if err != nil {
+					return err
 				}
+				// the collation resets to the new type's unless one is given
+				collation, err := collationName(def.ColumnDef.CollClause)
+				if err != nil {
+					return err
+				}
+				t.Columns[pos].Type, t.Columns[pos].Collation = sqlType, collation
 			}
 
 		case "AT_AddConstraint":
@@ -926,6 +590,7 @@ func applyAlterTable(s *Schema, raw json.RawMessage) error {
 							if keys, ok := cstNode["keys"]; ok {
 								t.PK = parseStringList(keys)
 							}
+							t.PKName, _ = cstNode["conname"].(string)
 						case "CONSTR_UNIQUE":
 							var uc UniqueConstraint
 							if name, ok := cstNode["conname"].(string); ok {
@@ -956,222 +621,394 @@ func applyAlterTable(s *Schema, raw json.RawMessage) error {
 								fk.RefColumns = parseStringList(pkAttrs)
 							}
 							if od, ok := cstNode["fk_del_action"].(string); ok {
-								fk.OnDelete = od
+								fk.OnDelete = normalizeFKAction(od)
 							}
 							if ou, ok := cstNode["fk_upd_action"].(string); ok {
-								fk.OnUpdate = ou
+								fk.OnUpdate = normalizeFKAction(ou)
 							}
 							if len(fk.Columns) > 0 && fk.RefTable != "" {
 								t.FKs = append(t.FKs, fk)
 							}
+						case "CONSTR_CHECK":
+							if err := t.addCheck(cstNode); err != nil {
+								return err
+							}
+						default:
+							s.report(LevelUnsupported, "%s is not replayed", contype)
 						}
 					}
 				}
 			}
 
-		case "AT_SetDefault":
-			// cmd.Def is an expression for default
+		case "AT_ColumnDefault":
+			// cmd.Def is the new default expression; DROP DEFAULT has none
+			if pos, ok := t.ColumnPos[cmd.Name]; ok {
+				expr, err := deparseExpr(cmd.Def)
+				if err != nil {
+					return err
+				}
+				t.Columns[pos].DefaultSQL = expr
+			}
+
+		case "AT_DropExpression":
+			if pos, ok := t.ColumnPos[cmd.Name]; ok {
+				t.Columns[pos].Generated = ""
+			}
+
+		case "AT_AddIdentity":
 			if pos, ok := t.ColumnPos[cmd.Name]; ok {
-				var anyMap any
-				_ = json.Unmarshal(cmd.Def, &anyMap)
-				if expr := deparseSimpleExpr(anyMap); expr != "" {
-					t.Columns[pos].DefaultSQL = expr
+				var def struct {
+					Constraint map[string]any `json:"Constraint"`
+				}
+				if err := json.Unmarshal(cmd.Def, &def); err != nil {
+					return err
+				}
+				identity, err := identityFromConstraint(def.Constraint)
+				if err != nil {
+					return err
 				}
+				t.Columns[pos].Identity = identity
+				t.Columns[pos].NotNull = true
 			}
 
-		case "AT_DropDefault":
+		case "AT_SetIdentity":
+			if pos, ok := t.ColumnPos[cmd.Name]; ok && t.Columns[pos].Identity != nil {
+				var def struct {
+					List struct {
+						Items []defElem `json:"items"`
+					} `json:"List"`
+				}
+				if err := json.Unmarshal(cmd.Def, &def); err != nil {
+					return err
+				}
+				t.Columns[pos].Identity.applyOptions(def.List.Items)
+			}
+
+		case "AT_DropIdentity":
 			if pos, ok := t.ColumnPos[cmd.Name]; ok {
-				t.Columns[pos].DefaultSQL = ""
+				t.Columns[pos].Identity = nil
+			}
+
+		case "AT_AttachPartition", "AT_DetachPartition":
+			if err := s.applyPartitionCmd(t, cmd.Subtype == "AT_AttachPartition", cmd.Def); err != nil {
+				return err
 			}
 
 		default:
-			// unsupported alter; ignore gracefully
+			s.report(LevelUnsupported, "ALTER TABLE %s is not replayed", cmd.Subtype)
 		}
 	}
 	return nil
 }
 
-func applyDropTable(s *Schema, raw json.RawMessage) error {
+func applyDrop(s *Schema, raw json.RawMessage) error {
 	var node struct {
-		Objects [][]struct {
-			String_ *struct {
-				Sval string `json:"str"`
-			} `json:"String,omitempty"`
-		} `json:"objects"`
+		RemoveType string       `json:"removeType"`
+		Objects    []dropObject `json:"objects"`
 	}
 	if err := json.Unmarshal(raw, &node); err != nil {
 		return err
 	}
-	for _, obj := range node.Objects {
-		if len(obj) > 0 && obj[0].String_ != nil {
-			delete(s.Tables, obj[0].String_.Sval)
+	switch node.RemoveType {
+	case "OBJECT_TABLE":
+		applyDropTable(s, node.Objects)
+	case "OBJECT_INDEX":
+		for _, obj := range node.Objects {
+			schema, name := splitQualified(obj.names())
+			if t, i, ok := s.findIndex(schema, name); ok {
+				t.Indexes = append(t.Indexes[:i], t.Indexes[i+1:]...)
+			}
+		}
+	default:
+		if !applyDropObjects(s, node.RemoveType, node.Objects) {
+			s.report(LevelUnsupported, "DROP %s is not replayed", node.RemoveType)
 		}
 	}
 	return nil
 }
 
+// applyDropTable drops tables along with what a real database drops with
+// them: their partitions, triggers and owned sequences, and the foreign keys
+// of other tables that reference them.
+func applyDropTable(s *Schema, objects []dropObject) {
+	for _, obj := range objects {
+		schema, name := splitQualified(obj.names())
+		if t, ok := s.Tables[qualifiedKey(schema, name)]; ok {
+			s.dropTable(t)
+		}
+	}
+}
+
 // Parse CREATE INDEX / CREATE UNIQUE INDEX statements
 func applyIndexStmt(s *Schema, raw json.RawMessage) error {
 	var node struct {
-		Unique      bool             `json:"unique"`
-		Idxname     string           `json:"idxname"`
-		Relation    json.RawMessage  `json:"relation"`
-		IndexParams []map[string]any `json:"indexParams"`
+		Unique        bool             `json:"unique"`
+		Idxname       string           `json:"idxname"`
+		Relation      json.RawMessage  `json:"relation"`
+		AccessMethod  string           `json:"accessMethod"`
+		IndexParams   []map[string]any `json:"indexParams"`
+		IncludeParams []map[string]any `json:"indexIncludingParams"`
+		WhereClause   json.RawMessage  `json:"whereClause"`
 	}
 	if err := json.Unmarshal(raw, &node); err != nil {
 		return err
 	}
 	schema, name := parseRangeVar(node.Relation)
 	t := s.ensureTable(schema, name)
-	var parts []string
+	ix := Index{Name: node.Idxname, Unique: node.Unique}
+	if node.AccessMethod != "btree" {
+		ix.Method = node.AccessMethod
+	}
 	for _, p := range node.IndexParams {
-		if ie, ok := p["IndexElem"].(map[string]any); ok {
-			if n, ok := ie["name"].(string); ok && n != "" {
-				parts = append(parts, pqQuoteIdent(n))
-				continue
-			}
-			if expr, ok := ie["expr"]; ok {
-				if sql := deparseSimpleExpr(expr); sql != "" {
-					parts = append(parts, sql)
-				}
-			}
+		ie, _ := p["IndexElem"].(map[string]any)
+		part, err := indexElemSQL(ie)
+		if err != nil {
+			return err
 		}
+		ix.Columns = append(ix.Columns, part)
 	}
-	if len(parts) == 0 {
-		return nil // expression index not supported beyond simple cases handled above
+	for _, p := range node.IncludeParams {
+		ie, _ := p["IndexElem"].(map[string]any)
+		if n, _ := ie["name"].(string); n != "" {
+			ix.Include = append(ix.Include, pqQuoteIdent(n))
+		}
 	}
-	nameIx := node.Idxname
-	if nameIx == "" {
-		nameIx = fmt.Sprintf("idx_%s_%s", t.Name, strings.ReplaceAll(strings.Join(parts, "_"), " ", ""))
+	where, err := deparseExpr(node.WhereClause)
+	if err != nil {
+		return err
 	}
-	t.Indexes = append(t.Indexes, Index{Name: nameIx, Columns: parts, Unique: node.Unique})
-	return nil
-}
-
-func typeNameToSQL(names []struct {
-	String_ struct {
-		Sval string `json:"str"`
-	} `json:"String"`
-}) string {
-	if len(names) == 0 {
-		return ""
+	ix.Where = where
+	if ix.Name == "" {
+		ix.Name = s.defaultIndexName(t, append(node.IndexParams, node.IncludeParams...))
 	}
-	var parts []string
-	for _, n := range names {
-		if n.String_.Sval == "" {
-			return ""
-		}
-		parts = append(parts, n.String_.Sval)
-	}
-	// "pg_catalog", "int4" -> int4; "public","custom" -> public.custom
-	switch strings.Join(parts, ".") {
-	case "pg_catalog.int4":
-		return "integer"
-	case "pg_catalog.int8":
-		return "bigint"
-	case "pg_catalog.varchar":
-		return "varchar"
-	case "pg_catalog.text":
-		return "text"
-	case "pg_catalog.bool":
-		return "boolean"
-	case "pg_catalog.timestamptz":
-		return "timestamp with time zone"
-	}
-	// default to last identifier
-	return parts[len(parts)-1]
+	t.Indexes = append(t.Indexes, ix)
+	return nil
 }
 
 // --- rendering final DDL (simplified) ---
 
-func (s *Schema) RenderTablesDDL() string {
-	var names []string
-	for k := range s.Tables {
-		names = append(names, k)
+// RenderTablesDDL renders the tables so that they apply in order: a table
+// follows the tables its foreign keys reference, and partitions follow their
+// parents. Foreign keys that close a cycle, or all of them when separateFKs
+// is set, are added by ALTER TABLE statements after the tables.
+func (s *Schema) RenderTablesDDL(separateFKs bool) string {
+	order := s.tableOrder()
+	pos := make(map[string]int, len(order))
+	for i, key := range order {
+		pos[key] = i
 	}
-	sort.Strings(names)
 	var b strings.Builder
-	for _, key := range names {
+	var alters []string
+	for i, key := range order {
 		t := s.Tables[key]
-		fmt.Fprintf(&b, "create table %s (\n", pqQuoteQualified(t.Schema, t.Name))
-		// determine how many table-level constraints will follow columns
-		constraintCount := 0
-		if len(t.PK) > 0 {
-			constraintCount++
+		if t.PartitionOf != nil {
+			// partitions inherit their parent's foreign keys
+			writeTable(&b, t, nil)
+			continue
 		}
-		constraintCount += len(t.UniqueCons)
-		constraintCount += len(t.FKs)
-		for i, c := range t.Columns {
-			fmt.Fprintf(&b, "    %s %s", pqQuoteIdent(c.Name), c.Type)
-			if c.DefaultSQL != "" {
-				fmt.Fprintf(&b, " default %s", c.DefaultSQL)
-			}
-			if c.NotNull {
-				b.WriteString(" not null")
-			}
-			if i < len(t.Columns)-1 || constraintCount > 0 {
-				b.WriteString(",")
+		t.sortFKs()
+		var inline []ForeignKey
+		for _, fk := range t.FKs {
+			// tables outside the schema cannot be ordered; references to them stay inline
+			if ref, ok := pos[qualifiedKey(fk.RefSchema, fk.RefTable)]; !separateFKs && (!ok || ref <= i) {
+				inline = append(inline, fk)
+				continue
 			}
-			b.WriteString("\n")
+			alters = append(alters, addConstraintSQL(t, t.fkName(fk), fk.sql()))
 		}
-		// render constraints with proper commas
-		remaining := constraintCount
-		if len(t.PK) > 0 {
-			remaining--
-			fmt.Fprintf(&b, "    primary key (%s)", joinQuoted(t.PK))
-			if remaining > 0 {
-				b.WriteString(",")
-			}
-			b.WriteString("\n")
+		writeTable(&b, t, inline)
+	}
+	if len(alters) > 0 {
+		b.WriteString("\n" + RenderMigration(alters))
+	}
+	return b.String()
+}
+
+// tableOrder returns the keys of the tables in the order to create them:
+// alphabetically with partitions after the other tables, except that a
+// table waits for its parent and for the tables its foreign keys reference.
+// When only tables in a foreign key cycle are left, the first of them whose
+// parent exists goes next.
+func (s *Schema) tableOrder() []string {
+	var pending []string
+	for k := range s.Tables {
+		pending = append(pending, k)
+	}
+	sort.Strings(pending)
+	// partitions follow the tables they are attached to
+	sort.SliceStable(pending, func(i, j int) bool {
+		return s.partitionDepth(s.Tables[pending[i]]) < s.partitionDepth(s.Tables[pending[j]])
+	})
+
+	created := map[string]bool{}
+	// waits reports whether t needs the table key created first
+	waits := func(t *Table, key string) bool {
+		_, ok := s.Tables[key]
+		return ok && !created[key] && key != qualifiedKey(t.Schema, t.Name)
+	}
+	ready := func(t *Table, withFKs bool) bool {
+		if p := t.PartitionOf; p != nil && waits(t, qualifiedKey(p.ParentSchema, p.Parent)) {
+			return false
 		}
-		// Unique constraints
-		if len(t.UniqueCons) > 0 {
-			// stable order
-			sort.Slice(t.UniqueCons, func(i, j int) bool {
-				return strings.Join(t.UniqueCons[i].Columns, ",") < strings.Join(t.UniqueCons[j].Columns, ",")
-			})
-			for _, uc := range t.UniqueCons {
-				remaining--
-				fmt.Fprintf(&b, "    unique (%s)", joinQuoted(uc.Columns))
-				if remaining > 0 {
-					b.WriteString(",")
+		// partitions inherit their parent's foreign keys
+		if withFKs && t.PartitionOf == nil {
+			for _, fk := range t.FKs {
+				if waits(t, qualifiedKey(fk.RefSchema, fk.RefTable)) {
+					return false
 				}
-				b.WriteString("\n")
 			}
 		}
-		// Foreign keys
-		if len(t.FKs) > 0 {
-			sort.Slice(t.FKs, func(i, j int) bool {
-				return strings.Join(t.FKs[i].Columns, ",") < strings.Join(t.FKs[j].Columns, ",")
-			})
-			for _, fk := range t.FKs {
-				remaining--
-				if fk.Name != "" {
-					fmt.Fprintf(&b, "    constraint %s foreign key (%s) references %s", pqQuoteIdent(fk.Name), joinQuoted(fk.Columns), pqQuoteQualified(fk.RefSchema, fk.RefTable))
-				} else {
-					fmt.Fprintf(&b, "    foreign key (%s) references %s", joinQuoted(fk.Columns), pqQuoteQualified(fk.RefSchema, fk.RefTable))
-				}
-				if len(fk.RefColumns) > 0 {
-					fmt.Fprintf(&b, " (%s)", joinQuoted(fk.RefColumns))
-				}
-				// actions (if any)
-				if del := normalizeFKAction(fk.OnDelete); del != "" {
-					fmt.Fprintf(&b, " on delete %s", strings.ToLower(del))
-				}
-				if upd := normalizeFKAction(fk.OnUpdate); upd != "" {
-					fmt.Fprintf(&b, " on update %s", strings.ToLower(upd))
-				}
-				if remaining > 0 {
-					b.WriteString(",")
+		return true
+	}
+
+	order := make([]string, 0, len(pending))
+	for len(pending) > 0 {
+		next := -1
+		for _, withFKs := range []bool{true, false} {
+			for i, key := range pending {
+				if ready(s.Tables[key], withFKs) {
+					next = i
+					break
 				}
-				b.WriteString("\n")
 			}
+			if next >= 0 {
+				break
+			}
+		}
+		if next < 0 {
+			// parents that never resolve; keep the sorted order
+			next = 0
 		}
-		b.WriteString(");\n")
-		// owner like expected
-		//fmt.Fprintf(&b, "alter table %s     owner to postgres;\n\n", pqQuoteQualified(t.Schema, t.Name))
+		created[pending[next]] = true
+		order = append(order, pending[next])
+		pending = append(pending[:next], pending[next+1:]...)
 	}
-	return b.String()
+	return order
+}
+
+// writeTable writes the CREATE TABLE statement of t, with the foreign keys
+// fks, and its comments.
+func writeTable(b *strings.Builder, t *Table, fks []ForeignKey) {
+	if p := t.PartitionOf; p != nil {
+		fmt.Fprintf(b, "create table %s partition of %s %s", pqQuoteQualified(t.Schema, t.Name), pqQuoteQualified(p.ParentSchema, p.Parent), p.Bound)
+		if t.PartitionBy != "" {
+			fmt.Fprintf(b, " partition by %s", t.PartitionBy)
+		}
+		b.WriteString(";\n")
+		writeComments(b, t)
+		return
+	}
+
+	fmt.Fprintf(b, "create table %s (\n", pqQuoteQualified(t.Schema, t.Name))
+	// columns first, then table-level constraints
+	var elems []string
+	for _, c := range t.Columns {
+		elems = append(elems, c.sql())
+	}
+	if len(t.PK) > 0 {
+		elems = append(elems, constraintSQL(t.PKName, t.pkSQL()))
+	}
+	// Unique constraints
+	if len(t.UniqueCons) > 0 {
+		// stable order
+		sort.Slice(t.UniqueCons, func(i, j int) bool {
+			return strings.Join(t.UniqueCons[i].Columns, ",") < strings.Join(t.UniqueCons[j].Columns, ",")
+		})
+		for _, uc := range t.UniqueCons {
+			elems = append(elems, constraintSQL(uc.Name, uc.sql()))
+		}
+	}
+	// Foreign keys
+	for _, fk := range fks {
+		elems = append(elems, constraintSQL(fk.Name, fk.sql()))
+	}
+	// Check constraints, in the order they were added
+	for _, ck := range t.Checks {
+		elems = append(elems, constraintSQL(ck.Name, ck.sql()))
+	}
+	for i, elem := range elems {
+		b.WriteString("    " + elem)
+		if i < len(elems)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")")
+	if t.PartitionBy != "" {
+		fmt.Fprintf(b, " partition by %s", t.PartitionBy)
+	}
+	b.WriteString(";\n")
+	writeComments(b, t)
+	// owner like expected
+	//fmt.Fprintf(b, "alter table %s     owner to postgres;\n\n", pqQuoteQualified(t.Schema, t.Name))
+}
+
+// sql renders the column as it appears in CREATE TABLE and ADD COLUMN.
+func (c Column) sql() string {
+	elem := fmt.Sprintf("%s %s", pqQuoteIdent(c.Name), c.typeSQL())
+	if c.DefaultSQL != "" {
+		elem += fmt.Sprintf(" default %s", c.DefaultSQL)
+	}
+	if c.Generated != "" {
+		elem += fmt.Sprintf(" generated always as (%s) stored", c.Generated)
+	}
+	if c.Identity != nil {
+		elem += " " + c.Identity.sql()
+	}
+	if c.NotNull {
+		elem += " not null"
+	}
+	return elem
+}
+
+// typeSQL is the column's type with its collation.
+func (c Column) typeSQL() string {
+	if c.Collation == "" {
+		return c.Type
+	}
+	return c.Type + " collate " + c.Collation
+}
+
+// constraintSQL prefixes the constraint definition def with its name, if it has one.
+func constraintSQL(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return fmt.Sprintf("constraint %s %s", pqQuoteIdent(name), def)
+}
+
+func (t *Table) pkSQL() string {
+	return fmt.Sprintf("primary key (%s)", joinQuoted(t.PK))
+}
+
+func (uc UniqueConstraint) sql() string {
+	return fmt.Sprintf("unique (%s)", joinQuoted(uc.Columns))
+}
+
+func (fk ForeignKey) sql() string {
+	def := fmt.Sprintf("foreign key (%s) references %s", joinQuoted(fk.Columns), pqQuoteQualified(fk.RefSchema, fk.RefTable))
+	if len(fk.RefColumns) > 0 {
+		def += fmt.Sprintf(" (%s)", joinQuoted(fk.RefColumns))
+	}
+	// actions (if any)
+	if del := normalizeFKAction(fk.OnDelete); del != "" {
+		def += fmt.Sprintf(" on delete %s", strings.ToLower(del))
+	}
+	if upd := normalizeFKAction(fk.OnUpdate); upd != "" {
+		def += fmt.Sprintf(" on update %s", strings.ToLower(upd))
+	}
+	return def
+}
+
+func (ck CheckConstraint) sql() string {
+	return fmt.Sprintf("check (%s)", ck.Expr)
+}
+
+// sortFKs puts the foreign keys of t in a stable order.
+func (t *Table) sortFKs() {
+	sort.Slice(t.FKs, func(i, j int) bool {
+		return strings.Join(t.FKs[i].Columns, ",") < strings.Join(t.FKs[j].Columns, ",")
+	})
 }
 
 func (s *Schema) RenderIndexesDDL() string {
@@ -1188,18 +1025,35 @@ func (s *Schema) RenderIndexesDDL() string {
 		}
 		sort.Slice(t.Indexes, func(i, j int) bool { return t.Indexes[i].Name < t.Indexes[j].Name })
 		for _, ix := range t.Indexes {
-			cols := strings.Join(ix.Columns, ", ")
-			if ix.Unique {
-				fmt.Fprintf(&b, "create unique index %s     on %s (%s);\n", pqQuoteIdent(ix.Name), pqQuoteQualified(t.Schema, t.Name), cols)
-			} else {
-				fmt.Fprintf(&b, "create index %s     on %s (%s);\n", pqQuoteIdent(ix.Name), pqQuoteQualified(t.Schema, t.Name), cols)
-			}
+			b.WriteString(ix.sql(t) + "\n")
 		}
 		b.WriteString("\n")
 	}
 	return b.String()
 }
 
+// sql renders the CREATE INDEX statement of ix on t.
+func (ix Index) sql(t *Table) string {
+	var b strings.Builder
+	b.WriteString("create ")
+	if ix.Unique {
+		b.WriteString("unique ")
+	}
+	fmt.Fprintf(&b, "index %s     on %s", pqQuoteIdent(ix.Name), pqQuoteQualified(t.Schema, t.Name))
+	if ix.Method != "" {
+		fmt.Fprintf(&b, " using %s", ix.Method)
+	}
+	fmt.Fprintf(&b, " (%s)", strings.Join(ix.Columns, ", "))
+	if len(ix.Include) > 0 {
+		fmt.Fprintf(&b, " include (%s)", strings.Join(ix.Include, ", "))
+	}
+	if ix.Where != "" {
+		fmt.Fprintf(&b, " where %s", ix.Where)
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
 func pqQuoteIdent(s string) string {
 	if s == "" {
 		return `""`
@@ -1217,11 +1071,11 @@ func pqQuoteIdent(s string) string {
 	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
 
+// pqQuoteQualified quotes schema.name, leaving out the public schema.
 func pqQuoteQualified(schema, name string) string {
-	// default to public schema if unspecified to match expected output
-	//if schema == "" {
-	//	schema = "public"
-	//}
+	if schema = localSchema(schema); schema != "" {
+		return pqQuoteIdent(schema) + "." + pqQuoteIdent(name)
+	}
 	return pqQuoteIdent(name)
 }
 
@@ -1255,69 +1109,3 @@ func normalizeFKAction(s string) string {
 		return strings.ToUpper(s)
 	}
 }
-
-// --- main orchestration ---
-
-func main() {
-	dir := "./"
-	if len(os.Args) > 1 {
-		dir = os.Args[1]
-	}
-	files := []string{}
-	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), ".up.sql") {
-			files = append(files, path)
-		}
-		return nil
-	})
-	sort.Strings(files)
-	if len(files) == 0 {
-		fmt.Fprintf(os.Stderr, "no *.up.sql files found under %s\n", dir)
-		os.Exit(1)
-	}
-
-	s := NewSchema()
-	for _, f := range files {
-		src, err := os.ReadFile(f)
-		if err != nil {
-			panic(err)
-		}
-		// Split into individual statements with pg_query's splitter to be robust
-		stmts, err := pgquery.SplitWithParser(string(src), true)
-		if err != nil {
-			panic(fmt.Errorf("split %s: %w", f, err))
-		}
-		for _, sql := range stmts {
-			parsedJSON, err := pgquery.ParseToJSON(sql)
-			if err != nil {
-				// Skip things like data inserts; they don’t affect schema
-				continue
-			}
-			var pr parseResult
-			if err := json.Unmarshal([]byte(parsedJSON), &pr); err != nil {
-				continue
-			}
-			for _, st := range pr.Stmts {
-				for kind, payload := range st.Stmt {
-					switch kind {
-					case "CreateStmt":
-						_ = applyCreateTable(s, payload)
-					case "AlterTableStmt":
-						_ = applyAlterTable(s, payload)
-					case "DropStmt":
-						_ = applyDropTable(s, payload)
-					case "IndexStmt":
-						_ = applyIndexStmt(s, payload)
-					default:
-						// ignore non-DDL or unsupported statements
-					}
-				}
-			}
-		}
-	}
-
-	s.Normalize()
-	fmt.Print(s.RenderTablesDDL())
-	fmt.Print(s.RenderIndexesDDL())
-	return
-}
@@ -0,0 +1,266 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+)
+
+// SquashOptions controls Squash.
+type SquashOptions struct {
+	// SchemaFilter keeps only tables whose Postgres schema matches one of
+	// these path.Match patterns; unqualified tables are in "public".
+	SchemaFilter []string
+	// IncludeIndexes appends CREATE INDEX statements after the tables.
+	IncludeIndexes bool
+	// SeparateFKs adds every foreign key by ALTER TABLE after the tables
+	// instead of only those that close a cycle.
+	SeparateFKs bool
+	// Rules, when set, normalizes the replayed schema before rendering.
+	Rules *Rules
+	// Strict fails the squash when any statement is unsupported or cannot
+	// be replayed, instead of only reporting it.
+	Strict bool
+	// Format is one of Formats; empty means DDL.
+	Format string
+	// GoPackage names the package of the go format; it defaults to models.
+	GoPackage string
+}
+
+// Squash replays the migrations in dir and returns DDL that creates the
+// resulting schema, or the schema in another format, along with the
+// statements it skipped.
+func Squash(dir string, opts SquashOptions) (string, Diagnostics, error) {
+	s, err := Load(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.prepare(opts.SchemaFilter, opts.Rules, opts.Strict); err != nil {
+		return "", s.Diagnostics, err
+	}
+
+	out, err := s.Render(opts.Format, opts)
+	return out, s.Diagnostics, err
+}
+
+// prepare checks the replay of s in strict mode, then normalizes s and keeps
+// only the schemas matching filter.
+func (s *Schema) prepare(filter []string, rules *Rules, strict bool) error {
+	if failing := s.Diagnostics.Failing(); strict && len(failing) > 0 {
+		return fmt.Errorf("%d statements could not be replayed", failing.statements())
+	}
+	s.Normalize(rules)
+	if len(filter) > 0 {
+		return s.FilterSchemas(filter)
+	}
+	return nil
+}
+
+// MigrationFiles returns the *.up.sql files below dir in the order they are
+// applied: by version prefix, compared as numbers, then by path.
+func MigrationFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), ".up.sql") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortMigrationFiles(files)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.up.sql files found under %s", dir)
+	}
+	return files, nil
+}
+
+// Load replays every migration in dir into a new Schema.
+func Load(dir string) (*Schema, error) {
+	files, err := MigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSchema()
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ApplySQL(f, string(src)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// LoadSource replays a migrations directory, like Load, or a single SQL
+// file such as a pg_dump --schema-only dump into a new Schema.
+func LoadSource(path string) (*Schema, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return Load(path)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSchema()
+	if err := s.ApplySQL(path, string(src)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ApplySQL replays the statements in src against s. name identifies src in
+// errors and diagnostics. Statements that cannot be parsed or replayed are
+// skipped and recorded in s.Diagnostics.
+func (s *Schema) ApplySQL(name, src string) error {
+	// Split into individual statements with pg_query's splitter to be robust;
+	// the scanner still splits files with syntax errors, which are then
+	// reported per statement.
+	stmts, err := pgquery.SplitWithParser(src, true)
+	if err != nil {
+		if stmts, err = pgquery.SplitWithScanner(src, true); err != nil {
+			return fmt.Errorf("failed to split %s: %w", name, err)
+		}
+	}
+	for i, sql := range stmts {
+		s.current = Diagnostic{File: name, Statement: i + 1, Kind: "ParseError", SQL: snippet(sql)}
+		parsedJSON, err := pgquery.ParseToJSON(sql)
+		if err != nil {
+			s.report(LevelError, "failed to parse: %v", err)
+			continue
+		}
+		var pr parseResult
+		if err := json.Unmarshal([]byte(parsedJSON), &pr); err != nil {
+			s.report(LevelError, "failed to read parse tree: %v", err)
+			continue
+		}
+		for _, st := range pr.Stmts {
+			for kind, payload := range st.Stmt {
+				s.current.Kind = kind
+				var err error
+				switch kind {
+				case "CreateStmt":
+					err = applyCreateTable(s, payload)
+				case "AlterTableStmt":
+					err = applyAlterTable(s, payload)
+				case "DropStmt":
+					err = applyDrop(s, payload)
+				case "RenameStmt":
+					err = applyRename(s, payload)
+				case "CommentStmt":
+					err = applyComment(s, payload)
+				case "IndexStmt":
+					err = applyIndexStmt(s, payload)
+				case "CreateEnumStmt":
+					err = applyCreateEnum(s, payload)
+				case "AlterEnumStmt":
+					err = applyAlterEnum(s, payload)
+				case "CreateSeqStmt":
+					err = applyCreateSequence(s, payload)
+				case "AlterSeqStmt":
+					err = applyAlterSequence(s, payload)
+				case "CreateSchemaStmt":
+					err = applyCreateSchema(s, payload)
+				case "CreateExtensionStmt":
+					err = applyCreateExtension(s, payload, sql)
+				case "ViewStmt":
+					err = applyCreateView(s, payload, sql)
+				case "CreateTableAsStmt":
+					var handled bool
+					if handled, err = applyCreateTableAs(s, payload, sql); err == nil && !handled {
+						s.report(LevelUnsupported, "CREATE TABLE AS is not replayed")
+					}
+				case "CreateFunctionStmt":
+					err = applyCreateFunction(s, payload, sql)
+				case "CreateTrigStmt":
+					err = applyCreateTrigger(s, payload, sql)
+				default:
+					if nonSchemaStatements[kind] {
+						s.report(LevelIgnored, "does not change the schema")
+					} else {
+						s.report(LevelUnsupported, "statement is not replayed")
+					}
+				}
+				if err != nil {
+					s.report(LevelError, "failed to replay: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// FilterSchemas drops every schema, table, type, sequence, view, function and
+// trigger whose schema matches none of patterns. Extensions are kept.
+func (s *Schema) FilterSchemas(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid schema filter %q: %w", pattern, err)
+		}
+	}
+	keep := func(schema string) bool {
+		if schema == "" {
+			schema = "public"
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, schema); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for name := range s.Namespaces {
+		if !keep(name) {
+			delete(s.Namespaces, name)
+		}
+	}
+	for key, t := range s.Tables {
+		if !keep(t.Schema) {
+			delete(s.Tables, key)
+		}
+	}
+	for key, e := range s.Enums {
+		if !keep(e.Schema) {
+			delete(s.Enums, key)
+		}
+	}
+	for key, q := range s.Sequences {
+		if !keep(q.Schema) {
+			delete(s.Sequences, key)
+		}
+	}
+	for key, v := range s.Views {
+		if !keep(v.Schema) {
+			delete(s.Views, key)
+		}
+	}
+	for key, f := range s.Functions {
+		if !keep(f.Schema) {
+			delete(s.Functions, key)
+		}
+	}
+	for key, t := range s.Triggers {
+		if !keep(t.Schema) {
+			delete(s.Triggers, key)
+		}
+	}
+	return nil
+}
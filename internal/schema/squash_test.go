@@ -0,0 +1,122 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMigrations writes name -> SQL files into a new temporary directory.
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, sql := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(sql), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSquash(t *testing.T) {
+	t.Parallel()
+
+	dir := writeMigrations(t, map[string]string{
+		"000001_users.up.sql":   "create table users (id integer primary key, name text not null);\n",
+		"000001_users.down.sql": "drop table users;\n",
+		"000002_audit.up.sql": `create table audit.events (id bigint primary key);
+create index users_name on users (name);
+insert into users values (1, 'seed');
+`,
+	})
+
+	tests := []struct {
+		name    string
+		opts    SquashOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "everything",
+			opts: SquashOptions{IncludeIndexes: true},
+			want: []string{"create table users (", "    id integer not null,", "    name text not null,", "    primary key (id)", "create table audit.events (", "create index users_name     on users (name);"},
+		},
+		{
+			name:    "without indexes",
+			opts:    SquashOptions{},
+			want:    []string{"create table users ("},
+			notWant: []string{"create index"},
+		},
+		{
+			name:    "schema filter",
+			opts:    SquashOptions{SchemaFilter: []string{"pub*"}},
+			want:    []string{"create table users ("},
+			notWant: []string{"events"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, _, err := Squash(dir, tc.opts)
+			if err != nil {
+				t.Fatalf("Squash error = %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Fatalf("Squash output missing %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tc.notWant {
+				if strings.Contains(got, unwanted) {
+					t.Fatalf("Squash output contains %q:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSquashErrors(t *testing.T) {
+	t.Parallel()
+
+	if _, _, err := Squash(t.TempDir(), SquashOptions{}); err == nil || !strings.Contains(err.Error(), "no *.up.sql files") {
+		t.Fatalf("Squash(empty dir) error = %v, want no migrations error", err)
+	}
+	if _, _, err := Squash(filepath.Join(t.TempDir(), "missing"), SquashOptions{}); err == nil {
+		t.Fatal("Squash(missing dir) error = nil, want error")
+	}
+
+	dir := writeMigrations(t, map[string]string{"1.up.sql": "create table t (id int);\n"})
+	if _, _, err := Squash(dir, SquashOptions{SchemaFilter: []string{"["}}); err == nil {
+		t.Fatal("Squash(bad filter) error = nil, want error")
+	}
+}
+
+func TestSquashStrict(t *testing.T) {
+	t.Parallel()
+
+	dir := writeMigrations(t, map[string]string{
+		"000001_init.up.sql": "create table t (id int);\ninsert into t values (1);\n",
+	})
+	if _, diags, err := Squash(dir, SquashOptions{Strict: true}); err != nil || len(diags) != 1 {
+		t.Fatalf("Squash(strict, ignored statements) = %v, %v, want one diagnostic and no error", diags, err)
+	}
+
+	dir = writeMigrations(t, map[string]string{
+		"000001_init.up.sql": "create table t (id int);\ngrant select on t to reader;\ncreate domain d as int;\n",
+	})
+	if _, diags, err := Squash(dir, SquashOptions{}); err != nil || len(diags.Failing()) != 2 {
+		t.Fatalf("Squash(unsupported statements) = %v, %v, want two failing diagnostics and no error", diags, err)
+	}
+	if _, _, err := Squash(dir, SquashOptions{Strict: true}); err == nil || !strings.Contains(err.Error(), "2 statements") {
+		t.Fatalf("Squash(strict, unsupported statements) error = %v, want 2 statements error", err)
+	}
+}
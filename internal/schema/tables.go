@@ -0,0 +1,525 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Table features beyond columns and keys: checks, generated and identity
+// columns, partitioning, comments and renames.
+
+// addCheck records a CHECK constraint node.
+func (t *Table) addCheck(cst map[string]any) error {
+	expr, err := deparseAny(cst["raw_expr"])
+	if err != nil {
+		return err
+	}
+	name, _ := cst["conname"].(string)
+	t.Checks = append(t.Checks, CheckConstraint{Name: name, Expr: expr})
+	return nil
+}
+
+// identityFromConstraint reads a CONSTR_IDENTITY constraint node.
+func identityFromConstraint(cst map[string]any) (*Identity, error) {
+	identity := &Identity{}
+	if when, _ := cst["generated_when"].(string); when == "a" {
+		identity.Always = true
+	}
+	if options, ok := cst["options"]; ok {
+		b, err := json.Marshal(options)
+		if err != nil {
+			return nil, err
+		}
+		var elems []defElem
+		if err := json.Unmarshal(b, &elems); err != nil {
+			return nil, err
+		}
+		identity.applyOptions(elems)
+	}
+	return identity, nil
+}
+
+// applyOptions applies ALTER COLUMN ... SET GENERATED/SET options. RESTART
+// only moves the current value, which a fresh schema does not keep.
+func (i *Identity) applyOptions(options []defElem) {
+	var rest []defElem
+	for _, o := range options {
+		switch o.DefElem.Defname {
+		case "generated":
+			// the argument is the attidentity character: 'a' (97) or 'd' (100)
+			i.Always = defElemValue(o.DefElem.Arg) == "97"
+		case "restart":
+		default:
+			rest = append(rest, o)
+		}
+	}
+	i.Options.applyOptions(rest)
+}
+
+func (i *Identity) sql() string {
+	sql := "generated by default as identity"
+	if i.Always {
+		sql = "generated always as identity"
+	}
+	if opts := i.Options.optionsSQL(); opts != "" {
+		sql += " (" + opts + ")"
+	}
+	return sql
+}
+
+// partitionKeySQL renders a PartitionSpec node, e.g. "range (created_at)".
+func partitionKeySQL(raw json.RawMessage) (string, error) {
+	var spec struct {
+		Strategy   string `json:"strategy"`
+		PartParams []struct {
+			PartitionElem struct {
+				Name      string          `json:"name"`
+				Expr      json.RawMessage `json:"expr"`
+				Collation []nameNode      `json:"collation"`
+				Opclass   []nameNode      `json:"opclass"`
+			} `json:"PartitionElem"`
+		} `json:"partParams"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return "", err
+	}
+	var params []string
+	for _, p := range spec.PartParams {
+		elem := p.PartitionElem
+		param := pqQuoteIdent(elem.Name)
+		if elem.Name == "" {
+			expr, err := deparseExpr(elem.Expr)
+			if err != nil {
+				return "", err
+			}
+			param = "(" + expr + ")"
+		}
+		if len(elem.Collation) > 0 {
+			param += " collate " + joinQuotedName(nodeNames(elem.Collation))
+		}
+		if len(elem.Opclass) > 0 {
+			param += " " + joinQuotedName(nodeNames(elem.Opclass))
+		}
+		params = append(params, param)
+	}
+	strategy := strings.ToLower(strings.TrimPrefix(spec.Strategy, "PARTITION_STRATEGY_"))
+	return fmt.Sprintf("%s (%s)", strategy, strings.Join(params, ", ")), nil
+}
+
+// partitionBoundSQL renders a PartitionBoundSpec node, e.g. "for values in (1, 2)".
+func partitionBoundSQL(raw json.RawMessage) (string, error) {
+	var bound struct {
+		Strategy    string            `json:"strategy"`
+		IsDefault   bool              `json:"is_default"`
+		Modulus     int               `json:"modulus"`
+		Remainder   int               `json:"remainder"`
+		Listdatums  []json.RawMessage `json:"listdatums"`
+		Lowerdatums []json.RawMessage `json:"lowerdatums"`
+		Upperdatums []json.RawMessage `json:"upperdatums"`
+	}
+	if err := json.Unmarshal(raw, &bound); err != nil {
+		return "", err
+	}
+	datums := func(nodes []json.RawMessage) (string, error) {
+		var values []string
+		for _, n := range nodes {
+			v, err := deparseExpr(n)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, v)
+		}
+		return strings.Join(values, ", "), nil
+	}
+
+	switch {
+	case bound.IsDefault:
+		return "default", nil
+	case bound.Strategy == "h":
+		return fmt.Sprintf("for values with (modulus %d, remainder %d)", bound.Modulus, bound.Remainder), nil
+	case bound.Strategy == "l":
+		values, err := datums(bound.Listdatums)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("for values in (%s)", values), nil
+	case bound.Strategy == "r":
+		lower, err := datums(bound.Lowerdatums)
+		if err != nil {
+			return "", err
+		}
+		upper, err := datums(bound.Upperdatums)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("for values from (%s) to (%s)", lower, upper), nil
+	}
+	return "", fmt.Errorf("unknown partition strategy %q", bound.Strategy)
+}
+
+// applyPartitionCmd replays ALTER TABLE parent ATTACH/DETACH PARTITION.
+func (s *Schema) applyPartitionCmd(parent *Table, attach bool, def json.RawMessage) error {
+	var cmd struct {
+		PartitionCmd struct {
+			Name  json.RawMessage `json:"name"`
+			Bound json.RawMessage `json:"bound"`
+		} `json:"PartitionCmd"`
+	}
+	if err := json.Unmarshal(def, &cmd); err != nil {
+		return err
+	}
+	schema, name := parseRangeVar(cmd.PartitionCmd.Name)
+	child, ok := s.Tables[qualifiedKey(schema, name)]
+	if !ok {
+		return nil
+	}
+	if !attach {
+		// a partition created with PARTITION OF has the parent's columns
+		if child.PartitionOf != nil && len(child.Columns) == 0 {
+			for _, c := range parent.Columns {
+				c.Identity = nil
+				child.addColumn(c)
+			}
+		}
+		child.PartitionOf = nil
+		return nil
+	}
+	bound, err := partitionBoundSQL(cmd.PartitionCmd.Bound)
+	if err != nil {
+		return err
+	}
+	child.PartitionOf = &Partition{ParentSchema: parent.Schema, Parent: parent.Name, Bound: bound}
+	return nil
+}
+
+// partitionDepth is 0 for regular tables and one more than the parent's for partitions.
+func (s *Schema) partitionDepth(t *Table) int {
+	depth := 0
+	for p := t.PartitionOf; p != nil && depth <= len(s.Tables); depth++ {
+		parent, ok := s.Tables[qualifiedKey(p.ParentSchema, p.Parent)]
+		if !ok {
+			return depth + 1
+		}
+		p = parent.PartitionOf
+	}
+	return depth
+}
+
+// applyComment replays COMMENT ON TABLE and COMMENT ON COLUMN.
+func applyComment(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		Objtype string     `json:"objtype"`
+		Object  dropObject `json:"object"`
+		Comment string     `json:"comment"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	names := node.Object.names()
+	switch node.Objtype {
+	case "OBJECT_TABLE":
+		schema, name := splitQualified(names)
+		if t, ok := s.Tables[qualifiedKey(schema, name)]; ok {
+			t.Comment = node.Comment
+		}
+	case "OBJECT_COLUMN":
+		if len(names) < 2 {
+			return nil
+		}
+		schema, name := splitQualified(names[:len(names)-1])
+		if t, ok := s.Tables[qualifiedKey(schema, name)]; ok {
+			if i, ok := t.colIndex(names[len(names)-1]); ok {
+				t.Columns[i].Comment = node.Comment
+			}
+		}
+	default:
+		s.report(LevelUnsupported, "COMMENT ON %s is not replayed", node.Objtype)
+	}
+	return nil
+}
+
+func writeComments(b *strings.Builder, t *Table) {
+	table := pqQuoteQualified(t.Schema, t.Name)
+	if t.Comment != "" {
+		fmt.Fprintf(b, "comment on table %s is %s;\n", table, quoteLiteral(t.Comment))
+	}
+	for _, c := range t.Columns {
+		if c.Comment != "" {
+			fmt.Fprintf(b, "comment on column %s.%s is %s;\n", table, pqQuoteIdent(c.Name), quoteLiteral(c.Comment))
+		}
+	}
+}
+
+// applyRename replays ALTER TABLE ... RENAME TO, RENAME COLUMN and RENAME
+// CONSTRAINT, and ALTER INDEX ... RENAME TO.
+func applyRename(s *Schema, raw json.RawMessage) error {
+	var node struct {
+		RenameType string          `json:"renameType"`
+		Relation   json.RawMessage `json:"relation"`
+		Subname    string          `json:"subname"`
+		Newname    string          `json:"newname"`
+	}
+	if err := json.Unmarshal(raw, &node); err != nil {
+		return err
+	}
+	schema, name := parseRangeVar(node.Relation)
+	switch node.RenameType {
+	case "OBJECT_INDEX":
+		s.renameIndex(schema, name, node.Newname)
+		return nil
+	case "OBJECT_TABLE", "OBJECT_COLUMN", "OBJECT_TABCONSTRAINT":
+	default:
+		s.report(LevelUnsupported, "RENAME of %s is not replayed", node.RenameType)
+		return nil
+	}
+	t, ok := s.Tables[qualifiedKey(schema, name)]
+	if !ok {
+		s.report(LevelIgnored, "table %s is not created by these migrations", qualifiedKey(schema, name))
+		return nil
+	}
+	switch node.RenameType {
+	case "OBJECT_TABCONSTRAINT":
+		t.renameConstraint(node.Subname, node.Newname)
+	case "OBJECT_TABLE":
+		t.nameConstraints()
+		return s.renameTable(t, node.Newname)
+	case "OBJECT_COLUMN":
+		t.nameConstraints()
+		t.renameColumn(node.Subname, node.Newname)
+		for _, other := range s.Tables {
+			for i := range other.FKs {
+				fk := &other.FKs[i]
+				if fk.RefSchema == t.Schema && fk.RefTable == t.Name {
+					for j := range fk.RefColumns {
+						if fk.RefColumns[j] == node.Subname {
+							fk.RefColumns[j] = node.Newname
+						}
+					}
+				}
+			}
+		}
+		s.renameColumnInViews(t, node.Subname, node.Newname)
+	}
+	return nil
+}
+
+// renameColumnInViews rewrites the views' references to a renamed column of
+// t. Like in Postgres, the views' columns keep their names, so "select b"
+// becomes "select bee AS b". Views that cannot be rewritten are reported.
+func (s *Schema) renameColumnInViews(t *Table, oldName, newName string) {
+	for key, v := range s.Views {
+		doc, err := parseStmtTree(v.SQL)
+		if err != nil {
+			s.report(LevelUnsupported, "view %s is not rewritten for the renamed column %s.%s: %v", key, qualifiedKey(t.Schema, t.Name), oldName, err)
+			continue
+		}
+		u := s.newColumnUse(doc, t, oldName)
+		changed, undecided := false, false
+		walkNodes(doc, func(kind string, node map[string]any) {
+			switch kind {
+			case "ResTarget":
+				val, _ := node["val"].(map[string]any)
+				ref, ok := val["ColumnRef"].(map[string]any)
+				if _, named := node["name"]; ok && !named && columnRefName(ref) != "" && u.match(ref) == useYes {
+					node["name"] = oldName
+				}
+			case "ColumnRef":
+				switch u.match(node) {
+				case useYes:
+					if columnRefName(node) == "" {
+						// a * the view expanded when it was created
+						undecided = true
+						return
+					}
+					fields := node["fields"].([]any)
+					fields[len(fields)-1] = map[string]any{"String": map[string]any{"sval": newName}}
+					changed = true
+				case useMaybe:
+					undecided = true
+				}
+			}
+		})
+		if undecided {
+			s.report(LevelUnsupported, "view %s is not rewritten for the renamed column %s.%s", key, qualifiedKey(t.Schema, t.Name), oldName)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		sql, err := deparseStmtTree(doc)
+		if err != nil {
+			s.report(LevelUnsupported, "view %s is not rewritten for the renamed column %s.%s: %v", key, qualifiedKey(t.Schema, t.Name), oldName, err)
+			continue
+		}
+		v.SQL = sql
+	}
+}
+
+// renameTable renames t and everything that refers to it: foreign keys,
+// partitions, sequence ownership and the relations triggers and views name.
+func (s *Schema) renameTable(t *Table, newName string) error {
+	oldName := t.Name
+	delete(s.Tables, qualifiedKey(t.Schema, oldName))
+	t.Name = newName
+	s.Tables[qualifiedKey(t.Schema, newName)] = t
+
+	for _, other := range s.Tables {
+		for i := range other.FKs {
+			if fk := &other.FKs[i]; fk.RefSchema == t.Schema && fk.RefTable == oldName {
+				fk.RefTable = newName
+			}
+		}
+		if p := other.PartitionOf; p != nil && p.ParentSchema == t.Schema && p.Parent == oldName {
+			p.Parent = newName
+		}
+	}
+	for _, q := range s.Sequences {
+		if schema, table, column, ok := q.ownedByTable(); ok && schema == t.Schema && table == oldName {
+			q.OwnedBy = strings.Join([]string{qualifiedKey(schema, newName), column}, ".")
+		}
+	}
+
+	var renamed []*Trigger
+	for key, tr := range s.Triggers {
+		if tr.Schema == t.Schema && tr.Table == oldName {
+			sql, err := renameRelationInSQL(tr.SQL, t.Schema, oldName, newName)
+			if err != nil {
+				return err
+			}
+			delete(s.Triggers, key)
+			tr.Table, tr.SQL = newName, sql
+			renamed = append(renamed, tr)
+		}
+	}
+	for _, tr := range renamed {
+		s.Triggers[qualifiedKey(qualifiedKey(tr.Schema, tr.Table), tr.Name)] = tr
+	}
+	for _, v := range s.Views {
+		sql, err := renameRelationInSQL(v.SQL, t.Schema, oldName, newName)
+		if err != nil {
+			return err
+		}
+		v.SQL = sql
+	}
+	return nil
+}
+
+// renameRelationInSQL rewrites the references to schema.oldName in the
+// statement sql. Renamed tables in FROM clauses keep the old name as their
+// alias, so qualified column references still resolve. sql is returned
+// unchanged when it does not mention the table.
+func renameRelationInSQL(sql, schema, oldName, newName string) (string, error) {
+	doc, err := parseStmtTree(sql)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+	rename := func(rv map[string]any, alias bool) {
+		relSchema, _ := rv["schemaname"].(string)
+		if rv["relname"] != oldName || localSchema(relSchema) != schema {
+			return
+		}
+		rv["relname"] = newName
+		if _, ok := rv["alias"]; alias && !ok {
+			rv["alias"] = map[string]any{"aliasname": oldName}
+		}
+		changed = true
+	}
+	walkNodes(doc, func(key string, rv map[string]any) {
+		switch key {
+		case "relation":
+			rename(rv, false)
+		case "RangeVar":
+			rename(rv, true)
+		}
+	})
+	if !changed {
+		return sql, nil
+	}
+	return deparseStmtTree(doc)
+}
+
+// parseStmtTree parses the statements in sql into a generic tree.
+func parseStmtTree(sql string) (any, error) {
+	tree, err := pgquery.ParseToJSON(sql)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(tree), &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// deparseStmtTree turns a tree from parseStmtTree back into SQL.
+func deparseStmtTree(doc any) (string, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	var result pgquery.ParseResult
+	if err := protojson.Unmarshal(b, &result); err != nil {
+		return "", err
+	}
+	out, err := pgquery.Deparse(&result)
+	if err != nil {
+		return "", err
+	}
+	return statementSQL(out), nil
+}
+
+// renameColumnInExpr rewrites the column references to oldName in the
+// expression expr. expr is returned unchanged when it cannot be parsed.
+func renameColumnInExpr(expr, oldName, newName string) string {
+	doc, ok := parseExprTree(expr)
+	if !ok {
+		return expr
+	}
+	changed := false
+	walkColumnRefs(doc, func(field map[string]any) {
+		if field["sval"] == oldName {
+			field["sval"] = newName
+			changed = true
+		}
+	})
+	if !changed {
+		return expr
+	}
+
+	var stmts struct {
+		Stmts []struct {
+			Stmt struct {
+				SelectStmt struct {
+					TargetList []struct {
+						ResTarget struct {
+							Val json.RawMessage `json:"val"`
+						} `json:"ResTarget"`
+					} `json:"targetList"`
+				} `json:"SelectStmt"`
+			} `json:"stmt"`
+		} `json:"stmts"`
+	}
+	b, err := json.Marshal(doc)
+	if err != nil || json.Unmarshal(b, &stmts) != nil || len(stmts.Stmts) != 1 || len(stmts.Stmts[0].Stmt.SelectStmt.TargetList) != 1 {
+		return expr
+	}
+	renamed, err := deparseExpr(stmts.Stmts[0].Stmt.SelectStmt.TargetList[0].ResTarget.Val)
+	if err != nil {
+		return expr
+	}
+	return renamed
+}
+
+func joinQuotedName(parts []string) string {
+	var qs []string
+	for _, p := range parts {
+		qs = append(qs, pqQuoteIdent(p))
+	}
+	return strings.Join(qs, ".")
+}
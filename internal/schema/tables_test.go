@@ -0,0 +1,237 @@
+package schema
+
+import "testing"
+
+func TestTables(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sql     string
+		want    []string // in this order
+		notWant []string
+	}{
+		{
+			name: "check constraints",
+			sql: `create table t (qty int check (qty > 0), price numeric, constraint price_positive check (price >= 0));
+alter table t add constraint qty_small check (qty < 100);`,
+			want: []string{
+				"    check (qty > 0),\n",
+				"    constraint price_positive check (price >= 0),\n",
+				"    constraint qty_small check (qty < 100)\n);",
+			},
+		},
+		{
+			name: "generated column",
+			sql: `create table t (a int, b int generated always as (a * 2) stored);
+alter table t add column c text generated always as (upper(a::text)) stored;`,
+			want: []string{
+				"b integer generated always as (a * 2) stored,",
+				"c text generated always as (upper(a::text)) stored\n",
+			},
+		},
+		{
+			name: "dropped generation expression",
+			sql:  "create table t (a int, b int generated always as (a * 2) stored);\nalter table t alter column b drop expression;",
+			want: []string{"    b integer\n"},
+		},
+		{
+			name: "identity columns",
+			sql: `create table t (id bigint generated by default as identity (start with 10 increment by 2), n int not null, m int not null);
+alter table t alter column id set generated always;
+alter table t alter column n add generated by default as identity;
+alter table t alter column m add generated always as identity;
+alter table t alter column m drop identity;`,
+			want: []string{
+				"id bigint generated always as identity (increment by 2 start with 10) not null,",
+				"n integer generated by default as identity not null,",
+				"m integer not null\n",
+			},
+		},
+		{
+			name: "comments",
+			sql: `create table t (a int, b int);
+comment on table t is 'Holds things';
+comment on column t.a is 'It''s a';
+comment on column t.b is 'b';
+comment on column t.b is null;`,
+			want: []string{
+				");\ncomment on table t is 'Holds things';\n",
+				"comment on column t.a is 'It''s a';\n",
+			},
+			notWant: []string{"t.b is"},
+		},
+		{
+			name: "partitions follow their parent",
+			sql: `create table a_2024 partition of measurements for values from ('2024-01-01') to ('2025-01-01');
+create table measurements (id int, at date not null, region text) partition by range (at);
+create table a_2024 partition of measurements for values from ('2024-01-01') to ('2025-01-01') partition by list (region);
+create table a_2024_eu partition of a_2024 for values in ('eu', 'uk');
+create table a_default partition of measurements default;
+create table h (id int) partition by hash (id);
+create table h0 partition of h for values with (modulus 2, remainder 0);`,
+			want: []string{
+				"create table h (\n    id integer\n) partition by hash (id);",
+				") partition by range (at);",
+				"create table a_2024 partition of measurements for values from ('2024-01-01') to ('2025-01-01') partition by list (region);",
+				"create table a_default partition of measurements default;",
+				"create table h0 partition of h for values with (modulus 2, remainder 0);",
+				"create table a_2024_eu partition of a_2024 for values in ('eu', 'uk');",
+			},
+		},
+		{
+			name: "attached and detached partitions",
+			sql: `create table m (id int, region text) partition by list (region);
+create table m_eu (id int, region text);
+alter table m attach partition m_eu for values in ('eu');
+create table m_us partition of m for values in ('us');
+alter table m detach partition m_us;`,
+			want: []string{
+				"create table m_us (\n    id integer,\n    region text\n);",
+				"create table m_eu partition of m for values in ('eu');",
+			},
+		},
+		{
+			name: "renamed table",
+			sql: `create table items (id int primary key, sku text);
+create table orders (id int, item_id int references items (id));
+comment on table items is 'Items';
+create function touch() returns trigger language plpgsql as $$ begin return new; end $$;
+create trigger items_touch before update on items for each row execute function touch();
+create view skus as select items.sku from items;
+create sequence items_seq owned by items.id;
+alter table items rename to products;`,
+			want: []string{
+				"create table products (",
+				"comment on table products is 'Items';",
+				"foreign key (item_id) references products (id)",
+				"alter sequence items_seq owned by products.id;",
+				"FROM products items;",
+				"ON products FOR EACH ROW",
+			},
+			notWant: []string{"create table items", " on items "},
+		},
+		{
+			name: "renamed column",
+			sql: `create table items (id int primary key, sku text check (sku <> ''), code text generated always as (lower(sku)) stored);
+create table orders (item_id int references items (id));
+create index items_sku on items (sku);
+create view skus as select id, sku, i.sku as code from items i where sku <> '' order by i.sku;
+create view counts as select count(*) from items group by sku;
+alter table items rename column id to item_id;
+alter table items rename column sku to name;`,
+			want: []string{
+				"    name text,\n",
+				"code text generated always as (lower(name)) stored,",
+				"primary key (item_id),",
+				"check (name <> '')",
+				"references items (item_id)",
+				"create index items_sku     on items (name);",
+				"CREATE VIEW skus AS SELECT item_id AS id, name AS sku, i.name AS code FROM items i WHERE name <> '' ORDER BY i.name;",
+				"CREATE VIEW counts AS SELECT count(*) FROM items GROUP BY name;",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("test.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			checkRendered(t, s.RenderDDL(true, false), tc.want, tc.notWant)
+		})
+	}
+}
+
+func TestTableOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		sql         string
+		separateFKs bool
+		want        []string // in this order
+		notWant     []string
+	}{
+		{
+			name: "referenced table sorts later",
+			sql: `create table accounts (id int primary key, owner_id int references users (id));
+create table users (id int primary key, manager_id int references users (id));
+create table zones (id int primary key);`,
+			want: []string{
+				"create table users (",
+				"    foreign key (manager_id) references users (id)",
+				"create table accounts (",
+				"    foreign key (owner_id) references users (id)",
+				"create table zones (",
+			},
+			notWant: []string{"alter table"},
+		},
+		{
+			name: "public and unqualified references",
+			sql: `create table a (id int primary key, z_id int references public.z (id));
+create table b (id int primary key, y_id int references y (id));
+create table public.y (id int primary key);
+create table z (id int primary key);`,
+			want: []string{
+				"create table y (",
+				"create table b (",
+				"create table z (",
+				"create table a (",
+			},
+			notWant: []string{"alter table", "public."},
+		},
+		{
+			name: "cycle",
+			sql: `create table a (id int primary key, b_id int);
+create table b (id int primary key, a_id int references a (id));
+alter table a add foreign key (b_id) references b (id);`,
+			want: []string{
+				"create table a (\n    id integer,\n    b_id integer,\n    primary key (id)\n);\n",
+				"create table b (",
+				"    foreign key (a_id) references a (id)",
+				"\nalter table a add constraint a_b_id_fkey foreign key (b_id) references b (id) on delete no action on update no action;\n",
+			},
+		},
+		{
+			name: "partitions follow their parent",
+			sql: `create table events (id int, user_id int references users (id), at date) partition by range (at);
+create table events_2024 partition of events for values from ('2024-01-01') to ('2025-01-01');
+create table users (id int primary key);`,
+			want: []string{
+				"create table users (",
+				"create table events (",
+				"create table events_2024 partition of events",
+			},
+		},
+		{
+			name: "separate foreign keys",
+			sql: `create table orders (id int primary key, user_id int references users (id) on delete cascade);
+create table users (id int primary key, parent_id int references users (id));`,
+			separateFKs: true,
+			want: []string{
+				"create table users (\n    id integer,\n    parent_id integer,\n    primary key (id)\n);\n",
+				"create table orders (\n    id integer,\n    user_id integer,\n    primary key (id)\n);\n",
+				"alter table users add constraint users_parent_id_fkey foreign key (parent_id) references users (id)",
+				"alter table orders add constraint orders_user_id_fkey foreign key (user_id) references users (id) on delete cascade",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewSchema()
+			if err := s.ApplySQL("test.up.sql", tc.sql); err != nil {
+				t.Fatalf("ApplySQL error = %v", err)
+			}
+			checkRendered(t, s.RenderTablesDDL(tc.separateFKs), tc.want, tc.notWant)
+		})
+	}
+}
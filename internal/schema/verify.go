@@ -0,0 +1,270 @@
+package schema
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Verifying a squash: the squashed DDL and the full migration chain are
+// applied to two scratch databases and their catalogs compared.
+
+// VerifyOptions controls Verify.
+type VerifyOptions struct {
+	// SquashOptions builds the squashed DDL; Format is ignored.
+	SquashOptions
+	// DSN connects to a database from which the scratch databases are
+	// created, so its role needs CREATEDB.
+	DSN string
+}
+
+// Difference is a catalog object that differs between the database built
+// by the migrations and the one built by the squashed DDL. An empty side
+// means the object is missing there.
+type Difference struct {
+	Object string // e.g. "column public.users.email"
+	Chain  string
+	Squash string
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Squash == "" && d.Chain != "":
+		return fmt.Sprintf("%s: missing from the squash (migrations: %s)", d.Object, d.Chain)
+	case d.Chain == "" && d.Squash != "":
+		return fmt.Sprintf("%s: only in the squash (%s)", d.Object, d.Squash)
+	}
+	return fmt.Sprintf("%s: migrations have %s, the squash has %s", d.Object, d.Chain, d.Squash)
+}
+
+// WriteDifferences writes one line per difference.
+func WriteDifferences(w io.Writer, diffs []Difference) error {
+	var b strings.Builder
+	for _, d := range diffs {
+		b.WriteString(d.String() + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Verify squashes the migrations in dir, applies the result and the
+// migrations themselves to scratch databases on the server at opts.DSN and
+// returns where their catalogs differ. The scratch databases are dropped
+// afterwards.
+func Verify(ctx context.Context, dir string, opts VerifyOptions) ([]Difference, Diagnostics, error) {
+	squashOpts := opts.SquashOptions
+	squashOpts.Format = FormatDDL
+	ddl, diags, err := Squash(dir, squashOpts)
+	if err != nil {
+		return nil, diags, err
+	}
+	files, err := MigrationFiles(dir)
+	if err != nil {
+		return nil, diags, err
+	}
+
+	cfg, err := pgx.ParseConfig(opts.DSN)
+	if err != nil {
+		return nil, diags, fmt.Errorf("invalid DSN: %w", err)
+	}
+	admin, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, diags, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer admin.Close(context.Background())
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, diags, err
+	}
+	prefix := "gallium_verify_" + hex.EncodeToString(suffix)
+
+	chain, err := scratchCatalog(ctx, admin, cfg, prefix+"_chain", func(conn *pgx.Conn) error {
+		for _, f := range files {
+			src, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if _, err := conn.Exec(ctx, string(src)); err != nil {
+				return fmt.Errorf("failed to apply %s: %w", f, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, diags, err
+	}
+	squashed, err := scratchCatalog(ctx, admin, cfg, prefix+"_squash", func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, ddl); err != nil {
+			return fmt.Errorf("failed to apply the squashed DDL: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, diags, err
+	}
+	return compareCatalogs(chain, squashed), diags, nil
+}
+
+// scratchCatalog creates the database name, runs apply in it, reads its
+// catalog and drops it again.
+func scratchCatalog(ctx context.Context, admin *pgx.Conn, cfg *pgx.ConnConfig, name string, apply func(*pgx.Conn) error) (map[string]string, error) {
+	ident := pgx.Identifier{name}.Sanitize()
+	if _, err := admin.Exec(ctx, "create database "+ident); err != nil {
+		return nil, fmt.Errorf("failed to create scratch database %s: %w", name, err)
+	}
+	defer admin.Exec(context.Background(), "drop database if exists "+ident+" with (force)")
+
+	dbCfg := cfg.Copy()
+	dbCfg.Database = name
+	conn, err := pgx.ConnectConfig(ctx, dbCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to scratch database %s: %w", name, err)
+	}
+	defer conn.Close(context.Background())
+
+	if err := apply(conn); err != nil {
+		return nil, err
+	}
+	return readCatalog(ctx, conn)
+}
+
+// userNamespace limits a catalog query on the namespace n to user schemas.
+const userNamespace = `n.nspname not in ('pg_catalog', 'information_schema') and n.nspname not like 'pg\_toast%' and n.nspname not like 'pg\_temp%'`
+
+// notExtensionMember leaves out the objects an extension created; %s is the
+// object's oid column.
+const notExtensionMember = `not exists (select 1 from pg_depend dep where dep.objid = %s and dep.deptype = 'e')`
+
+// catalogQueries each return object names and descriptions; objects with
+// the same name are compared by their descriptions.
+var catalogQueries = []string{
+	// tables, views and their partitioning
+	`select format('%s %I.%I', case c.relkind when 'r' then 'table' when 'p' then 'table' when 'v' then 'view' when 'm' then 'materialized view' else 'relation' end, n.nspname, c.relname),
+		concat_ws(' ', case c.relkind when 'p' then 'partition by ' || pg_get_partkeydef(c.oid) end,
+			case when c.relispartition then 'partition ' || pg_get_expr(c.relpartbound, c.oid) end,
+			case when c.relkind in ('v', 'm') then pg_get_viewdef(c.oid, true) end)
+	from pg_class c join pg_namespace n on n.oid = c.relnamespace
+	where c.relkind in ('r', 'p', 'v', 'm', 'f') and ` + userNamespace + ` and ` + fmt.Sprintf(notExtensionMember, "c.oid"),
+	// columns, with their position among the remaining columns
+	`select format('column %I.%I.%I', n.nspname, c.relname, a.attname),
+		concat_ws(' ', '#' || row_number() over (partition by c.oid order by a.attnum), format_type(a.atttypid, a.atttypmod),
+			case when a.attnotnull then 'not null' end,
+			case when a.attgenerated = 's' then 'generated always as ' || pg_get_expr(d.adbin, d.adrelid)
+				when d.adbin is not null then 'default ' || pg_get_expr(d.adbin, d.adrelid) end,
+			case a.attidentity when 'a' then 'generated always as identity' when 'd' then 'generated by default as identity' end,
+			case when a.attcollation <> t.typcollation then 'collate ' || co.collname end)
+	from pg_attribute a
+	join pg_class c on c.oid = a.attrelid
+	join pg_namespace n on n.oid = c.relnamespace
+	join pg_type t on t.oid = a.atttypid
+	left join pg_attrdef d on d.adrelid = a.attrelid and d.adnum = a.attnum
+	left join pg_collation co on co.oid = a.attcollation
+	where a.attnum > 0 and not a.attisdropped and c.relkind in ('r', 'p', 'v', 'm', 'f') and ` + userNamespace + ` and ` + fmt.Sprintf(notExtensionMember, "c.oid"),
+	// constraints other than not-null ones, which the columns cover
+	`select format('constraint %I.%I.%I', n.nspname, c.relname, con.conname), pg_get_constraintdef(con.oid)
+	from pg_constraint con
+	join pg_class c on c.oid = con.conrelid
+	join pg_namespace n on n.oid = c.relnamespace
+	where con.contype in ('p', 'u', 'f', 'c', 'x') and ` + userNamespace,
+	`select format('index %I.%I', n.nspname, ic.relname), pg_get_indexdef(i.indexrelid)
+	from pg_index i
+	join pg_class ic on ic.oid = i.indexrelid
+	join pg_namespace n on n.oid = ic.relnamespace
+	where ` + userNamespace + ` and ` + fmt.Sprintf(notExtensionMember, "i.indrelid"),
+	`select format('sequence %I.%I', s.schemaname, s.sequencename),
+		format('as %s increment by %s minvalue %s maxvalue %s start with %s cache %s%s', s.data_type, s.increment_by, s.min_value, s.max_value, s.start_value, s.cache_size, case when s.cycle then ' cycle' else '' end)
+	from pg_sequences s join pg_namespace n on n.nspname = s.schemaname
+	where ` + userNamespace,
+	`select format('type %I.%I', n.nspname, t.typname), 'enum (' || string_agg(quote_literal(e.enumlabel), ', ' order by e.enumsortorder) || ')'
+	from pg_type t
+	join pg_namespace n on n.oid = t.typnamespace
+	join pg_enum e on e.enumtypid = t.oid
+	where ` + userNamespace + `
+	group by n.nspname, t.typname`,
+	`select format('function %I.%I(%s)', n.nspname, p.proname, pg_get_function_identity_arguments(p.oid)), pg_get_functiondef(p.oid)
+	from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+	where p.prokind in ('f', 'p') and ` + userNamespace + ` and ` + fmt.Sprintf(notExtensionMember, "p.oid"),
+	`select format('trigger %I.%I.%I', n.nspname, c.relname, tg.tgname), pg_get_triggerdef(tg.oid)
+	from pg_trigger tg
+	join pg_class c on c.oid = tg.tgrelid
+	join pg_namespace n on n.oid = c.relnamespace
+	where not tg.tgisinternal and ` + userNamespace,
+	`select format('schema %I', n.nspname), '' from pg_namespace n where n.nspname <> 'public' and ` + userNamespace,
+	`select format('extension %I', extname), '' from pg_extension where extname <> 'plpgsql'`,
+	`select format('comment on %I.%I', n.nspname, c.relname), d.description
+	from pg_description d
+	join pg_class c on c.oid = d.objoid and d.classoid = 'pg_class'::regclass and d.objsubid = 0
+	join pg_namespace n on n.oid = c.relnamespace
+	where ` + userNamespace,
+	`select format('comment on %I.%I.%I', n.nspname, c.relname, a.attname), d.description
+	from pg_description d
+	join pg_class c on c.oid = d.objoid and d.classoid = 'pg_class'::regclass
+	join pg_attribute a on a.attrelid = c.oid and a.attnum = d.objsubid
+	join pg_namespace n on n.oid = c.relnamespace
+	where d.objsubid > 0 and ` + userNamespace,
+}
+
+// readCatalog describes the user objects of the database conn is connected to.
+func readCatalog(ctx context.Context, conn *pgx.Conn) (map[string]string, error) {
+	catalog := map[string]string{}
+	for _, q := range catalogQueries {
+		rows, err := conn.Query(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the catalog: %w", err)
+		}
+		for rows.Next() {
+			var object string
+			var desc *string
+			if err := rows.Scan(&object, &desc); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			catalog[object] = ""
+			if desc != nil {
+				catalog[object] = strings.TrimSpace(*desc)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read the catalog: %w", err)
+		}
+	}
+	return catalog, nil
+}
+
+// compareCatalogs returns the objects that are missing from either catalog
+// or described differently, in order.
+func compareCatalogs(chain, squash map[string]string) []Difference {
+	objects := map[string]bool{}
+	for o := range chain {
+		objects[o] = true
+	}
+	for o := range squash {
+		objects[o] = true
+	}
+	var diffs []Difference
+	for _, o := range sortedKeys(objects) {
+		c, inChain := chain[o]
+		s, inSquash := squash[o]
+		if inChain && inSquash && c == s {
+			continue
+		}
+		d := Difference{Object: o, Chain: c, Squash: s}
+		// an object without a description is still present
+		if inChain && c == "" {
+			d.Chain = "present"
+		}
+		if inSquash && s == "" {
+			d.Squash = "present"
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
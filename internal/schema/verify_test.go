@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestCompareCatalogs(t *testing.T) {
+	t.Parallel()
+
+	chain := map[string]string{
+		"table public.t":      "",
+		"column public.t.id":  "#1 integer not null",
+		"column public.t.old": "#2 text",
+		"index public.t_a":    "CREATE INDEX t_a ON public.t USING btree (id)",
+	}
+	squash := map[string]string{
+		"table public.t":     "",
+		"column public.t.id": "#1 bigint not null",
+		"index public.t_a":   "CREATE INDEX t_a ON public.t USING btree (id)",
+		"view public.v":      "SELECT 1",
+	}
+	got := compareCatalogs(chain, squash)
+	want := []Difference{
+		{Object: "column public.t.id", Chain: "#1 integer not null", Squash: "#1 bigint not null"},
+		{Object: "column public.t.old", Chain: "#2 text"},
+		{Object: "view public.v", Squash: "SELECT 1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("compareCatalogs = %+v, want %+v", got, want)
+	}
+
+	var b strings.Builder
+	if err := WriteDifferences(&b, got); err != nil {
+		t.Fatal(err)
+	}
+	checkRendered(t, b.String(), []string{
+		"column public.t.id: migrations have #1 integer not null, the squash has #1 bigint not null\n",
+		"column public.t.old: missing from the squash (migrations: #2 text)\n",
+		"view public.v: only in the squash (SELECT 1)\n",
+	}, nil)
+}
+
+// testPostgresDSN returns the DSN of a Postgres server for the tests in
+// GALLIUM_TEST_POSTGRES_DSN, and skips the test when there is none.
+func testPostgresDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("GALLIUM_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("GALLIUM_TEST_POSTGRES_DSN is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Skipf("Postgres is not available: %v", err)
+	}
+	conn.Close(ctx)
+	return dsn
+}
+
+func TestVerify(t *testing.T) {
+	dsn := testPostgresDSN(t)
+
+	tests := []struct {
+		name       string
+		migrations map[string]string
+		want       []string // objects that differ
+	}{
+		{
+			name: "lossless",
+			migrations: map[string]string{
+				"000001_init.up.sql": `create type mood as enum ('ok');
+create table users (id bigint generated always as identity primary key, email text not null, mood mood default 'ok');
+create table posts (id serial primary key, user_id bigint references users (id) on delete cascade, body text);
+create index posts_user on posts (user_id);`,
+				"000002_changes.up.sql": `alter table users add column name varchar(100);
+alter table users add constraint users_email_key unique (email);
+alter table posts rename column body to content;
+alter table posts add check (length(content) > 0);
+comment on table users is 'People';
+create view recent as select id, content from posts;`,
+			},
+		},
+		{
+			name: "schema outside public",
+			migrations: map[string]string{
+				"000001_init.up.sql": `create schema app;
+create type app.status as enum ('on', 'off');
+create table app.users (id int primary key, status app.status default 'on');
+create table app.posts (id int primary key, user_id int references app.users (id));
+create function app.post_count() returns bigint language sql as $$ select count(*) from app.posts $$;
+create view app.recent as select id from app.posts;`,
+				"000002_rename.up.sql": "alter table app.users rename to members;\n",
+			},
+		},
+		{
+			name: "lossy",
+			migrations: map[string]string{
+				"000001_init.up.sql": "create table t (id int primary key);\ncomment on index t_pkey is 'the key';\n",
+			},
+			want: []string{"comment on public.t_pkey"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeMigrations(t, tc.migrations)
+			diffs, _, err := Verify(context.Background(), dir, VerifyOptions{SquashOptions: SquashOptions{IncludeIndexes: true}, DSN: dsn})
+			if err != nil {
+				t.Fatalf("Verify error = %v", err)
+			}
+			var got []string
+			for _, d := range diffs {
+				got = append(got, d.Object)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				var b strings.Builder
+				_ = WriteDifferences(&b, diffs)
+				t.Fatalf("Verify differences:\n%swant differences in %v", b.String(), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"shireesh.com/gallium/internal/generator"
+)
+
+// TestEmbeddedTemplates runs every .template/tests case of the templates shipped in the binary
+// against the golden directories in testdata/golden, which are not embedded.
+func TestEmbeddedTemplates(t *testing.T) {
+	t.Parallel()
+
+	templates, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		t.Fatalf("fs.Sub error = %v", err)
+	}
+	entries, err := fs.ReadDir(templates, ".")
+	if err != nil {
+		t.Fatalf("ReadDir error = %v", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			results, err := generator.RunTemplateTests(templates, name, generator.TestOptions{GoldenDir: filepath.Join("testdata", "golden")})
+			if err != nil {
+				t.Fatalf("RunTemplateTests(%q) error = %v", name, err)
+			}
+			for _, result := range results {
+				if len(result.Failures) > 0 {
+					t.Errorf("%s: %s", result.Name, strings.Join(result.Failures, "\n    "))
+				}
+			}
+		})
+	}
+}
@@ -2,27 +2,35 @@
 
 set -euo pipefail
 
+# Usage: build-release-assets.sh [version] [goos/goarch...]
+#
+# The binaries are built with cgo, which pg_query needs for `gallium schema`,
+# so each target needs a C compiler for it: build on a matching host (macOS
+# hosts cover both darwin targets), or set CC to a cross compiler. Without
+# targets only the host's is built. scripts/checksum-release-assets.sh then
+# writes checksums.txt for everything in dist.
 VERSION="${1:-dev}"
+if [ "$#" -gt 0 ]; then
+	shift
+fi
+# Optional: minisign public key embedded for `gallium update` signature checks.
+UPDATE_PUBLIC_KEY="${UPDATE_PUBLIC_KEY:-}"
 ROOT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+COMMIT="$(git -C "${ROOT_DIR}" rev-parse HEAD 2>/dev/null || true)"
+BUILD_DATE="$(date -u +%Y-%m-%dT%H:%M:%SZ)"
 DIST_DIR="${ROOT_DIR}/dist"
-TARGETS=(
-	"darwin/amd64"
-	"darwin/arm64"
-	"linux/amd64"
-	"linux/arm64"
-)
+if [ "$#" -gt 0 ]; then
+	TARGETS=("$@")
+else
+	TARGETS=("$(go env GOOS)/$(go env GOARCH)")
+fi
 
 mkdir -p "${DIST_DIR}"
-rm -f "${DIST_DIR}"/gallium_* "${DIST_DIR}"/checksums.txt
 
 for target in "${TARGETS[@]}"; do
 	IFS=/ read -r goos goarch <<< "${target}"
 	output="${DIST_DIR}/gallium_${goos}_${goarch}"
-	CGO_ENABLED=0 GOOS="${goos}" GOARCH="${goarch}" \
-		go build -trimpath -ldflags "-s -w -X shireesh.com/gallium/cmd.Version=${VERSION}" -o "${output}" "${ROOT_DIR}"
+	rm -f "${output}"
+	CGO_ENABLED=1 GOOS="${goos}" GOARCH="${goarch}" \
+		go build -trimpath -ldflags "-s -w -X shireesh.com/gallium/cmd.Version=${VERSION} -X shireesh.com/gallium/cmd.Commit=${COMMIT} -X shireesh.com/gallium/cmd.BuildDate=${BUILD_DATE} -X shireesh.com/gallium/cmd.UpdatePublicKey=${UPDATE_PUBLIC_KEY}" -o "${output}" "${ROOT_DIR}"
 done
-
-(
-	cd "${DIST_DIR}"
-	shasum -a 256 gallium_* > checksums.txt
-)
\ No newline at end of file
@@ -0,0 +1,20 @@
+#!/usr/bin/env bash
+
+set -euo pipefail
+
+# Writes dist/checksums.txt for the binaries scripts/build-release-assets.sh
+# built, and signs it when a minisign secret key file is given.
+MINISIGN_SECRET_KEY_FILE="${MINISIGN_SECRET_KEY_FILE:-}"
+ROOT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+DIST_DIR="${ROOT_DIR}/dist"
+
+rm -f "${DIST_DIR}"/checksums.txt "${DIST_DIR}"/checksums.txt.minisig
+
+(
+	cd "${DIST_DIR}"
+	shasum -a 256 gallium_* > checksums.txt
+)
+
+if [ -n "${MINISIGN_SECRET_KEY_FILE}" ]; then
+	minisign -S -s "${MINISIGN_SECRET_KEY_FILE}" -m "${DIST_DIR}/checksums.txt"
+fi
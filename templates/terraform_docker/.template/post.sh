@@ -1,2 +1,2 @@
-#!/bin/bash
+#!/bin/sh
 echo "[POST] Project setup complete."
\ No newline at end of file
@@ -1,3 +1,3 @@
-#!/bin/bash
+#!/bin/sh
 echo "[PRE] Setting up project..."
 echo "[PRE] Creating directories..."
\ No newline at end of file